@@ -0,0 +1,228 @@
+package bootnode
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/discovery"
+	discv5 "github.com/umbracle/go-devp2p/discovery/v5"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// Config is the configuration of the bootnode
+type Config struct {
+	// Logger to be used by the bootnode
+	Logger *log.Logger
+
+	// Key is the node key
+	Key *ecdsa.PrivateKey
+
+	// Addr is the udp address to listen on
+	Addr *net.UDPAddr
+
+	// DataDir stores the nodes found and the sequence number of
+	// the node record. If empty, they are kept in memory.
+	DataDir string
+
+	// NetRestrict restricts the communication to the nodes in these networks
+	NetRestrict discovery.Netlist
+
+	// V5 runs discv5 on the same udp socket as discv4
+	V5 bool
+
+	// Bootnodes are the nodes to join an existing network
+	Bootnodes []string
+}
+
+// Bootnode runs only the discovery protocols of a node
+type Bootnode struct {
+	config    *Config
+	logger    *log.Logger
+	localNode *enode.LocalNode
+	addr      *net.UDPAddr
+	v4        *discovery.Backend
+	v5        *discv5.Backend
+	started   time.Time
+}
+
+// New creates a new bootnode listening on the address of the config
+func New(config *Config) (*Bootnode, error) {
+	if config.Key == nil {
+		return nil, fmt.Errorf("node key not set")
+	}
+	if config.Addr == nil {
+		return nil, fmt.Errorf("listen address not set")
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+
+	var store enode.SeqStore = &enode.NoopSeqStore{}
+	var db discovery.NodeDB = discovery.NewMemoryNodeDB()
+	if config.DataDir != "" {
+		if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+			return nil, err
+		}
+		store = enode.NewJSONSeqStore(config.DataDir)
+
+		jsonDB, err := discovery.NewJSONNodeDB(config.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		db = jsonDB
+	}
+
+	transport, err := discovery.NewUDPTransport(config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	addr := transport.Addr()
+
+	localNode, err := enode.NewLocalNode(config.Key, store)
+	if err != nil {
+		transport.Shutdown()
+		return nil, err
+	}
+	if !addr.IP.IsUnspecified() {
+		localNode.SetStaticIP(addr.IP)
+	}
+	udp := enr.Uint16(addr.Port)
+	localNode.Set("udp", &udp)
+
+	v4, err := discovery.NewBackend(logger, config.Key, transport, discovery.WithLocalNode(localNode), discovery.WithNodeDB(db))
+	if err != nil {
+		transport.Shutdown()
+		return nil, err
+	}
+	v4.SetBootnodes(filterBootnodes(config.Bootnodes, "enode:"))
+	if config.NetRestrict != nil {
+		v4.SetNetRestrict(config.NetRestrict)
+	}
+
+	b := &Bootnode{
+		config:    config,
+		logger:    logger,
+		localNode: localNode,
+		addr:      addr,
+		v4:        v4,
+	}
+	if config.V5 {
+		if b.v5, err = discv5.NewBackend(logger, config.Key, localNode, v4.Unhandled()); err != nil {
+			v4.Close()
+			return nil, err
+		}
+		b.v5.SetBootnodes(filterBootnodes(config.Bootnodes, "enr:"))
+	}
+	return b, nil
+}
+
+// filterBootnodes returns the bootnodes with the given scheme, discv4
+// uses enode addresses and discv5 text records (enr:...)
+func filterBootnodes(bootnodes []string, prefix string) []string {
+	res := []string{}
+	for _, str := range bootnodes {
+		if strings.HasPrefix(str, prefix) {
+			res = append(res, str)
+		}
+	}
+	return res
+}
+
+// Start starts the discovery protocols
+func (b *Bootnode) Start() {
+	b.started = time.Now()
+	b.v4.Schedule()
+	if b.v5 != nil {
+		b.v5.Schedule()
+	}
+	b.logger.Printf("[INFO] bootnode started: enode, %s", b.Enode())
+}
+
+// Close stops the bootnode and writes the nodes found to the data dir
+func (b *Bootnode) Close() error {
+	if b.v5 != nil {
+		b.v5.Close()
+	}
+	return b.v4.Close()
+}
+
+// Enode returns the enode address of the bootnode
+func (b *Bootnode) Enode() string {
+	e := &enode.Enode{
+		ID:  enode.PubkeyToEnode(&b.config.Key.PublicKey),
+		IP:  b.addr.IP,
+		UDP: uint16(b.addr.Port),
+	}
+	if ip := b.localNode.IP(); ip != nil {
+		// the ip reported by other nodes if listening on all interfaces
+		e.IP = ip
+	}
+	return e.String()
+}
+
+// Status is the status of a running bootnode
+type Status struct {
+	Enode     string                   `json:"enode"`
+	ENR       string                   `json:"enr"`
+	Uptime    string                   `json:"uptime"`
+	V4Nodes   int                      `json:"v4Nodes"`
+	V5Nodes   int                      `json:"v5Nodes,omitempty"`
+	Unhandled discovery.UnhandledStats `json:"unhandled"`
+}
+
+// Status returns the status of the bootnode
+func (b *Bootnode) Status() *Status {
+	s := &Status{
+		Enode:     b.Enode(),
+		ENR:       b.localNode.Record().Marshal(),
+		V4Nodes:   len(b.v4.GetPeers()),
+		Unhandled: b.v4.Unhandled().Stats(),
+	}
+	if !b.started.IsZero() {
+		s.Uptime = time.Since(b.started).Round(time.Second).String()
+	}
+	if b.v5 != nil {
+		s.V5Nodes = len(b.v5.Nodes())
+	}
+	return s
+}
+
+// LoadNodeKey loads a hex encoded node key from a file
+func LoadNodeKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNodeKey(strings.TrimSpace(string(data)))
+}
+
+// ParseNodeKey parses a hex encoded node key
+func ParseNodeKey(str string) (*ecdsa.PrivateKey, error) {
+	buf, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node key: %v", err)
+	}
+	if len(buf) != 32 {
+		return nil, fmt.Errorf("invalid node key length %d, expected 32", len(buf))
+	}
+	return crypto.ParsePrivateKey(buf)
+}
+
+// SaveNodeKey writes the node key hex encoded to a file
+func SaveNodeKey(path string, key *ecdsa.PrivateKey) error {
+	buf, err := crypto.MarshallPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(hex.EncodeToString(buf)), 0600)
+}
@@ -0,0 +1,59 @@
+package bootnode
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+)
+
+func newTestBootnode(t *testing.T, bootnodes ...string) *Bootnode {
+	key, _ := crypto.GenerateKey()
+
+	b, err := New(&Config{
+		Key:       key,
+		Addr:      &net.UDPAddr{IP: net.ParseIP("127.0.0.1")},
+		DataDir:   t.TempDir(),
+		V5:        true,
+		Bootnodes: bootnodes,
+	})
+	assert.NoError(t, err)
+	b.Start()
+
+	t.Cleanup(func() {
+		b.Close()
+	})
+	return b
+}
+
+func TestBootnode(t *testing.T) {
+	b0 := newTestBootnode(t)
+	b1 := newTestBootnode(t, b0.Enode(), b0.Status().ENR)
+
+	// both nodes find each other with discv4 and discv5
+	assert.Eventually(t, func() bool {
+		s0, s1 := b0.Status(), b1.Status()
+		return s0.V4Nodes == 1 && s1.V4Nodes == 1 && s0.V5Nodes == 1 && s1.V5Nodes == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the discv5 packets go through the discv4 socket
+	assert.NotZero(t, b0.Status().Unhandled.Received)
+}
+
+func TestNodeKey(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	path := filepath.Join(t.TempDir(), "nodekey")
+
+	assert.NoError(t, SaveNodeKey(path, key))
+	key2, err := LoadNodeKey(path)
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, key2.D)
+
+	_, err = ParseNodeKey("abcd")
+	assert.Error(t, err)
+	_, err = ParseNodeKey("xyz")
+	assert.Error(t, err)
+}
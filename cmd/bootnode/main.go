@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/umbracle/go-devp2p/bootnode"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/discovery"
+	"github.com/umbracle/go-devp2p/enode"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("bootnode", flag.ExitOnError)
+
+	var genKey, nodeKeyFile, nodeKeyHex, addr, dataDir, netrestrict, bootnodes string
+	var writeAddr, v5 bool
+	var status time.Duration
+
+	flags.StringVar(&genKey, "genkey", "", "generate a node key and write it to the file")
+	flags.StringVar(&nodeKeyFile, "nodekey", "", "file with the hex encoded node key")
+	flags.StringVar(&nodeKeyHex, "nodekeyhex", "", "hex encoded node key")
+	flags.StringVar(&addr, "addr", ":30301", "udp address to listen for discovery")
+	flags.StringVar(&dataDir, "datadir", "", "directory to store the nodes found, in memory if empty")
+	flags.StringVar(&netrestrict, "netrestrict", "", "restrict the communication to the given networks (CIDR list)")
+	flags.StringVar(&bootnodes, "bootnodes", "", "comma separated list of nodes to join an existing network")
+	flags.BoolVar(&writeAddr, "writeaddress", false, "write the public key of the node key and exit")
+	flags.BoolVar(&v5, "v5", false, "run discv5 on the same port as discv4")
+	flags.DurationVar(&status, "status", time.Minute, "interval to log the status of the bootnode, disabled if zero")
+	flags.Parse(args)
+
+	if genKey != "" {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return err
+		}
+		return bootnode.SaveNodeKey(genKey, key)
+	}
+
+	if nodeKeyFile != "" && nodeKeyHex != "" {
+		return fmt.Errorf("-nodekey and -nodekeyhex are mutually exclusive")
+	}
+	var nodeKey *ecdsa.PrivateKey
+	var err error
+	switch {
+	case nodeKeyFile != "":
+		nodeKey, err = bootnode.LoadNodeKey(nodeKeyFile)
+	case nodeKeyHex != "":
+		nodeKey, err = bootnode.ParseNodeKey(nodeKeyHex)
+	default:
+		// the node has a new identity every time it starts
+		nodeKey, err = crypto.GenerateKey()
+	}
+	if err != nil {
+		return err
+	}
+
+	if writeAddr {
+		fmt.Println(enode.PubkeyToEnode(&nodeKey.PublicKey).String())
+		return nil
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	config := &bootnode.Config{
+		Logger:  log.New(os.Stderr, "", log.LstdFlags),
+		Key:     nodeKey,
+		Addr:    udpAddr,
+		DataDir: dataDir,
+		V5:      v5,
+	}
+	if netrestrict != "" {
+		if config.NetRestrict, err = discovery.ParseNetlist(netrestrict); err != nil {
+			return err
+		}
+	}
+	if bootnodes != "" {
+		config.Bootnodes = strings.Split(bootnodes, ",")
+	}
+
+	b, err := bootnode.New(config)
+	if err != nil {
+		return err
+	}
+	b.Start()
+
+	var statusCh <-chan time.Time
+	if status != 0 {
+		ticker := time.NewTicker(status)
+		defer ticker.Stop()
+		statusCh = ticker.C
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	for {
+		select {
+		case <-statusCh:
+			data, err := json.Marshal(b.Status())
+			if err != nil {
+				return err
+			}
+			config.Logger.Printf("[INFO] status: %s", data)
+		case <-signalCh:
+			return b.Close()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/discovery"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/rlpx"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "crawl":
+		err = crawlCommand(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: devp2p <command> [flags]\n\ncommands:\n  crawl    crawl the discv4 network\n")
+	os.Exit(1)
+}
+
+func crawlCommand(args []string) error {
+	flags := flag.NewFlagSet("crawl", flag.ExitOnError)
+
+	var bootnodes, addr, input, output string
+	var timeout, revalidate time.Duration
+	var distances, workers int
+	var probe bool
+
+	flags.StringVar(&bootnodes, "bootnodes", "", "comma separated list of bootnodes")
+	flags.StringVar(&addr, "addr", "0.0.0.0:0", "udp address to listen for discovery")
+	flags.StringVar(&input, "input", "", "json file with the nodes of a previous crawl")
+	flags.StringVar(&output, "output", "", "json file to write the nodes, stdout if empty")
+	flags.DurationVar(&timeout, "timeout", 30*time.Minute, "time to crawl the network")
+	flags.DurationVar(&revalidate, "revalidate", 10*time.Minute, "interval to crawl again a node")
+	flags.IntVar(&distances, "distances", 16, "number of log distances queried to each node, at most 20")
+	flags.IntVar(&workers, "workers", 16, "number of nodes crawled at the same time")
+	flags.BoolVar(&probe, "probe", false, "connect to the live nodes to get their client name and capabilities")
+	flags.Parse(args)
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	var inputNodes discovery.CrawlResult
+	if input != "" {
+		data, err := ioutil.ReadFile(input)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &inputNodes); err != nil {
+			return err
+		}
+	}
+	if bootnodes == "" && len(inputNodes) == 0 {
+		return fmt.Errorf("no bootnodes or input nodes to start the crawl")
+	}
+
+	// the crawler uses an ephemeral key
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	transport, err := discovery.NewUDPTransport(udpAddr)
+	if err != nil {
+		return err
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	backend, err := discovery.NewBackend(logger, key, transport)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	if bootnodes != "" {
+		backend.SetBootnodes(strings.Split(bootnodes, ","))
+	}
+
+	config := &discovery.CrawlerConfig{
+		Revalidate: revalidate,
+		Distances:  distances,
+		Workers:    workers,
+	}
+	if probe {
+		config.Probe = helloProbe(key)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// stop the crawl with ctrl-c and still write the nodes found
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt)
+	go func() {
+		select {
+		case <-signalCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	res := discovery.NewCrawler(backend, config, inputNodes).Run(ctx)
+	logger.Printf("[INFO] crawl finished: nodes, %d", len(res))
+
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
+
+// helloTimeout is the time to do the rlpx handshake with a node
+const helloTimeout = 10 * time.Second
+
+// helloProbe returns a probe that connects to the node
+// with rlpx and reads its hello message
+func helloProbe(key *ecdsa.PrivateKey) discovery.HelloProbe {
+	info := &rlpx.Info{
+		Version: rlpx.BaseProtocolVersion,
+		Name:    "devp2p/crawler",
+		ID:      enode.PubkeyToEnode(&key.PublicKey),
+	}
+
+	return func(n *enode.Node) (string, []string, error) {
+		pub := n.Pubkey()
+		tcpAddr := n.TCPAddr()
+		conn, err := net.DialTimeout("tcp", tcpAddr.String(), helloTimeout)
+		if err != nil {
+			return "", nil, err
+		}
+		conn.SetDeadline(time.Now().Add(helloTimeout))
+
+		session := rlpx.Client(nil, conn, key, pub, info)
+		if err := session.Handshake(); err != nil {
+			conn.Close()
+			return "", nil, err
+		}
+		remote := session.RemoteInfo()
+		session.Disconnect(rlpx.DiscQuitting)
+
+		caps := []string{}
+		for _, cap := range remote.Caps {
+			caps = append(caps, fmt.Sprintf("%s/%d", cap.Name, cap.Version))
+		}
+		return remote.Name, caps, nil
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"io/ioutil"
 	"log"
 	"time"
+
+	"github.com/umbracle/go-devp2p/discovery"
+	"github.com/umbracle/go-devp2p/enode"
 )
 
 // Config is the p2p server configuration
@@ -11,12 +14,17 @@ type Config struct {
 	Logger           *log.Logger
 	Name             string
 	BindAddress      string
+	BindAddresses    []string
 	BindPort         int
 	MaxPeers         int
 	Bootnodes        []string
+	StaticNodes      []string
 	DialTasks        int
 	DialBusyInterval time.Duration
 	PeerStore        PeerStore
+	NodeSeqStore     enode.SeqStore
+	NodeDB           discovery.NodeDB
+	NodeFilter       func(*enode.Node) bool
 	Protocols        []*Protocol
 }
 
@@ -26,12 +34,16 @@ func DefaultConfig() *Config {
 		Name:             "minimal/go1.10.2",
 		Logger:           log.New(ioutil.Discard, "", 0),
 		BindAddress:      "127.0.0.1",
+		BindAddresses:    []string{},
 		BindPort:         30304,
 		MaxPeers:         10,
 		Bootnodes:        []string{},
+		StaticNodes:      []string{},
 		DialTasks:        defaultDialTasks,
 		DialBusyInterval: 1 * time.Minute,
 		PeerStore:        &NoopPeerStore{},
+		NodeSeqStore:     &enode.NoopSeqStore{},
+		NodeDB:           discovery.NewMemoryNodeDB(),
 		Protocols:        []*Protocol{},
 	}
 	return c
@@ -51,6 +63,14 @@ func WithBindAddress(addr string) ConfigOption {
 	}
 }
 
+// WithBindAddresses adds addresses to listen on besides the bind
+// address (i.e. an ipv6 address to run in dual-stack mode)
+func WithBindAddresses(addrs ...string) ConfigOption {
+	return func(c *Config) {
+		c.BindAddresses = append(c.BindAddresses, addrs...)
+	}
+}
+
 func WithBindPort(port int) ConfigOption {
 	return func(c *Config) {
 		c.BindPort = port
@@ -69,12 +89,41 @@ func WithBootnodes(bootnodes []string) ConfigOption {
 	}
 }
 
+// WithStaticNodes sets nodes that are always dialed. If the dial of a static
+// node fails, its current endpoint is resolved with the discovery protocol.
+func WithStaticNodes(nodes ...string) ConfigOption {
+	return func(c *Config) {
+		c.StaticNodes = append(c.StaticNodes, nodes...)
+	}
+}
+
 func WithPeerStore(peerstore PeerStore) ConfigOption {
 	return func(c *Config) {
 		c.PeerStore = peerstore
 	}
 }
 
+func WithNodeSeqStore(store enode.SeqStore) ConfigOption {
+	return func(c *Config) {
+		c.NodeSeqStore = store
+	}
+}
+
+// WithNodeDB sets the database to store the discovery nodes
+func WithNodeDB(db discovery.NodeDB) ConfigOption {
+	return func(c *Config) {
+		c.NodeDB = db
+	}
+}
+
+// WithNodeFilter sets a filter for the discovered nodes before they are dialed.
+// The record of the nodes is requested if the discovery protocol supports it.
+func WithNodeFilter(filter func(*enode.Node) bool) ConfigOption {
+	return func(c *Config) {
+		c.NodeFilter = filter
+	}
+}
+
 func WithLogger(logger *log.Logger) ConfigOption {
 	return func(c *Config) {
 		c.Logger = logger
@@ -86,3 +135,8 @@ func WithProtocol(p *Protocol) ConfigOption {
 		c.Protocols = append(c.Protocols, p)
 	}
 }
+
+// bindAddrs returns all the addresses to listen on
+func (c *Config) bindAddrs() []string {
+	return append([]string{c.BindAddress}, c.BindAddresses...)
+}
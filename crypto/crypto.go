@@ -5,6 +5,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"fmt"
+	"math/big"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/umbracle/ecies"
@@ -105,3 +106,23 @@ func ParseCompressedPubKey(d []byte) (*ecdsa.PublicKey, error) {
 	}
 	return key.ToECDSA(), nil
 }
+
+// VerifySignature checks that the 64 bytes [R || S] signature of the
+// hash has been created by the public key
+func VerifySignature(pub *ecdsa.PublicKey, hash, signature []byte) bool {
+	if len(signature) != 64 {
+		return false
+	}
+	sig := &btcec.Signature{
+		R: new(big.Int).SetBytes(signature[:32]),
+		S: new(big.Int).SetBytes(signature[32:]),
+	}
+	return sig.Verify(hash, (*btcec.PublicKey)(pub))
+}
+
+// ECDH computes the shared secret between the private and the public
+// key. The secret is the compressed form of the shared point.
+func ECDH(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey) []byte {
+	x, y := S256.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	return CompressPubKey(&ecdsa.PublicKey{Curve: S256, X: x, Y: y})
+}
@@ -28,3 +28,25 @@ func TestKeyEncoding(t *testing.T) {
 		assert.Equal(t, priv.PublicKey, *pub0)
 	}
 }
+
+func TestVerifySignature(t *testing.T) {
+	priv, _ := GenerateKey()
+	hash := Keccak256([]byte("msg"))
+
+	sig, err := Sign(priv, hash)
+	assert.NoError(t, err)
+
+	assert.True(t, VerifySignature(&priv.PublicKey, hash, sig[:64]))
+	assert.False(t, VerifySignature(&priv.PublicKey, Keccak256([]byte("other")), sig[:64]))
+}
+
+func TestECDH(t *testing.T) {
+	priv0, _ := GenerateKey()
+	priv1, _ := GenerateKey()
+
+	secret0 := ECDH(priv0, &priv1.PublicKey)
+	secret1 := ECDH(priv1, &priv0.PublicKey)
+
+	assert.Len(t, secret0, 33)
+	assert.Equal(t, secret0, secret1)
+}
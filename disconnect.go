@@ -0,0 +1,107 @@
+package devp2p
+
+import (
+	"fmt"
+)
+
+// DiscReason is the reason given to close a session with a peer
+type DiscReason uint
+
+const (
+	DiscRequested DiscReason = iota
+	DiscNetworkError
+	DiscProtocolError
+	DiscUselessPeer
+	DiscTooManyPeers
+	DiscAlreadyConnected
+	DiscIncompatibleVersion
+	DiscInvalidIdentity
+	DiscQuitting
+	DiscUnexpectedIdentity
+	DiscSelf
+	DiscReadTimeout
+	DiscSubprotocolError DiscReason = 0x10
+	DiscUnknown          DiscReason = 0x100
+)
+
+func (d DiscReason) String() string {
+	switch d {
+	case DiscRequested:
+		return "disconnect requested"
+	case DiscNetworkError:
+		return "network error"
+	case DiscProtocolError:
+		return "breach of protocol"
+	case DiscUselessPeer:
+		return "useless peer"
+	case DiscTooManyPeers:
+		return "too many peers"
+	case DiscAlreadyConnected:
+		return "already connected"
+	case DiscIncompatibleVersion:
+		return "incompatible p2p protocol version"
+	case DiscInvalidIdentity:
+		return "invalid node identity"
+	case DiscQuitting:
+		return "client quitting"
+	case DiscUnexpectedIdentity:
+		return "unexpected identity"
+	case DiscSelf:
+		return "connected to self"
+	case DiscReadTimeout:
+		return "read timeout"
+	case DiscSubprotocolError:
+		return "subprotocol error"
+	default:
+		return fmt.Sprintf("unknown disconnect reason: %d", d)
+	}
+}
+
+func (d DiscReason) Error() string {
+	return d.String()
+}
+
+// DisconnectError describes why a session was closed and which
+// side of the connection closed it
+type DisconnectError struct {
+	// Reason is the disconnect reason sent or received
+	Reason DiscReason
+
+	// Remote is true if the remote peer sent the disconnect message
+	Remote bool
+
+	// Err is the underlying error if the session was closed because
+	// of a failure (i.e. network error) instead of a disconnect request
+	Err error
+}
+
+// NewDisconnectError builds a DisconnectError out of the error that closed a session
+func NewDisconnectError(err error, remote bool) *DisconnectError {
+	switch obj := err.(type) {
+	case *DisconnectError:
+		return obj
+	case DiscReason:
+		return &DisconnectError{Reason: obj, Remote: remote}
+	default:
+		return &DisconnectError{Reason: DiscNetworkError, Remote: remote, Err: err}
+	}
+}
+
+func (d *DisconnectError) Error() string {
+	side := "local"
+	if d.Remote {
+		side = "remote"
+	}
+	if d.Err != nil {
+		return fmt.Sprintf("%s disconnect: %s: %v", side, d.Reason, d.Err)
+	}
+	return fmt.Sprintf("%s disconnect: %s", side, d.Reason)
+}
+
+// Unwrap returns the underlying error
+func (d *DisconnectError) Unwrap() error {
+	if d.Err != nil {
+		return d.Err
+	}
+	return d.Reason
+}
@@ -0,0 +1,403 @@
+package discovery
+
+import (
+	"context"
+	crand "crypto/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// CrawlNode is a node found by the crawler. The fields follow the
+// format of the node sets used to generate the dns trees (EIP-1459).
+type CrawlNode struct {
+	// Seq is the sequence number of the node record
+	Seq uint64 `json:"seq"`
+
+	// Record is the text form of the node record
+	Record string `json:"record"`
+
+	// Enode is the url of the node
+	Enode string `json:"enode,omitempty"`
+
+	// Score increases with every check the node responds to
+	Score int `json:"score"`
+
+	// FirstResponse and LastResponse are the first and last
+	// time the node responded to the crawler
+	FirstResponse time.Time `json:"firstResponse"`
+	LastResponse  time.Time `json:"lastResponse"`
+
+	// LastCheck is the last time the node was crawled
+	LastCheck time.Time `json:"lastCheck"`
+
+	// Client and Caps are the client name and capabilities
+	// of the rlpx hello message, if probed
+	Client string   `json:"client,omitempty"`
+	Caps   []string `json:"caps,omitempty"`
+}
+
+// node returns the discovery node
+func (c *CrawlNode) node() (*enode.Node, error) {
+	if c.Enode != "" {
+		e, err := enode.ParseURL(c.Enode)
+		if err != nil {
+			return nil, err
+		}
+		return enode.NodeFromEnode(e)
+	}
+	record, err := enr.Unmarshal(c.Record)
+	if err != nil {
+		return nil, err
+	}
+	return enode.NodeFromRecord(record)
+}
+
+// CrawlResult is the set of nodes found by the crawler by node id
+type CrawlResult map[string]*CrawlNode
+
+// HelloProbe connects to the node and returns the client name
+// and capabilities of its rlpx hello message
+type HelloProbe func(n *enode.Node) (client string, caps []string, err error)
+
+// maxCrawlDistances is the maximum number of log distances queried to a node.
+// The targets at closer distances are too expensive to find and the buckets
+// of the nodes at those distances are mostly empty.
+const maxCrawlDistances = 20
+
+// CrawlerConfig is the configuration of the crawler
+type CrawlerConfig struct {
+	// Revalidate is the interval to crawl again a node
+	Revalidate time.Duration
+
+	// Distances is the number of log distances, starting from the farthest
+	// one, queried to each node. The query at the closest distance also
+	// returns the neighbors of the node at all the closer distances.
+	Distances int
+
+	// Workers is the number of nodes crawled at the same time
+	Workers int
+
+	// Probe, if set, is used to get the hello message of the live nodes
+	Probe HelloProbe
+}
+
+// DefaultCrawlerConfig returns the default configuration of the crawler
+func DefaultCrawlerConfig() *CrawlerConfig {
+	return &CrawlerConfig{
+		Revalidate: 10 * time.Minute,
+		Distances:  16,
+		Workers:    16,
+	}
+}
+
+// crawlResult is the result of crawling a single node
+type crawlResult struct {
+	peer  *Peer
+	alive bool
+	found []*Peer
+	seq   uint64
+	rec   string
+	cli   string
+	caps  []string
+}
+
+// Crawler queries every node it finds for its neighbors at all the log
+// distances and tracks the liveness of the nodes over time.
+type Crawler struct {
+	backend *Backend
+	config  *CrawlerConfig
+
+	lock  sync.Mutex
+	nodes CrawlResult
+
+	reqCh   chan *Peer
+	resCh   chan *crawlResult
+	closeCh chan struct{}
+}
+
+// NewCrawler creates a crawler on top of the discovery backend. The nodes
+// of 'input', if any, are crawled again along with the bootnodes.
+func NewCrawler(backend *Backend, config *CrawlerConfig, input CrawlResult) *Crawler {
+	if config == nil {
+		config = DefaultCrawlerConfig()
+	}
+	if config.Revalidate <= 0 {
+		config.Revalidate = DefaultCrawlerConfig().Revalidate
+	}
+	if config.Distances <= 0 {
+		config.Distances = DefaultCrawlerConfig().Distances
+	}
+	if config.Distances > maxCrawlDistances {
+		config.Distances = maxCrawlDistances
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	c := &Crawler{
+		backend: backend,
+		config:  config,
+		nodes:   CrawlResult{},
+		reqCh:   make(chan *Peer),
+		resCh:   make(chan *crawlResult),
+		closeCh: make(chan struct{}),
+	}
+	for id, n := range input {
+		nn := *n
+		c.nodes[id] = &nn
+	}
+	return c
+}
+
+// Nodes returns a copy of the nodes found so far
+func (c *Crawler) Nodes() CrawlResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	res := CrawlResult{}
+	for id, n := range c.nodes {
+		nn := *n
+		res[id] = &nn
+	}
+	return res
+}
+
+// Run crawls the network until the context is done and returns the live nodes
+func (c *Crawler) Run(ctx context.Context) CrawlResult {
+	defer close(c.closeCh)
+
+	for i := 0; i < c.config.Workers; i++ {
+		go c.runWorker()
+	}
+
+	// pending are the nodes in the queue or being crawled and
+	// visited are all the nodes queued at any point
+	queue := []*Peer{}
+	pending := map[string]bool{}
+	visited := map[string]bool{}
+	enqueue := func(p *Peer) {
+		if !pending[p.ID] && p.ID != c.backend.local.ID {
+			pending[p.ID] = true
+			visited[p.ID] = true
+			queue = append(queue, p)
+		}
+	}
+
+	for _, n := range c.seeds() {
+		enqueue(n)
+	}
+
+	revalidate := time.NewTicker(c.config.Revalidate / 10)
+	defer revalidate.Stop()
+
+	for {
+		var next *Peer
+		var reqCh chan *Peer
+		if len(queue) != 0 {
+			next, reqCh = queue[0], c.reqCh
+		}
+
+		select {
+		case reqCh <- next:
+			queue = queue[1:]
+
+		case res := <-c.resCh:
+			delete(pending, res.peer.ID)
+			c.update(res)
+			for _, p := range res.found {
+				if !visited[p.ID] {
+					enqueue(p)
+				}
+			}
+
+		case <-revalidate.C:
+			for _, p := range c.expired() {
+				enqueue(p)
+			}
+
+		case <-ctx.Done():
+			return c.alive()
+		}
+	}
+}
+
+// seeds returns the bootnodes and the nodes of the input
+func (c *Crawler) seeds() []*Peer {
+	seeds := []*Peer{}
+	for _, b := range c.backend.bootnodes {
+		e, err := enode.ParseURL(b)
+		if err != nil {
+			c.backend.logger.Printf("[ERROR] failed to parse bootnode: err, %v", err)
+			continue
+		}
+		if p, err := enodeToPeer(e); err == nil {
+			seeds = append(seeds, p)
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, n := range c.nodes {
+		node, err := n.node()
+		if err != nil {
+			continue
+		}
+		if p, err := enodeToPeer(node.Enode()); err == nil {
+			seeds = append(seeds, p)
+		}
+	}
+	return seeds
+}
+
+// expired returns the nodes not checked since the revalidation interval
+func (c *Crawler) expired() []*Peer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+
+	res := []*Peer{}
+	for _, n := range c.nodes {
+		if now.Sub(n.LastCheck) < c.config.Revalidate {
+			continue
+		}
+		node, err := n.node()
+		if err != nil {
+			continue
+		}
+		if p, err := enodeToPeer(node.Enode()); err == nil {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// alive returns the nodes that have responded at least once. The nodes
+// without record are not included since they cannot be part of a dns tree.
+func (c *Crawler) alive() CrawlResult {
+	res := CrawlResult{}
+	for id, n := range c.Nodes() {
+		if !n.LastResponse.IsZero() && n.Record != "" {
+			res[id] = n
+		}
+	}
+	return res
+}
+
+func (c *Crawler) update(res *crawlResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+
+	n, ok := c.nodes[res.peer.ID]
+	if !ok {
+		if !res.alive {
+			// do not track the nodes that never responded
+			return
+		}
+		n = &CrawlNode{}
+		c.nodes[res.peer.ID] = n
+	}
+	n.LastCheck = now
+	n.Enode = res.peer.toEnode().String()
+
+	if !res.alive {
+		if n.Score > 0 {
+			n.Score--
+		}
+		return
+	}
+
+	n.Score++
+	if n.FirstResponse.IsZero() {
+		n.FirstResponse = now
+	}
+	n.LastResponse = now
+	if res.rec != "" && res.seq >= n.Seq {
+		n.Seq, n.Record = res.seq, res.rec
+	}
+	if res.cli != "" {
+		n.Client, n.Caps = res.cli, res.caps
+	}
+}
+
+func (c *Crawler) runWorker() {
+	for {
+		select {
+		case p := <-c.reqCh:
+			res := c.crawl(p)
+			select {
+			case c.resCh <- res:
+			case <-c.closeCh:
+				return
+			}
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+// crawl queries the node for its neighbors at the farthest log distances
+func (c *Crawler) crawl(p *Peer) *crawlResult {
+	res := &crawlResult{peer: p}
+
+	seen := map[string]bool{}
+	for _, target := range targetsAtDistances(nodeHash(p.Bytes), c.config.Distances) {
+		found, err := c.backend.findNodes(p, target)
+		if err != nil {
+			// the node did not answer the ping or the
+			// findnode after the bonding, it is not reachable
+			break
+		}
+		res.alive = true
+		for _, n := range found {
+			if !seen[n.ID] {
+				seen[n.ID] = true
+				res.found = append(res.found, n)
+			}
+		}
+	}
+	if !res.alive {
+		return res
+	}
+
+	if record, err := c.backend.RequestENR(p); err == nil {
+		res.seq, res.rec = record.Seq(), record.Marshal()
+		p.Record = record
+	}
+	if c.config.Probe != nil && p.TCP != 0 {
+		if node, err := p.toNode(); err == nil {
+			if cli, caps, err := c.config.Probe(node); err == nil {
+				res.cli, res.caps = cli, caps
+			}
+		}
+	}
+	return res
+}
+
+// targetsAtDistances returns a random target for each of the n farthest log
+// distances of 'hash', the farthest first. Every target generated is kept for
+// the distance it falls in, finding all of them takes around 2^n hashes.
+func targetsAtDistances(hash [32]byte, n int) [][]byte {
+	targets := make([][]byte, n)
+	for missing := n; missing > 0; {
+		target := make([]byte, nodeIDBytes)
+		crand.Read(target)
+
+		i := numLogDistBuckets - logDist(hash, nodeHash(target))
+		if i < n && targets[i] == nil {
+			targets[i] = target
+			missing--
+		}
+	}
+	return targets
+}
+
+func enodeToPeer(e *enode.Enode) (*Peer, error) {
+	return newPeer(e.ID.String(), &net.UDPAddr{IP: e.IP, Port: int(e.UDP)}, e.TCP)
+}
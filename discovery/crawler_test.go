@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"crypto/elliptic"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+)
+
+func TestCrawler_Crawl(t *testing.T) {
+	// findnode waits for more neighbors until the response timeout
+	network := NewMockNetwork()
+	r0 := newTestDiscovery(t, network.NewTransport(), false, WithRespTimeout(500*time.Millisecond))
+
+	// r1 has a record
+	key, _ := crypto.GenerateKey()
+	localNode, err := enode.NewLocalNode(key, nil)
+	assert.NoError(t, err)
+	r1 := newTestDiscoveryWithKey(t, key, network.NewTransport(), false, WithLocalNode(localNode), WithRespTimeout(500*time.Millisecond))
+
+	// r1 knows about another node
+	prv, _ := crypto.GenerateKey()
+	pub := &prv.PublicKey
+	peer, err := newPeer(EncodeToHex(elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:]), &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}, 0)
+	assert.NoError(t, err)
+	r1.updatePeer(peer)
+
+	r1.local.TCP = 30303
+
+	// r0 already has a pong from r1, otherwise the ping of r1 to bond
+	// back would start a second probe of r1 on the side of r0
+	r0.updateNodeDB(r1.local, func(n *NodeEntry) {
+		n.IP = r1.local.UDPAddr.IP
+		n.LastPong = time.Now()
+	})
+	r0.SetBootnodes([]string{r1.local.toEnode().String()})
+
+	config := DefaultCrawlerConfig()
+	config.Distances = 1
+	config.Probe = func(n *enode.Node) (string, []string, error) {
+		return "client", []string{"eth/66"}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res := NewCrawler(r0, config, nil).Run(ctx)
+	assert.Len(t, res, 1)
+
+	n, ok := res[r1.local.ID]
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, 1, n.Score)
+	assert.False(t, n.LastResponse.IsZero())
+	assert.Equal(t, "client", n.Client)
+	assert.NotEmpty(t, n.Record)
+
+	// the result can be encoded and used as input
+	data, err := json.Marshal(res)
+	assert.NoError(t, err)
+
+	var input CrawlResult
+	assert.NoError(t, json.Unmarshal(data, &input))
+	assert.Equal(t, n.Enode, input[r1.local.ID].Enode)
+}
+
+func TestCrawler_AliveWithRecord(t *testing.T) {
+	r0, _ := pipe(t, false)
+
+	// the nodes without record are not part of the result
+	input := CrawlResult{
+		"a": {Record: "enr:-", LastResponse: time.Now()},
+		"b": {LastResponse: time.Now()},
+		"c": {Record: "enr:-"},
+	}
+	res := NewCrawler(r0, nil, input).alive()
+	assert.Len(t, res, 1)
+	assert.Contains(t, res, "a")
+}
+
+func TestCrawler_TargetsAtDistances(t *testing.T) {
+	var hash [32]byte
+	targets := targetsAtDistances(hash, 8)
+	assert.Len(t, targets, 8)
+	for i, target := range targets {
+		assert.Len(t, target, nodeIDBytes)
+		assert.Equal(t, numLogDistBuckets-i, logDist(hash, nodeHash(target)))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"log"
+	"net"
 
 	"github.com/umbracle/go-devp2p/enode"
 )
@@ -13,8 +14,9 @@ type Discovery interface {
 	// Close closes the backend
 	Close() error
 
-	// Deliver returns discovered elements
-	Deliver() chan string
+	// RandomNodes returns an iterator over the nodes found
+	// with lookups of random targets
+	RandomNodes() Iterator
 
 	// Schedule starts the discovery
 	Schedule()
@@ -28,9 +30,26 @@ type DiscoveryConfig struct {
 	// Enode is the identification of the node
 	Enode *enode.Enode
 
+	// LocalNode is the record of the node. It is updated with the
+	// endpoints that other peers report for us.
+	LocalNode *enode.LocalNode
+
 	// Private key of the node to encrypt/decrypt messages
 	Key *ecdsa.PrivateKey
 
+	// BindAddrs are the udp addresses to listen on. If empty, the
+	// address of the Enode is used.
+	BindAddrs []*net.UDPAddr
+
+	// NodeDB stores the nodes found. If nil, the nodes are kept in memory.
+	NodeDB NodeDB
+
+	// Table is the kind of routing table. Defaults to the kademlia table.
+	Table TableKind
+
+	// NetRestrict restricts the communication to the nodes in these networks
+	NetRestrict Netlist
+
 	Bootnodes []string
 }
 
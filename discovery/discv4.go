@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net"
 	"strconv"
 	"strings"
@@ -18,11 +17,10 @@ import (
 	"time"
 
 	"github.com/umbracle/go-devp2p/crypto"
-	"github.com/umbracle/go-devp2p/discovery/kademlia"
 	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
 
 	"github.com/umbracle/fastrlp"
-	"golang.org/x/crypto/sha3"
 
 	crand "crypto/rand"
 )
@@ -30,16 +28,37 @@ import (
 var (
 	bucketSize         = 16
 	bondExpiration     = 24 * time.Hour
-	respTimeout        = 10 * time.Second
+	defaultRespTimeout = 10 * time.Second
 	revalidateInterval = 10 * time.Second
 	lookupInterval     = 1 * time.Minute
 	numProbeTasks      = 2
+
+	// bondWaitTimeout is the time to wait for the ping back of a node
+	// after bonding with it before sending a request
+	bondWaitTimeout = 500 * time.Millisecond
+
+	// maxFindnodeFailures is the number of consecutive findnode
+	// failures after which a node is removed from the table
+	maxFindnodeFailures = 5
+
+	// numPacketWorkers is the number of goroutines handling the incoming
+	// packets and packetQueueSize the number of packets waiting to be handled.
+	// Packets that arrive with the queue full are dropped.
+	numPacketWorkers = 16
+	packetQueueSize  = 512
+
+	// packetRate and packetBurst are the packets per second
+	// and the burst of packets accepted from a single ip
+	packetRate  = 100.0
+	packetBurst = 200
 )
 
 const (
-	nodeIDBytes  = 512 / 8
-	maxNeighbors = 6
-	alpha        = 3
+	nodeIDBytes = 512 / 8
+	alpha       = 3
+
+	// maxPacketSize is the maximum size of a discv4 packet
+	maxPacketSize = 1280
 )
 
 func EncodeToHex(str []byte) string {
@@ -60,6 +79,7 @@ type Peer struct {
 	UDPAddr *net.UDPAddr
 	Last    *time.Time // last time pinged
 	TCP     uint16
+	Record  *enr.Record // last node record received, if any
 }
 
 // Enode returns an enode address
@@ -68,6 +88,28 @@ func (p *Peer) Enode() string {
 	return fmt.Sprintf("enode://%s@%s:%d", id, p.UDPAddr.IP.String(), p.TCP)
 }
 
+// toEnode returns the endpoint of the peer
+func (p *Peer) toEnode() *enode.Enode {
+	e := &enode.Enode{
+		IP:  p.UDPAddr.IP,
+		UDP: uint16(p.UDPAddr.Port),
+		TCP: p.TCP,
+	}
+	copy(e.ID[:], p.Bytes)
+	return e
+}
+
+// toNode returns the node of the peer with its record, if known. The
+// fields that the record does not have are taken from the endpoint.
+func (p *Peer) toNode() (*enode.Node, error) {
+	if p.Record != nil {
+		if n, err := enode.NodeWithEnode(p.Record, p.toEnode()); err == nil {
+			return n, nil
+		}
+	}
+	return enode.NodeFromEnode(p.toEnode())
+}
+
 func (p *Peer) addr() string {
 	return p.UDPAddr.String()
 }
@@ -84,7 +126,7 @@ func (p *Peer) toRPCNode() rpcNode {
 	r.ID = p.Bytes
 	r.IP = p.UDPAddr.IP
 	r.UDP = uint16(p.UDPAddr.Port)
-	r.TCP = 0
+	r.TCP = p.TCP
 	return r
 }
 
@@ -109,7 +151,7 @@ func newPeer(id string, addr *net.UDPAddr, tcp uint16) (*Peer, error) {
 		return nil, err
 	}
 
-	return &Peer{id, bytes, addr, nil, tcp}, nil
+	return &Peer{id, bytes, addr, nil, tcp, nil}, nil
 }
 
 const (
@@ -128,6 +170,8 @@ const (
 	pongPacket
 	findnodePacket
 	neighborsPacket
+	enrRequestPacket  // EIP-868
+	enrResponsePacket // EIP-868
 )
 
 type rlpMessage interface {
@@ -144,7 +188,8 @@ type pingRequest struct {
 	Version    uint64
 	From       rpcEndpoint
 	To         rpcEndpoint
-	Expiration uint64 `rlp:"tail"`
+	Expiration uint64
+	ENRSeq     uint64 `rlp:"optional"` // EIP-868
 }
 
 func (p *pingRequest) UnmarshalRLP(v *fastrlp.Value) error {
@@ -169,6 +214,10 @@ func (p *pingRequest) UnmarshalRLP(v *fastrlp.Value) error {
 	if err != nil {
 		return err
 	}
+	if len(elems) > 4 {
+		// ignore the seq if it cannot be decoded for forward compatibility (EIP-8)
+		p.ENRSeq, _ = elems[4].GetUint64()
+	}
 	return nil
 }
 
@@ -180,6 +229,9 @@ func (p *pingRequest) MarshalRLP(dst []byte) []byte {
 	v.Set(p.From.MarshalRLP(a))
 	v.Set(p.To.MarshalRLP(a))
 	v.Set(a.NewUint(p.Expiration))
+	if p.ENRSeq != 0 {
+		v.Set(a.NewUint(p.ENRSeq))
+	}
 
 	dst = v.MarshalTo(dst)
 	defaultArenaPool.Put(a)
@@ -190,7 +242,33 @@ func (p *pingRequest) MarshalRLP(dst []byte) []byte {
 type pongResponse struct {
 	To         rpcEndpoint
 	ReplyTok   []byte
-	Expiration uint64 `rlp:"tail"`
+	Expiration uint64
+	ENRSeq     uint64 `rlp:"optional"` // EIP-868
+}
+
+func (p *pongResponse) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := v.GetElems()
+	if err != nil {
+		return err
+	}
+	if len(elems) < 3 {
+		return fmt.Errorf("bad")
+	}
+	if err := p.To.UnmarshalRLP(elems[0]); err != nil {
+		return err
+	}
+	p.ReplyTok, err = elems[1].GetBytes(p.ReplyTok[:0])
+	if err != nil {
+		return err
+	}
+	p.Expiration, err = elems[2].GetUint64()
+	if err != nil {
+		return err
+	}
+	if len(elems) > 3 {
+		p.ENRSeq, _ = elems[3].GetUint64()
+	}
+	return nil
 }
 
 func (p *pongResponse) MarshalRLP(dst []byte) []byte {
@@ -200,6 +278,77 @@ func (p *pongResponse) MarshalRLP(dst []byte) []byte {
 	v.Set(p.To.MarshalRLP(a))
 	v.Set(a.NewCopyBytes(p.ReplyTok))
 	v.Set(a.NewUint(p.Expiration))
+	if p.ENRSeq != 0 {
+		v.Set(a.NewUint(p.ENRSeq))
+	}
+
+	dst = v.MarshalTo(dst)
+	defaultArenaPool.Put(a)
+	return dst
+}
+
+// enrRequest queries the node record of the remote node (EIP-868)
+type enrRequest struct {
+	Expiration uint64
+}
+
+func (e *enrRequest) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := v.GetElems()
+	if err != nil {
+		return err
+	}
+	if len(elems) < 1 {
+		return fmt.Errorf("bad")
+	}
+	e.Expiration, err = elems[0].GetUint64()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *enrRequest) MarshalRLP(dst []byte) []byte {
+	a := defaultArenaPool.Get()
+
+	v := a.NewArray()
+	v.Set(a.NewUint(e.Expiration))
+
+	dst = v.MarshalTo(dst)
+	defaultArenaPool.Put(a)
+	return dst
+}
+
+// enrResponse is the reply to enrRequest (EIP-868)
+type enrResponse struct {
+	ReplyTok []byte
+	Record   *enr.Record
+}
+
+func (e *enrResponse) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := v.GetElems()
+	if err != nil {
+		return err
+	}
+	if len(elems) < 2 {
+		return fmt.Errorf("bad")
+	}
+	e.ReplyTok, err = elems[0].GetBytes(e.ReplyTok[:0])
+	if err != nil {
+		return err
+	}
+	e.Record = &enr.Record{}
+	if err := e.Record.UnmarshalRLPWith(elems[1]); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *enrResponse) MarshalRLP(dst []byte) []byte {
+	a := defaultArenaPool.Get()
+
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(e.ReplyTok))
+	v.Set(e.Record.MarshalRLPWith(a))
 
 	dst = v.MarshalTo(dst)
 	defaultArenaPool.Put(a)
@@ -309,6 +458,9 @@ func (r *rpcNode) UnmarshalRLP(v *fastrlp.Value) error {
 	if err != nil {
 		return err
 	}
+	if len(elems) < 4 {
+		return fmt.Errorf("bad")
+	}
 
 	r.IP, err = elems[0].GetBytes(r.IP[:0])
 	if err != nil {
@@ -356,6 +508,9 @@ func (r *rpcEndpoint) UnmarshalRLP(v *fastrlp.Value) error {
 	if err != nil {
 		return err
 	}
+	if len(elems) < 3 {
+		return fmt.Errorf("bad")
+	}
 
 	r.IP, err = elems[0].GetBytes(r.IP[:0])
 	if err != nil {
@@ -387,46 +542,113 @@ func (r *rpcEndpoint) MarshalRLP(a *fastrlp.Arena) *fastrlp.Value {
 type Backend struct {
 	logger     *log.Logger
 	ID         *ecdsa.PrivateKey
-	timer      *time.Timer
-	handlers   map[string]func(payload []byte, timestamp *time.Time)
+	handlers   map[string][]*replyHandler
 	respLock   sync.Mutex
+	findLock   sync.Mutex
+	finding    map[string]chan struct{}
 	validLock  sync.Mutex
-	table      *kademlia.RoutingTable
+	table      routingTable
 	nodes      map[string]*Peer
 	local      *Peer
 	shutdownCh chan bool
 	shutdown   int32
 	active     bool // set to true when the bootnodes are loaded
-	eventCh    chan string
 	tasks      chan *Peer
-	inlookup   int32
 	addr       *net.UDPAddr
 	transport  Transport
+	unhandled  *UnhandledTransport
 	packetCh   chan *Packet
+	pool       *PacketPool
+	limiter    *IPRateLimiter
+	restrict   atomic.Value // Netlist
+	localNode  *enode.LocalNode
+	db         NodeDB
+	dbLock     sync.Mutex
+
+	// respTimeout is the time to wait for the response of a request
+	respTimeout time.Duration
 
 	bootnodes []string
 }
 
 func DiscV4(ctx context.Context, conf *DiscoveryConfig) (Discovery, error) {
-	addr := conf.Enode.IP.String()
-	port := int(conf.Enode.UDP)
+	udpAddrs := conf.BindAddrs
+	if len(udpAddrs) == 0 {
+		addr := conf.Enode.IP.String()
+		port := int(conf.Enode.UDP)
 
-	udpAddr := &net.UDPAddr{IP: net.ParseIP(addr), Port: port}
+		udpAddrs = []*net.UDPAddr{{IP: net.ParseIP(addr), Port: port}}
+	}
 
-	transport, err := newUDPTransport(udpAddr)
+	transport, err := NewUDPTransport(udpAddrs...)
 	if err != nil {
 		return nil, err
 	}
-	d, err := NewBackend(conf.Logger, conf.Key, transport)
+	opts := []BackendOption{
+		WithTable(conf.Table),
+	}
+	if conf.LocalNode != nil {
+		opts = append(opts, WithLocalNode(conf.LocalNode))
+	}
+	if conf.Enode != nil {
+		opts = append(opts, WithTCPPort(conf.Enode.TCP))
+	}
+	if conf.NodeDB != nil {
+		opts = append(opts, WithNodeDB(conf.NodeDB))
+	}
+	d, err := NewBackend(conf.Logger, conf.Key, transport, opts...)
 	if err != nil {
+		transport.Shutdown()
 		return nil, err
 	}
 	d.SetBootnodes(conf.Bootnodes)
+	if conf.NetRestrict != nil {
+		d.SetNetRestrict(conf.NetRestrict)
+	}
 	return d, nil
 }
 
+// BackendOption is an option of the discovery backend
+type BackendOption func(*Backend)
+
+// WithLocalNode sets the local node record updated with the
+// endpoint statements received in the pong messages
+func WithLocalNode(localNode *enode.LocalNode) BackendOption {
+	return func(b *Backend) {
+		b.localNode = localNode
+	}
+}
+
+// WithTable sets the kind of routing table
+func WithTable(kind TableKind) BackendOption {
+	return func(b *Backend) {
+		b.table = newRoutingTable(kind, b.local)
+	}
+}
+
+// WithNodeDB sets the database to store the nodes
+func WithNodeDB(db NodeDB) BackendOption {
+	return func(b *Backend) {
+		b.db = db
+	}
+}
+
+// WithTCPPort sets the tcp port of the node advertised in the pings
+func WithTCPPort(port uint16) BackendOption {
+	return func(b *Backend) {
+		b.local.TCP = port
+	}
+}
+
+// WithRespTimeout sets the time to wait for the response of a request
+func WithRespTimeout(d time.Duration) BackendOption {
+	return func(b *Backend) {
+		b.respTimeout = d
+	}
+}
+
 // NewBackend creates a new p2p discovery protocol
-func NewBackend(logger *log.Logger, key *ecdsa.PrivateKey, transport Transport) (*Backend, error) {
+func NewBackend(logger *log.Logger, key *ecdsa.PrivateKey, transport Transport, opts ...BackendOption) (*Backend, error) {
 	if logger == nil {
 		logger = log.New(ioutil.Discard, "", 0)
 	}
@@ -440,25 +662,36 @@ func NewBackend(logger *log.Logger, key *ecdsa.PrivateKey, transport Transport)
 		return nil, err
 	}
 
-	hashFn := sha3.NewLegacyKeccak256()
-
 	r := &Backend{
 		logger:     logger,
 		ID:         key,
 		addr:       addr,
-		handlers:   map[string]func(payload []byte, timestamp *time.Time){},
+		handlers:   map[string][]*replyHandler{},
 		respLock:   sync.Mutex{},
+		finding:    map[string]chan struct{}{},
 		validLock:  sync.Mutex{},
 		nodes:      map[string]*Peer{},
 		local:      localPeer,
-		table:      kademlia.NewRoutingTable(bucketSize, localPeer.ID, 1000*time.Second, hashFn),
+		table:      newRoutingTable(KademliaTable, localPeer),
 		shutdownCh: make(chan bool),
-		eventCh:    make(chan string, 10),
 		tasks:      make(chan *Peer, 100),
-		inlookup:   0,
 		transport:  transport,
+		unhandled:  newUnhandledTransport(transport),
+		limiter:    NewIPRateLimiter(packetRate, packetBurst),
+		db:         NewMemoryNodeDB(),
+
+		respTimeout: defaultRespTimeout,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.localNode != nil {
+		if err := r.localNode.Sign(); err != nil {
+			return nil, err
+		}
 	}
 
+	r.pool = NewPacketPool(numPacketWorkers, packetQueueSize, r.handlePoolPacket)
 	go r.listen()
 
 	// Start probe tasks
@@ -474,18 +707,76 @@ func (b *Backend) SetBootnodes(bootnodes []string) {
 	b.bootnodes = bootnodes
 }
 
+// SetNetRestrict restricts the communication to the nodes in the given
+// networks. Packets from other ips are dropped and those nodes are not added.
+func (b *Backend) SetNetRestrict(list Netlist) {
+	b.restrict.Store(list)
+}
+
+// allowedIP checks if the ip is in the networks the backend is restricted to
+func (b *Backend) allowedIP(ip net.IP) bool {
+	list, _ := b.restrict.Load().(Netlist)
+	return list == nil || list.Contains(ip)
+}
+
+// updateNodeDB updates the node entry of the peer in the database
+func (b *Backend) updateNodeDB(peer *Peer, update func(n *NodeEntry)) {
+	b.dbLock.Lock()
+	defer b.dbLock.Unlock()
+
+	n, ok := b.db.Node(peer.ID)
+	if !ok {
+		n = &NodeEntry{ID: peer.ID}
+	}
+	update(n)
+	if err := b.db.UpdateNode(n); err != nil {
+		b.logger.Printf("[ERROR] failed to update node db: id, %s, err, %v", peer.ID, err)
+	}
+}
+
+// seedFromNodeDB adds the nodes of the database that answered a ping recently
+// to the table. Nodes with an expired endpoint proof are probed again.
+func (b *Backend) seedFromNodeDB() {
+	now := time.Now()
+	for _, n := range b.db.QuerySeeds(seedCount, seedMaxAge) {
+		peer, err := newPeer(n.ID, &net.UDPAddr{IP: n.IP, Port: int(n.UDP)}, n.TCP)
+		if err != nil {
+			b.logger.Printf("[ERROR] invalid node in node db: id, %s, err, %v", n.ID, err)
+			continue
+		}
+		if n.LastPong.Add(bondExpiration).Before(now) {
+			b.sendTask(peer)
+			continue
+		}
+		last := n.LastPong
+		peer.Last = &last
+		b.updatePeer(peer)
+	}
+}
+
 func (b *Backend) listen() {
 	for {
 		select {
 		case packet := <-b.transport.PacketCh():
 			if b.packetCh != nil {
 				b.packetCh <- packet
-			} else {
-				go func() {
-					if err := b.HandlePacket(packet); err != nil {
-						b.logger.Printf("[TRACE] failed to handle packet: err, %v", err.Error())
-					}
-				}()
+				continue
+			}
+			if addr, ok := packet.From.(*net.UDPAddr); ok && !b.allowedIP(addr.IP) {
+				b.logger.Printf("[TRACE] packet from restricted network: addr, %s", addr)
+				continue
+			}
+			if !isV4Packet(packet.Buf) {
+				// the packet belongs to the protocol sharing the socket
+				b.unhandled.handle(packet)
+				continue
+			}
+			if addr, ok := packet.From.(*net.UDPAddr); ok && !b.limiter.Allow(addr.IP, packet.Timestamp) {
+				b.logger.Printf("[TRACE] packet rate limited: addr, %s", addr)
+				continue
+			}
+			if !b.pool.Dispatch(packet) {
+				b.logger.Printf("[TRACE] packet queue full, dropping packet: addr, %s", packet.From)
 			}
 		case <-b.shutdownCh:
 			return
@@ -493,6 +784,29 @@ func (b *Backend) listen() {
 	}
 }
 
+// Unhandled returns the transport for a protocol that shares the udp socket
+// with the backend (i.e. discv5). It receives the packets that are not discv4
+// packets. They are dropped if the transport is not read.
+func (b *Backend) Unhandled() *UnhandledTransport {
+	return b.unhandled
+}
+
+// isV4Packet checks the hash of the packet, the packets of
+// other protocols on the same socket do not match it
+func isV4Packet(buf []byte) bool {
+	if len(buf) < headSize+1 {
+		return false
+	}
+	return bytes.Equal(buf[:macSize], crypto.Keccak256(buf[macSize:]))
+}
+
+// handlePoolPacket handles the packets of the worker pool
+func (b *Backend) handlePoolPacket(packet *Packet) {
+	if err := b.HandlePacket(packet); err != nil {
+		b.logger.Printf("[TRACE] failed to handle packet: err, %v", err.Error())
+	}
+}
+
 func (b *Backend) sendTask(peer *Peer) {
 	select {
 	case b.tasks <- peer:
@@ -519,6 +833,8 @@ func (b *Backend) Schedule() {
 }
 
 func (b *Backend) loadBootnodes() {
+	b.seedFromNodeDB()
+
 	// load bootnodes
 	errr := make(chan error, len(b.bootnodes))
 
@@ -537,24 +853,40 @@ func (b *Backend) loadBootnodes() {
 	b.active = true
 
 	b.logger.Printf("[INFO] Finished probing bootnodes")
-	b.Lookup()
+	b.Lookup(context.Background())
 }
 
 // Close closes the discover
 func (b *Backend) Close() error {
+	if !atomic.CompareAndSwapInt32(&b.shutdown, 0, 1) {
+		return nil
+	}
 	close(b.shutdownCh)
+	b.pool.Close()
 	b.transport.Shutdown()
-	return nil
+	return b.db.Close()
 }
 
 func (b *Backend) schedule() {
 	revalidate := time.NewTicker(revalidateInterval)
 	lookup := time.NewTicker(lookupInterval)
+	cleanup := time.NewTicker(nodeDBCleanupInterval)
+	flush := time.NewTicker(nodeDBFlushInterval)
 
 	for {
 		select {
+		case <-cleanup.C:
+			if err := b.db.Expire(nodeDBExpiration); err != nil {
+				b.logger.Printf("[ERROR] failed to expire nodes: err, %v", err)
+			}
+
+		case <-flush.C:
+			if err := b.db.Flush(); err != nil {
+				b.logger.Printf("[ERROR] failed to flush node db: err, %v", err)
+			}
+
 		case <-lookup.C:
-			go b.LookupRandom()
+			go b.LookupRandom(context.Background())
 
 		case <-revalidate.C:
 			go b.revalidatePeer()
@@ -566,19 +898,31 @@ func (b *Backend) schedule() {
 }
 
 func (b *Backend) revalidatePeer() {
-	var id string
-	for _, i := range rand.Perm(len(b.table.Buckets)) {
-		if bucket := b.table.Buckets[i]; bucket.Len() != 0 {
-			id = bucket.Peers()[bucket.Len()-1]
-			break
-		}
+	id, ok := b.table.leastRecent()
+	if !ok {
+		return
 	}
 
 	peer, ok := b.getPeer(id)
 	if !ok {
 		// log, failed to get peer, weird
+		return
+	}
+	if b.probeNode(peer) {
+		return
+	}
+
+	// the least recently seen peer is not alive, replace it with
+	// the most recently seen peer in the replacement list
+	b.validLock.Lock()
+	replacement, ok := b.table.replace(id)
+	delete(b.nodes, id)
+	b.validLock.Unlock()
+
+	if ok {
+		b.logger.Printf("[DEBUG] peer replaced: id, %s, replacement, %s", id, replacement)
 	} else {
-		b.probeNode(peer)
+		b.logger.Printf("[DEBUG] peer removed: id, %s", id)
 	}
 }
 
@@ -587,10 +931,8 @@ func (b *Backend) NearestPeers() ([]*Peer, error) {
 }
 
 func (b *Backend) NearestPeersFromTarget(target []byte) ([]*Peer, error) {
-	key := EncodeToHex(target)
-
 	peers := []*Peer{}
-	for _, p := range b.table.NearestPeers(key, bucketSize) {
+	for _, p := range b.table.nearest(target, bucketSize) {
 		peer, ok := b.getPeer(p)
 		if !ok {
 			return nil, fmt.Errorf("peer %s not found", p)
@@ -600,119 +942,54 @@ func (b *Backend) NearestPeersFromTarget(target []byte) ([]*Peer, error) {
 	return peers, nil
 }
 
-func min(i, j int) int {
-	if i < j {
-		return i
-	}
-	return j
-}
-
 // LookupRandom performs a lookup in a random target
-// TODO, remove peers from lookup response, nobody uses it
-func (b *Backend) LookupRandom() ([]*Peer, error) {
-	var t [64]byte
-	crand.Read(t[:])
+func (b *Backend) LookupRandom(ctx context.Context) ([]*Peer, error) {
+	var target [64]byte
+	crand.Read(target[:])
 
-	target := []byte{}
-	for _, i := range t {
-		target = append(target, i)
-	}
+	return b.LookupTarget(ctx, target[:])
+}
 
-	return b.LookupTarget(target)
+// RandomNodes implements the discovery interface
+func (b *Backend) RandomNodes() Iterator {
+	return NewLookupIterator(func(ctx context.Context) []*enode.Node {
+		peers, err := b.LookupRandom(ctx)
+		if err == context.Canceled {
+			return nil
+		}
+		if err != nil {
+			b.logger.Printf("[ERROR] failed to lookup random target: err, %v", err)
+			return nil
+		}
+		nodes := make([]*enode.Node, 0, len(peers))
+		for _, p := range peers {
+			if n, err := p.toNode(); err == nil {
+				nodes = append(nodes, n)
+			}
+		}
+		return nodes
+	})
 }
 
 // Lookup does a kademlia lookup with the local key as target
-func (b *Backend) Lookup() ([]*Peer, error) {
-	return b.LookupTarget(b.local.Bytes)
+func (b *Backend) Lookup(ctx context.Context) ([]*Peer, error) {
+	return b.LookupTarget(ctx, b.local.Bytes)
 }
 
-// LookupTarget does a kademlia lookup around target
-func (b *Backend) LookupTarget(target []byte) ([]*Peer, error) {
-	// Only allow one lookup at a time
-	if atomic.LoadInt32(&(b.inlookup)) == 1 {
-		return nil, nil
-	}
-
-	defer func() {
-		atomic.StoreInt32(&b.inlookup, 0)
-	}()
-
+// LookupTarget does a kademlia lookup around target and returns the closest
+// nodes found sorted by distance. Multiple lookups can run at the same time.
+func (b *Backend) LookupTarget(ctx context.Context, target []byte) ([]*Peer, error) {
 	if !b.active {
 		return []*Peer{}, nil
 	}
-
-	visited := map[string]bool{}
-
-	// initialize the queue
-	queue, err := b.NearestPeersFromTarget(target)
-	if err != nil {
-		return nil, err
-	}
-
-	reply := make(chan []*Peer)
-
-	var peer *Peer
-
-	pending := 0
-
-	findNodes := func(p *Peer) {
-		pending++
-		go func() {
-			nodes, err := b.findNodes(p, target)
-			if err != nil {
-				// log
-			}
-			reply <- nodes
-		}()
-	}
-
-	// seed up to maxPending nodes
-	for i := 0; i < min(len(queue), alpha); i++ {
-		peer, queue = queue[0], queue[1:]
-		findNodes(peer)
-	}
-
-	for pending > 0 {
-
-		var nodes []*Peer
-		select {
-		case nodes = <-reply:
-		case <-b.shutdownCh:
-			return nil, nil
-		}
-
-		pending--
-
-		v := 0
-		for _, p := range nodes {
-			if _, ok := visited[p.ID]; !ok {
-				visited[p.ID] = true
-				queue = append(queue, p)
-				v++
-			}
-		}
-
-		for pending < alpha && len(queue) != 0 {
-			peer, queue = queue[0], queue[1:]
-			findNodes(peer)
-		}
-	}
-
-	discovered := []*Peer{}
-	for id := range visited {
-		p, ok := b.getPeer(id)
-		if !ok {
-			return nil, fmt.Errorf("")
-		}
-
-		discovered = append(discovered, p)
-	}
-
-	return discovered, nil
+	return newLookup(b, target).run(ctx)
 }
 
 // GetPeers return the peers
 func (b *Backend) GetPeers() []*Peer {
+	b.validLock.Lock()
+	defer b.validLock.Unlock()
+
 	peers := []*Peer{}
 	for _, peer := range b.nodes {
 		peers = append(peers, peer)
@@ -759,6 +1036,9 @@ func decodePeerFromPacket(packet *Packet) (*Peer, error) {
 
 // HandlePacket handles an incoming udp packet
 func (b *Backend) HandlePacket(packet *Packet) error {
+	if len(packet.Buf) > maxPacketSize {
+		return fmt.Errorf("packet too large: %d", len(packet.Buf))
+	}
 	mac, sigdata, pubkey, err := decodePacket(packet.Buf)
 	if err != nil {
 		return err
@@ -773,13 +1053,12 @@ func (b *Backend) HandlePacket(packet *Packet) error {
 	if err != nil {
 		return err
 	}
+	peer.TCP = b.knownTCP(peer.ID)
 	peer.Last = &packet.Timestamp
 
 	msgcode, payload := sigdata[0], sigdata[1:]
 
-	if callback, ok := b.getCallback(peer.ID, msgcode); ok {
-		callback(payload, &packet.Timestamp)
-
+	if b.deliver(peer.ID, msgcode, payload, &packet.Timestamp) {
 		// We can also create callbacks for pingPackets that work as notifications
 		// but we still have to send the pong
 		if msgcode != pingPacket {
@@ -792,6 +1071,10 @@ func (b *Backend) HandlePacket(packet *Packet) error {
 		return b.handlePingPacket(payload, mac, peer)
 	case findnodePacket:
 		return b.handleFindNodePacket(payload, peer)
+	case enrRequestPacket:
+		return b.handleENRRequestPacket(payload, mac, peer)
+	case enrResponsePacket:
+		return fmt.Errorf("enrResponsePacket not expected")
 	case neighborsPacket:
 		return fmt.Errorf("neighborsPacket not expected")
 	case pongPacket:
@@ -801,81 +1084,131 @@ func (b *Backend) HandlePacket(packet *Packet) error {
 	}
 }
 
-func (b *Backend) getCallback(id string, code byte) (func([]byte, *time.Time), bool) {
-	key := fmt.Sprintf("%s_%v", id, code)
+// deliver delivers the packet to the handlers waiting for it. A ping is a
+// notification for all of them and a pong or an enr response is checked by each
+// of them against the hash of its request. Any other packet is the response to
+// the oldest request with room for it.
+func (b *Backend) deliver(id string, code byte, payload []byte, timestamp *time.Time) bool {
+	key := handlerKey(id, code)
+
 	b.respLock.Lock()
-	c, ok := b.handlers[key]
-	b.respLock.Unlock()
-	return c, ok
-}
+	defer b.respLock.Unlock()
 
-func (b *Backend) handlePingPacket(payload []byte, mac []byte, peer *Peer) error {
-	/*
-		var req pingRequest
-		if err := rlp.DecodeBytes(payload, &req); err != nil {
-			panic(err)
+	handlers, ok := b.handlers[key]
+	if !ok {
+		return false
+	}
+	for _, h := range handlers {
+		select {
+		case h.ackCh <- respMessage{true, payload, timestamp}:
+			if code != pingPacket && code != pongPacket && code != enrResponsePacket {
+				return true
+			}
+		default:
 		}
-	*/
+	}
+	return true
+}
 
+func (b *Backend) handlePingPacket(payload []byte, mac []byte, peer *Peer) error {
 	var req pingRequest
 	p := &fastrlp.Parser{}
 	v, err := p.Parse(payload)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("ping: %v", err)
 	}
 	if err := req.UnmarshalRLP(v); err != nil {
-		panic(err)
+		return fmt.Errorf("ping: %v", err)
 	}
-
-	/*
-		if !reflect.DeepEqual(req, req2) {
-			fmt.Println("__ BAD RLP ENCODING __")
-			fmt.Println(payload)
-			fmt.Println(req)
-			fmt.Println(req2)
-			panic("Xa")
-		}
-	*/
-
 	if hasExpired(req.Expiration) {
 		return fmt.Errorf("ping: Message has expired")
 	}
 
+	// the udp endpoint is the source of the packet but the
+	// tcp port of the peer is only known from its ping
+	if req.From.TCP != 0 {
+		peer.TCP = req.From.TCP
+	}
+
 	reply := &pongResponse{
 		To:         peer.toRPCEndpoint(),
 		ReplyTok:   mac,
 		Expiration: uint64(time.Now().Add(20 * time.Second).Unix()),
+		ENRSeq:     b.localSeq(),
 	}
 
 	b.sendPacket(peer, pongPacket, reply)
 
+	b.updateNodeDB(peer, func(n *NodeEntry) {
+		if !n.IP.Equal(peer.UDPAddr.IP) {
+			// the endpoint proof was for another address
+			n.LastPong = time.Time{}
+		}
+		n.IP = peer.UDPAddr.IP
+		n.UDP = uint16(peer.UDPAddr.Port)
+		if peer.TCP != 0 {
+			n.TCP = peer.TCP
+		}
+		n.LastPing = *peer.Last
+	})
+
 	// received a ping, probe back it it has expired
 	if b.hasExpired(peer) {
 		b.sendTask(peer)
 	} else {
 		b.updatePeer(peer)
+		b.checkRecordSeq(peer, req.ENRSeq)
 	}
 
 	return nil
 }
 
-func (b *Backend) hasExpired(p *Peer) bool {
-	b.validLock.Lock()
-	defer b.validLock.Unlock()
+func (b *Backend) handleENRRequestPacket(payload []byte, mac []byte, peer *Peer) error {
+	if b.localNode == nil {
+		return nil
+	}
+	// only reply to nodes with a valid endpoint proof
+	if b.hasExpired(peer) {
+		return nil
+	}
 
-	// If we check hasExpired if the node has not been probed yet
-	// i.e. first findNodes query
-	if p.Last == nil {
-		return true
+	var req enrRequest
+	p := &fastrlp.Parser{}
+	v, err := p.Parse(payload)
+	if err != nil {
+		return err
+	}
+	if err := req.UnmarshalRLP(v); err != nil {
+		return err
+	}
+	if hasExpired(req.Expiration) {
+		return fmt.Errorf("enrRequest: Message has expired")
 	}
 
-	receivedTime := p.Last
-	p, ok := b.nodes[p.ID]
-	if !ok {
+	return b.sendPacket(peer, enrResponsePacket, &enrResponse{
+		ReplyTok: mac,
+		Record:   b.localNode.Record(),
+	})
+}
+
+// hasExpired returns true if the endpoint proof of the peer has expired, that is,
+// we have not received a pong from its current ip in the bond expiration period
+func (b *Backend) hasExpired(p *Peer) bool {
+	n, ok := b.db.Node(p.ID)
+	if !ok || n.LastPong.IsZero() || !n.IP.Equal(p.UDPAddr.IP) {
 		return true
 	}
+	return time.Since(n.LastPong) > bondExpiration
+}
 
-	return p.hasExpired(*receivedTime, bondExpiration)
+// isBonded returns true if the peer has our endpoint proof, that is, we
+// have received a ping from the peer (and replied) in the bond expiration period
+func (b *Backend) isBonded(p *Peer) bool {
+	n, ok := b.db.Node(p.ID)
+	if !ok || n.LastPing.IsZero() {
+		return false
+	}
+	return time.Since(n.LastPing) <= bondExpiration
 }
 
 func (b *Backend) handleFindNodePacket(payload []byte, peer *Peer) error {
@@ -883,51 +1216,68 @@ func (b *Backend) handleFindNodePacket(payload []byte, peer *Peer) error {
 		return nil
 	}
 
-	/*
-		var req2 findNodeRequest
-		if err := rlp.DecodeBytes(payload, &req); err != nil {
-			return err
-		}
-	*/
-
 	var req findNodeRequest
 	p := &fastrlp.Parser{}
 	v, err := p.Parse(payload)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("findnode: %v", err)
 	}
 	if err := req.UnmarshalRLP(v); err != nil {
-		panic(err)
+		return fmt.Errorf("findnode: %v", err)
+	}
+	if hasExpired(req.Expiration) {
+		return fmt.Errorf("findnode: Message has expired")
 	}
-	/*
-		if !reflect.DeepEqual(req, req2) {
-			panic("panic: findNodeRequest")
-		}
-	*/
 
 	peers, err := b.NearestPeersFromTarget(req.Target)
 	if err != nil {
 		return err
 	}
 
-	// NOTE: number of peers on each requests is fixed to 'maxNeighbors'
-	for i := 0; i < len(peers); i += maxNeighbors {
-		nodes := []rpcNode{}
-		for _, p := range peers[i:min(i+maxNeighbors, len(peers))] {
-			nodes = append(nodes, p.toRPCNode())
-		}
+	nodes := make([]rpcNode, 0, len(peers))
+	for _, p := range peers {
+		nodes = append(nodes, p.toRPCNode())
+	}
+	expiration := uint64(time.Now().Add(20 * time.Second).Unix())
 
+	for _, chunk := range splitNeighbors(nodes, expiration) {
 		err := b.sendPacket(peer, neighborsPacket, &neighborsResponse{
-			Nodes: nodes,
+			Nodes:      chunk,
+			Expiration: expiration,
 		})
 		if err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
+// splitNeighbors splits the nodes in as few neighbors packets as possible
+// such that each packet fits in maxPacketSize
+func splitNeighbors(nodes []rpcNode, expiration uint64) [][]rpcNode {
+	chunks := [][]rpcNode{}
+
+	var chunk []rpcNode
+	for _, n := range nodes {
+		next := append(chunk[:len(chunk):len(chunk)], n)
+		if len(chunk) != 0 && neighborsPacketSize(next, expiration) > maxPacketSize {
+			chunks = append(chunks, chunk)
+			next = []rpcNode{n}
+		}
+		chunk = next
+	}
+	if len(chunk) != 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// neighborsPacketSize returns the size of the neighbors packet with the nodes
+func neighborsPacketSize(nodes []rpcNode, expiration uint64) int {
+	msg := &neighborsResponse{Nodes: nodes, Expiration: expiration}
+	return headSize + 1 + len(msg.MarshalRLP(nil))
+}
+
 func hasExpired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
@@ -950,40 +1300,281 @@ func (b *Backend) AddNode(nodeStr string) error {
 		return err
 	}
 
+	// skip the bonding if the endpoint proof is still valid
+	if !b.hasExpired(peer) {
+		b.updatePeer(peer)
+		return nil
+	}
+
 	b.probeNode(peer)
 	return nil
 }
 
+// localEndpoint returns our endpoint with the same ip family as the
+// given address if the transport listens on multiple addresses
+func (b *Backend) localEndpoint(to *net.UDPAddr) rpcEndpoint {
+	endpoint := b.local.toRPCEndpoint()
+
+	multi, ok := b.transport.(interface{ Addrs() []*net.UDPAddr })
+	if !ok || to == nil {
+		return endpoint
+	}
+	isIPv4 := to.IP.To4() != nil
+	for _, addr := range multi.Addrs() {
+		if (addr.IP.To4() != nil) == isIPv4 {
+			endpoint.IP = addr.IP
+			endpoint.UDP = uint16(addr.Port)
+			break
+		}
+	}
+	return endpoint
+}
+
 func (b *Backend) probeNode(peer *Peer) bool {
 	// Send ping packet
-	ack := make(chan respMessage)
-	b.setHandler(peer.ID, pongPacket, ack, respTimeout)
+	ack := make(chan respMessage, 1)
+	cancel := b.setHandler(peer.ID, pongPacket, ack, b.respTimeout)
+	defer cancel()
 
-	b.sendPacket(peer, pingPacket, &pingRequest{
+	hash, err := b.sendPacketWithHash(peer, pingPacket, &pingRequest{
 		Version:    4,
-		From:       b.local.toRPCEndpoint(),
+		From:       b.localEndpoint(peer.UDPAddr),
 		To:         peer.toRPCEndpoint(),
 		Expiration: uint64(time.Now().Add(10 * time.Second).Unix()),
+		ENRSeq:     b.localSeq(),
 	})
+	if err != nil {
+		return false
+	}
 
-	resp := <-ack
+	var (
+		resp respMessage
+		pong pongResponse
+	)
+	for {
+		resp = <-ack
+		if !resp.Complete {
+			return false
+		}
 
-	if resp.Complete {
-		peer.Last = resp.Timestamp
-		b.updatePeer(peer)
+		p := &fastrlp.Parser{}
+		v, err := p.Parse(resp.Payload)
+		if err == nil {
+			err = pong.UnmarshalRLP(v)
+		}
+		if err == nil && hasExpired(pong.Expiration) {
+			err = fmt.Errorf("pong: Message has expired")
+		}
+		if err != nil {
+			b.logger.Printf("[TRACE] invalid pong packet: id, %s, err, %v", peer.ID, err)
+			return false
+		}
+		// the pong might answer another ping sent to the node
+		if bytes.Equal(pong.ReplyTok, hash) {
+			break
+		}
+	}
 
-		select {
-		case b.eventCh <- peer.Enode():
-		default:
+	peer.Last = resp.Timestamp
+	b.updatePeer(peer)
+
+	b.updateNodeDB(peer, func(n *NodeEntry) {
+		n.IP = peer.UDPAddr.IP
+		n.UDP = uint16(peer.UDPAddr.Port)
+		n.TCP = peer.TCP
+		n.LastPong = *resp.Timestamp
+	})
+
+	if b.localNode != nil {
+		// the pong includes our endpoint as seen by the peer
+		b.localNode.UDPEndpointStatement(peer.UDPAddr, &net.UDPAddr{IP: pong.To.IP, Port: int(pong.To.UDP)})
+	}
+	b.checkRecordSeq(peer, pong.ENRSeq)
+	return true
+}
+
+// localSeq returns the sequence number of the local node record, if any
+func (b *Backend) localSeq() uint64 {
+	if b.localNode == nil {
+		return 0
+	}
+	return b.localNode.Seq()
+}
+
+// checkRecordSeq requests the node record of the peer if the sequence
+// number advertised in a ping or pong is newer than the one we hold
+func (b *Backend) checkRecordSeq(peer *Peer, seq uint64) {
+	if seq == 0 {
+		return
+	}
+
+	b.validLock.Lock()
+	var current uint64
+	if p, ok := b.nodes[peer.ID]; ok && p.Record != nil {
+		current = p.Record.Seq()
+	}
+	b.validLock.Unlock()
+
+	if seq <= current {
+		return
+	}
+	go func() {
+		// the sequence number comes in a ping or a pong, if the node does not have
+		// an endpoint proof of us yet it is pinging us back and sends the seq again
+		if _, err := b.requestENR(peer); err != nil {
+			b.logger.Printf("[TRACE] failed to request enr: id, %s, err, %v", peer.ID, err)
+		}
+	}()
+}
+
+// RequestNodeRecord requests the node record of a discovered node
+func (b *Backend) RequestNodeRecord(n *enode.Node) (*enr.Record, error) {
+	peer, ok := b.getPeer(n.ID().String())
+	if !ok {
+		var err error
+		peer, err = newPeer(n.ID().String(), &net.UDPAddr{IP: n.IP(), Port: int(n.UDP())}, n.TCP())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.RequestENR(peer)
+}
+
+// Resolve returns the current endpoint of the node. It pings the last known
+// endpoint of the node and, if it does not answer, it looks up the node id in
+// the network. The endpoint of the node record with the highest sequence
+// number is preferred over the endpoint reported by other nodes.
+func (b *Backend) Resolve(id enode.ID) (*enode.Enode, error) {
+	known, ok := b.getPeer(id.String())
+	if !ok {
+		if n, ok := b.db.Node(id.String()); ok && n.IP != nil {
+			known, _ = newPeer(n.ID, &net.UDPAddr{IP: n.IP, Port: int(n.UDP)}, n.TCP)
+			if known != nil && n.Record != "" {
+				known.Record, _ = enr.Unmarshal(n.Record)
+			}
+		}
+	}
+	if known != nil {
+		if b.probeNode(known) {
+			return known.toEnode(), nil
 		}
-		return true
 	}
 
-	return false
+	var peers []*Peer
+	if b.active {
+		l := newLookup(b, id[:])
+		if known != nil {
+			// the known endpoint does not answer, skip it so that the
+			// lookup returns the endpoint known by the other nodes
+			l.skip = func(p *Peer) bool {
+				return p.ID == known.ID && p.UDPAddr.IP.Equal(known.UDPAddr.IP) && p.UDPAddr.Port == known.UDPAddr.Port
+			}
+		}
+		var err error
+		if peers, err = l.run(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		res *enode.Enode
+		seq uint64
+	)
+	for _, p := range peers {
+		if p.ID != id.String() {
+			continue
+		}
+		res = p.toEnode()
+		if record, err := b.RequestENR(p); err == nil {
+			if e, err := enode.SelectEnode(record, false); err == nil {
+				res, seq = e, record.Seq()
+			}
+		}
+		break
+	}
+
+	// the record we know might be newer than the one of the node found,
+	// unless it advertises the endpoint that did not answer
+	if known != nil && known.Record != nil && (res == nil || known.Record.Seq() > seq) {
+		e, err := enode.SelectEnode(known.Record, false)
+		if err == nil && e.ID == id && (!e.IP.Equal(known.UDPAddr.IP) || int(e.UDP) != known.UDPAddr.Port) {
+			res = e
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("node %s not found", id)
+	}
+	return res, nil
 }
 
-func (b *Backend) Deliver() chan string {
-	return b.eventCh
+// RequestENR requests the node record of the peer (EIP-868). The record
+// is stored with the peer and can be used to filter peers before dialing them.
+func (b *Backend) RequestENR(peer *Peer) (*enr.Record, error) {
+	// the node only answers if it has a valid endpoint proof of us
+	if err := b.ensureBond(peer); err != nil {
+		return nil, err
+	}
+	return b.requestENR(peer)
+}
+
+func (b *Backend) requestENR(peer *Peer) (*enr.Record, error) {
+	ack := make(chan respMessage, 1)
+	cancel := b.setHandler(peer.ID, enrResponsePacket, ack, b.respTimeout)
+	defer cancel()
+
+	hash, err := b.sendPacketWithHash(peer, enrRequestPacket, &enrRequest{
+		Expiration: uint64(time.Now().Add(20 * time.Second).Unix()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res enrResponse
+	for {
+		resp := <-ack
+		if !resp.Complete {
+			return nil, fmt.Errorf("enr request timeout")
+		}
+
+		p := &fastrlp.Parser{}
+		v, err := p.Parse(resp.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := res.UnmarshalRLP(v); err != nil {
+			return nil, err
+		}
+		// the response might answer another request sent to the node
+		if bytes.Equal(res.ReplyTok, hash) {
+			break
+		}
+	}
+
+	// the record must be signed by the peer
+	if err := res.Record.VerifySignature(); err != nil {
+		return nil, err
+	}
+	pub, err := res.Record.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:], peer.Bytes) {
+		return nil, fmt.Errorf("enr record does not belong to the peer")
+	}
+
+	b.validLock.Lock()
+	if old, ok := b.nodes[peer.ID]; ok {
+		// the peer might be in use, update a copy
+		p := *old
+		p.Record = res.Record
+		b.nodes[peer.ID] = &p
+	}
+	b.validLock.Unlock()
+
+	b.updateNodeDB(peer, func(n *NodeEntry) {
+		n.Record = res.Record.Marshal()
+	})
+	return res.Record, nil
 }
 
 func (b *Backend) getPeer(id string) (*Peer, bool) {
@@ -994,124 +1585,146 @@ func (b *Backend) getPeer(id string) (*Peer, bool) {
 	return p, ok
 }
 
+// knownTCP returns the last known tcp port of the node, if any
+func (b *Backend) knownTCP(id string) uint16 {
+	if p, ok := b.getPeer(id); ok && p.TCP != 0 {
+		return p.TCP
+	}
+	if n, ok := b.db.Node(id); ok {
+		return n.TCP
+	}
+	return 0
+}
+
 func (b *Backend) updatePeer(peer *Peer) {
 	b.validLock.Lock()
 	defer b.validLock.Unlock()
 
-	b.table.Update(peer.ID)
+	b.table.update(peer)
 
-	if p, ok := b.nodes[peer.ID]; ok {
-		p.TCP = peer.TCP
+	if old, ok := b.nodes[peer.ID]; ok {
+		// the peer might be in use, update a copy
+		p := *old
+		if peer.TCP != 0 {
+			p.TCP = peer.TCP
+		}
+		if p.UDPAddr.IP.Equal(peer.UDPAddr.IP) {
+			// the node might have changed the udp port
+			p.UDPAddr = peer.UDPAddr
+		}
 
 		// if already in, update the timestamp
 		// only update if there is a timestamp
 		if peer.Last != nil {
 			p.Last = peer.Last
 		}
+		b.nodes[peer.ID] = &p
 	} else {
 		b.nodes[peer.ID] = peer
 	}
 }
 
-func (b *Backend) findNodes(peer *Peer, target []byte) ([]*Peer, error) {
-	if b.hasExpired(peer) {
-		// The connect has expired with the node, lets probe again.
-		if !b.probeNode(peer) {
-			return nil, fmt.Errorf("failed to probe node")
-		}
+// removePeer removes the peer from the table
+func (b *Backend) removePeer(peer *Peer) {
+	b.validLock.Lock()
+	defer b.validLock.Unlock()
 
-		// wait for a ping from the peer to ensure we are alive on his side
-		ack := make(chan respMessage)
-		b.setHandler(peer.ID, pingPacket, ack, respTimeout)
+	b.table.remove(peer.ID)
+	delete(b.nodes, peer.ID)
+}
 
-		if resp := <-ack; !resp.Complete {
-			return nil, fmt.Errorf("We have not received probe back from other peer")
+// lockFindNodes serializes the findnode requests to the peer since the
+// neighbors responses do not reference the request they answer
+func (b *Backend) lockFindNodes(id string) func() {
+	for {
+		b.findLock.Lock()
+		doneCh, ok := b.finding[id]
+		if !ok {
+			doneCh = make(chan struct{})
+			b.finding[id] = doneCh
+			b.findLock.Unlock()
+
+			return func() {
+				b.findLock.Lock()
+				delete(b.finding, id)
+				b.findLock.Unlock()
+				close(doneCh)
+			}
 		}
+		b.findLock.Unlock()
+		<-doneCh
+	}
+}
 
-		// sleep a couple of milliseconds to send the other package first
-		time.Sleep(100 * time.Millisecond)
+func (b *Backend) findNodes(peer *Peer, target []byte) ([]*Peer, error) {
+	unlock := b.lockFindNodes(peer.ID)
+	defer unlock()
+
+	if err := b.ensureBond(peer); err != nil {
+		b.findnodeFailed(peer)
+		return nil, err
 	}
 
-	ack := make(chan respMessage)
-	b.setHandler(peer.ID, neighborsPacket, ack, respTimeout)
+	// the nodes of the response are split in multiple packets that
+	// have to arrive before the handler expires
+	ack := make(chan respMessage, bucketSize)
+	cancel := b.setHandler(peer.ID, neighborsPacket, ack, b.respTimeout)
+	defer cancel()
 
 	b.sendPacket(peer, findnodePacket, &findNodeRequest{
-		Target:     b.local.Bytes,
+		Target:     target,
 		Expiration: uint64(time.Now().Add(20 * time.Second).Unix()),
 	})
 
 	peers := []*Peer{}
 	atLeastOne := false
 
-	for {
-		resp := <-ack
-		if resp.Complete {
-			atLeastOne = true
+	// number of nodes received, including the invalid ones
+	received := 0
 
-			/*
-				var req2 neighborsResponse
-				if err := rlp.DecodeBytes(resp.Payload, &neighbors); err != nil {
-					panic(err)
-				}
-			*/
+	for received < bucketSize {
+		resp := <-ack
+		if !resp.Complete {
+			// the request has expired
+			break
+		}
+		neighbors, err := decodeNeighbors(resp.Payload)
+		if err != nil {
+			// ignore the packet and wait for the next one
+			b.logger.Printf("[TRACE] invalid neighbors packet: id, %s, err, %v", peer.ID, err)
+			continue
+		}
+		if received+len(neighbors.Nodes) > bucketSize {
+			b.logger.Printf("[TRACE] too many nodes in neighbors: id, %s, nodes, %d", peer.ID, received+len(neighbors.Nodes))
+			break
+		}
+		received += len(neighbors.Nodes)
+		atLeastOne = true
 
-			var neighbors neighborsResponse
-			p := &fastrlp.Parser{}
-			v, err := p.Parse(resp.Payload)
-			if err != nil {
-				panic(err)
-			}
-			if err := neighbors.UnmarshalRLP(v); err != nil {
-				panic(err)
+		for _, n := range neighbors.Nodes {
+			if err := validateEndpoint(peer.UDPAddr.IP, n.IP, n.UDP); err != nil {
+				b.logger.Printf("[TRACE] invalid node in neighbors: id, %s, err, %v", peer.ID, err)
+				continue
 			}
-
-			/*
-				if !reflect.DeepEqual(neighbors, req2) {
-
-					fmt.Println("-- payload --")
-					fmt.Println(resp.Payload)
-
-					fmt.Println("-- expected --")
-					fmt.Println(neighbors)
-					fmt.Println(neighbors.Nodes)
-					fmt.Println(neighbors.Expiration)
-
-					fmt.Println("-- found --")
-					fmt.Println(req2)
-					fmt.Println(req2.Nodes)
-					fmt.Println(req2.Expiration)
-
-					fmt.Println(reflect.DeepEqual(neighbors.Nodes, req2.Nodes))
-					fmt.Println(reflect.DeepEqual(neighbors.Expiration, req2.Expiration))
-
-					if len(neighbors.Nodes) == len(req2.Nodes) && len(req2.Nodes) == 0 {
-						//
-					} else {
-						panic("panic: neighborsResponse")
-					}
-				}
-			*/
-
-			for _, n := range neighbors.Nodes {
-				p, err := n.toPeer()
-				if err != nil {
-					return nil, err
-				}
-				peers = append(peers, p)
+			if !b.allowedIP(n.IP) {
+				continue
 			}
-
-			if len(peers) == bucketSize {
-				break
+			p, err := n.toPeer()
+			if err != nil {
+				continue
 			}
-		} else {
-			break
+			peers = append(peers, p)
 		}
 	}
 
 	// not even one response
 	if !atLeastOne {
+		b.findnodeFailed(peer)
 		return nil, fmt.Errorf("failed to get peers")
 	}
+	b.updateNodeDB(peer, func(n *NodeEntry) {
+		n.FindFails = 0
+	})
 
 	for _, p := range peers {
 		b.sendTask(p)
@@ -1120,49 +1733,171 @@ func (b *Backend) findNodes(peer *Peer, target []byte) ([]*Peer, error) {
 	return peers, nil
 }
 
+// ensureBond makes sure that the node has a valid endpoint proof of us
+// before sending it a request, since it does not answer otherwise. If we
+// have not received a ping from the node recently, we ping it and wait
+// briefly for its ping back. The node does not ping back if it still holds
+// a valid pong from us, so the request is sent even if the ping never arrives.
+func (b *Backend) ensureBond(peer *Peer) error {
+	if b.isBonded(peer) {
+		return nil
+	}
+
+	// the handler is set before the probe since the
+	// ping might arrive right after the pong
+	ack := make(chan respMessage, 1)
+	cancel := b.setHandler(peer.ID, pingPacket, ack, b.respTimeout)
+	defer cancel()
+
+	if !b.probeNode(peer) {
+		return fmt.Errorf("failed to probe node")
+	}
+
+	select {
+	case resp := <-ack:
+		if resp.Complete {
+			// give the node some time to handle our pong before the request
+			time.Sleep(100 * time.Millisecond)
+		}
+	case <-time.After(bondWaitTimeout):
+	}
+	return nil
+}
+
+// findnodeFailed records a findnode request without response and removes
+// the node from the table after too many consecutive failures
+func (b *Backend) findnodeFailed(peer *Peer) {
+	var fails int
+	b.updateNodeDB(peer, func(n *NodeEntry) {
+		n.FindFails++
+		fails = n.FindFails
+	})
+	if fails >= maxFindnodeFailures {
+		b.logger.Printf("[DEBUG] too many findnode failures, removing node: id, %s, fails, %d", peer.ID, fails)
+		b.removePeer(peer)
+	}
+}
+
+// validateEndpoint checks the endpoint of a node reported by the sender. A node
+// in a public network cannot report nodes in a private network or in the loopback.
+func validateEndpoint(sender net.IP, ip net.IP, port uint16) error {
+	if ip == nil || ip.IsUnspecified() {
+		return fmt.Errorf("unspecified ip")
+	}
+	if ip.IsMulticast() {
+		return fmt.Errorf("multicast ip %s", ip)
+	}
+	if port == 0 {
+		return fmt.Errorf("udp port not set")
+	}
+	if ip.IsLoopback() && !sender.IsLoopback() {
+		return fmt.Errorf("loopback ip %s from %s", ip, sender)
+	}
+	if isLAN(ip) && !isLAN(sender) && !sender.IsLoopback() {
+		return fmt.Errorf("private ip %s from %s", ip, sender)
+	}
+	return nil
+}
+
+// isLAN returns true if the ip is in a private network
+func isLAN(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+// decodeNeighbors decodes a neighbors packet
+func decodeNeighbors(payload []byte) (*neighborsResponse, error) {
+	var neighbors neighborsResponse
+	p := &fastrlp.Parser{}
+	v, err := p.Parse(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := neighbors.UnmarshalRLP(v); err != nil {
+		return nil, err
+	}
+	if hasExpired(neighbors.Expiration) {
+		return nil, fmt.Errorf("neighbors: Message has expired")
+	}
+	return &neighbors, nil
+}
+
 type respMessage struct {
 	Complete  bool
 	Payload   []byte
 	Timestamp *time.Time
 }
 
-func (b *Backend) setHandler(id string, code byte, ackCh chan respMessage, expiration time.Duration) {
-	key := fmt.Sprintf("%s_%v", id, code)
+// replyHandler waits for the responses of a request to a peer
+type replyHandler struct {
+	ackCh chan respMessage
+	timer *time.Timer
+}
 
-	callback := func(payload []byte, timestamp *time.Time) {
-		select {
-		case ackCh <- respMessage{true, payload, timestamp}:
-		default:
-		}
-	}
+func handlerKey(id string, code byte) string {
+	return fmt.Sprintf("%s_%v", id, code)
+}
 
-	b.respLock.Lock()
-	b.handlers[key] = callback
-	b.respLock.Unlock()
+// setHandler registers a handler for the packets with the given code from the
+// peer. The ack channel is closed if the handler expires. It returns a function
+// to remove the handler once the request is done.
+func (b *Backend) setHandler(id string, code byte, ackCh chan respMessage, expiration time.Duration) func() {
+	key := handlerKey(id, code)
+	h := &replyHandler{ackCh: ackCh}
 
-	b.timer = time.AfterFunc(expiration, func() {
+	remove := func() bool {
 		b.respLock.Lock()
-		delete(b.handlers, key)
-		b.respLock.Unlock()
+		defer b.respLock.Unlock()
+
+		handlers := b.handlers[key]
+		for i, hh := range handlers {
+			if hh == h {
+				handlers = append(handlers[:i:i], handlers[i+1:]...)
+				if len(handlers) == 0 {
+					delete(b.handlers, key)
+				} else {
+					b.handlers[key] = handlers
+				}
+				return true
+			}
+		}
+		return false
+	}
 
-		select {
-		case ackCh <- respMessage{false, nil, nil}:
-		default:
+	b.respLock.Lock()
+	b.handlers[key] = append(b.handlers[key], h)
+	h.timer = time.AfterFunc(expiration, func() {
+		// packets are only delivered to registered handlers,
+		// it is safe to close the channel once it is removed
+		if remove() {
+			close(ackCh)
 		}
 	})
+	b.respLock.Unlock()
+
+	return func() {
+		h.timer.Stop()
+		remove()
+	}
 }
 
 func (b *Backend) sendPacket(peer *Peer, code byte, payload rlpMessage) error {
+	_, err := b.sendPacketWithHash(peer, code, payload)
+	return err
+}
+
+// sendPacketWithHash sends the packet and returns its hash which is
+// used by the remote node as the reply token of the response
+func (b *Backend) sendPacketWithHash(peer *Peer, code byte, payload rlpMessage) ([]byte, error) {
 	data, err := b.encodePacket(code, payload)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, err := b.transport.WriteTo(data, peer.addr()); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return data[:macSize], nil
 }
 
 func (b *Backend) encodePacket(code byte, payload rlpMessage) ([]byte, error) {
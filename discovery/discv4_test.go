@@ -1,6 +1,7 @@
 package discovery
 
 import (
+	"crypto/ecdsa"
 	"crypto/elliptic"
 	"net"
 	"reflect"
@@ -9,26 +10,42 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/fastrlp"
 	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
 )
 
-func newTestDiscovery(t *testing.T, transport Transport, capturePacket bool) *Backend {
+func newTestDiscovery(t testing.TB, transport Transport, capturePacket bool, opts ...BackendOption) *Backend {
 	prv0, _ := crypto.GenerateKey()
+	return newTestDiscoveryWithKey(t, prv0, transport, capturePacket, opts...)
+}
 
-	r, err := NewBackend(nil, prv0, transport)
-	assert.NoError(t, err)
-
+func newTestDiscoveryWithKey(t testing.TB, key *ecdsa.PrivateKey, transport Transport, capturePacket bool, opts ...BackendOption) *Backend {
 	if capturePacket {
-		r.packetCh = make(chan *Packet, 10)
+		opts = append(opts, withPacketCh(make(chan *Packet, 10)))
 	}
+	r, err := NewBackend(nil, key, transport, opts...)
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		r.Close()
+	})
 	return r
 }
 
-func pipe(t *testing.T, capturePacket bool) (*Backend, *Backend) {
-	network := newMockNetwork()
+// withPacketCh sends the packets received to the channel instead of handling them
+func withPacketCh(ch chan *Packet) BackendOption {
+	return func(b *Backend) {
+		b.packetCh = ch
+	}
+}
+
+func pipe(t testing.TB, capturePacket bool, opts ...BackendOption) (*Backend, *Backend) {
+	network := NewMockNetwork()
 
-	d0 := newTestDiscovery(t, network.NewTransport(), capturePacket)
-	d1 := newTestDiscovery(t, network.NewTransport(), capturePacket)
+	d0 := newTestDiscovery(t, network.NewTransport(), capturePacket, opts...)
+	d1 := newTestDiscovery(t, network.NewTransport(), capturePacket, opts...)
 
 	return d0, d1
 }
@@ -101,6 +118,40 @@ func TestExpiredPacket(t *testing.T) {
 	}
 }
 
+// rawPayload is a payload sent without encoding
+type rawPayload []byte
+
+func (r rawPayload) MarshalRLP(dst []byte) []byte {
+	return append(dst, r...)
+}
+
+func TestMalformedPacket(t *testing.T) {
+	r0, r1 := pipe(t, true)
+
+	// findnode is only decoded with a valid endpoint proof
+	r1.updateNodeDB(r0.local, func(n *NodeEntry) {
+		n.IP = r0.local.UDPAddr.IP
+		n.LastPong = time.Now()
+	})
+
+	for _, code := range []byte{pingPacket, findnodePacket} {
+		r0.sendPacket(r1.local, code, rawPayload{0xc5, 0x01})
+
+		p := <-r1.packetCh
+		assert.Error(t, r1.HandlePacket(p))
+	}
+}
+
+func TestPacketTooLarge(t *testing.T) {
+	_, r1 := pipe(t, true)
+
+	err := r1.HandlePacket(&Packet{
+		Buf:  make([]byte, maxPacketSize+1),
+		From: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 30303},
+	})
+	assert.Error(t, err)
+}
+
 func TestNotExpectedPacket(t *testing.T) {
 	r0, r1 := pipe(t, true)
 
@@ -265,6 +316,62 @@ func TestProbeNode(t *testing.T) {
 	testProbeNode(t, r0, r1)
 }
 
+func TestProbeNode_ReplyToken(t *testing.T) {
+	r0, r1 := pipe(t, true)
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- r0.probeNode(r1.local)
+	}()
+	ping := <-r1.packetCh
+
+	// a pong that does not answer the ping is ignored
+	r1.sendPacket(r0.local, pongPacket, &pongResponse{
+		To:         r0.local.toRPCEndpoint(),
+		ReplyTok:   make([]byte, macSize),
+		Expiration: uint64(time.Now().Add(10 * time.Second).Unix()),
+	})
+	assert.NoError(t, r0.HandlePacket(<-r0.packetCh))
+
+	select {
+	case <-done:
+		t.Fatal("pong with an invalid reply token accepted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, r1.HandlePacket(ping))
+	assert.NoError(t, r0.HandlePacket(<-r0.packetCh))
+
+	select {
+	case ok := <-done:
+		assert.True(t, ok)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timeout")
+	}
+}
+
+func TestFindNodeWithRemoteBond(t *testing.T) {
+	r0, r1 := pipe(t, false, WithRespTimeout(500*time.Millisecond))
+
+	// r1 still holds a valid pong from r0 (i.e. r0 restarted) and
+	// does not ping back, the findnode is sent after a short wait
+	r1.updateNodeDB(r0.local, func(n *NodeEntry) {
+		n.IP = r0.local.UDPAddr.IP
+		n.LastPong = time.Now()
+	})
+	peer := newRandomPeer(t)
+	r1.updatePeer(peer)
+
+	found, err := r0.findNodes(r1.local, r0.local.Bytes)
+	assert.NoError(t, err)
+
+	ids := []string{}
+	for _, p := range found {
+		ids = append(ids, p.ID)
+	}
+	assert.Contains(t, ids, peer.ID)
+}
+
 func TestFindNodeWithUnavailableNode(t *testing.T) {
 	t.Skip()
 
@@ -332,3 +439,453 @@ func TestFindNode(t *testing.T) {
 		})
 	}
 }
+
+func TestPingENRSeq(t *testing.T) {
+	ping := &pingRequest{
+		Version:    4,
+		Expiration: 10,
+		ENRSeq:     5,
+	}
+
+	var ping2 pingRequest
+	p := &fastrlp.Parser{}
+	v, err := p.Parse(ping.MarshalRLP(nil))
+	assert.NoError(t, err)
+	assert.NoError(t, ping2.UnmarshalRLP(v))
+	assert.Equal(t, uint64(5), ping2.ENRSeq)
+
+	// the seq is optional
+	ping.ENRSeq = 0
+
+	var ping3 pingRequest
+	v, err = p.Parse(ping.MarshalRLP(nil))
+	assert.NoError(t, err)
+	assert.NoError(t, ping3.UnmarshalRLP(v))
+	assert.Equal(t, uint64(0), ping3.ENRSeq)
+}
+
+func TestRequestENR(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	localNode, err := enode.NewLocalNode(key, nil)
+	assert.NoError(t, err)
+
+	udp := enr.Uint16(30303)
+	localNode.Set("udp", &udp)
+
+	network := NewMockNetwork()
+	r0 := newTestDiscovery(t, network.NewTransport(), true)
+	r1 := newTestDiscoveryWithKey(t, key, network.NewTransport(), true, WithLocalNode(localNode))
+
+	// r0 and r1 have an endpoint proof of each other
+	bond(r0, r1)
+	r0.updatePeer(r1.local)
+
+	type result struct {
+		record *enr.Record
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		record, err := r0.RequestENR(r1.local)
+		done <- result{record, err}
+	}()
+
+	// 1. receive the enr request
+	p := <-r1.packetCh
+	assert.NoError(t, r1.HandlePacket(p))
+
+	// 0. receive the enr response
+	p = <-r0.packetCh
+	assert.NoError(t, r0.HandlePacket(p))
+
+	select {
+	case res := <-done:
+		assert.NoError(t, res.err)
+		assert.Equal(t, localNode.Seq(), res.record.Seq())
+
+		var found enr.Uint16
+		assert.NoError(t, res.record.Load("udp", &found))
+		assert.Equal(t, udp, found)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timeout")
+	}
+
+	// the record is stored with the peer
+	peer, ok := r0.getPeer(r1.local.ID)
+	assert.True(t, ok)
+	assert.NotNil(t, peer.Record)
+}
+
+func TestRequestENR_Bond(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	localNode, err := enode.NewLocalNode(key, nil)
+	assert.NoError(t, err)
+
+	network := NewMockNetwork()
+	r0 := newTestDiscovery(t, network.NewTransport(), false)
+	r1 := newTestDiscoveryWithKey(t, key, network.NewTransport(), false, WithLocalNode(localNode))
+
+	// r0 bonds with r1 before the request
+	record, err := r0.RequestENR(r1.local)
+	assert.NoError(t, err)
+	assert.Equal(t, localNode.Seq(), record.Seq())
+
+	// the nodes discovered are resolved the same way
+	node, err := r1.local.toNode()
+	assert.NoError(t, err)
+	record, err = r0.RequestNodeRecord(node)
+	assert.NoError(t, err)
+	assert.Equal(t, localNode.Seq(), record.Seq())
+}
+
+func TestRequestENR_InvalidSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	localNode, err := enode.NewLocalNode(key, nil)
+	assert.NoError(t, err)
+
+	network := NewMockNetwork()
+	r0 := newTestDiscovery(t, network.NewTransport(), true)
+	r1 := newTestDiscoveryWithKey(t, key, network.NewTransport(), true, WithLocalNode(localNode))
+
+	bond(r0, r1)
+	r0.updatePeer(r1.local)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r0.RequestENR(r1.local)
+		done <- err
+	}()
+
+	// 1. receive the enr request and answer with a record
+	// modified after it was signed
+	p := <-r1.packetCh
+	forged, err := enr.Unmarshal(localNode.Record().Marshal())
+	assert.NoError(t, err)
+	udp := enr.Uint16(30303)
+	forged.Set("udp", &udp)
+
+	assert.NoError(t, r1.sendPacket(r0.local, enrResponsePacket, &enrResponse{
+		ReplyTok: p.Buf[:macSize],
+		Record:   forged,
+	}))
+
+	// 0. receive the enr response
+	p = <-r0.packetCh
+	assert.NoError(t, r0.HandlePacket(p))
+
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timeout")
+	}
+
+	peer, ok := r0.getPeer(r1.local.ID)
+	assert.True(t, ok)
+	assert.Nil(t, peer.Record)
+}
+
+func TestSeedFromNodeDB(t *testing.T) {
+	r0, r1 := pipe(t, true)
+	testProbeNode(t, r0, r1)
+
+	// a new node with the same database does not bond again
+	network := NewMockNetwork()
+	r2 := newTestDiscovery(t, network.NewTransport(), true, WithNodeDB(r0.db))
+	r2.seedFromNodeDB()
+
+	peers := r2.GetPeers()
+	assert.Len(t, peers, 1)
+	assert.Equal(t, r1.local.ID, peers[0].ID)
+	assert.False(t, r2.hasExpired(peers[0]))
+
+	// the endpoint of a ping is stored
+	entry, ok := r1.db.Node(r0.local.ID)
+	assert.True(t, ok)
+	assert.Equal(t, r0.local.UDPAddr.Port, int(entry.UDP))
+	assert.True(t, entry.IP.Equal(r0.local.UDPAddr.IP))
+
+	// an expired endpoint proof is probed again
+	entry, _ = r0.db.Node(r1.local.ID)
+	entry.LastPong = time.Now().Add(-2 * bondExpiration)
+	db := NewMemoryNodeDB()
+	assert.NoError(t, db.UpdateNode(entry))
+
+	r3 := newTestDiscovery(t, network.NewTransport(), true, WithNodeDB(db))
+	r3.seedFromNodeDB()
+	assert.Len(t, r3.GetPeers(), 0)
+}
+
+func TestFindNodeWithoutEndpointProof(t *testing.T) {
+	r0, r1 := pipe(t, true)
+
+	r0.sendPacket(r1.local, findnodePacket, &findNodeRequest{
+		Target:     r0.local.Bytes,
+		Expiration: uint64(time.Now().Add(20 * time.Second).Unix()),
+	})
+
+	p := <-r1.packetCh
+	assert.NoError(t, r1.HandlePacket(p))
+
+	// r1 does not answer since r0 has not been verified
+	select {
+	case <-r0.packetCh:
+		t.Fatal("findnode should not be answered")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEndpointProof(t *testing.T) {
+	r0, _ := pipe(t, true, WithRespTimeout(50*time.Millisecond))
+
+	prv, _ := crypto.GenerateKey()
+	pub := &prv.PublicKey
+	id := EncodeToHex(elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:])
+
+	peer, err := newPeer(id, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 30303}, 0)
+	assert.NoError(t, err)
+	assert.True(t, r0.hasExpired(peer))
+	assert.False(t, r0.isBonded(peer))
+
+	r0.updateNodeDB(peer, func(n *NodeEntry) {
+		n.IP = peer.UDPAddr.IP
+		n.LastPong = time.Now()
+		n.LastPing = time.Now()
+	})
+	assert.False(t, r0.hasExpired(peer))
+	assert.True(t, r0.isBonded(peer))
+
+	// the proof is bound to the ip
+	peer.UDPAddr = &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: 30303}
+	assert.True(t, r0.hasExpired(peer))
+
+	// the proof expires
+	r0.updateNodeDB(peer, func(n *NodeEntry) {
+		n.LastPong = time.Now().Add(-2 * bondExpiration)
+		n.LastPing = time.Now().Add(-2 * bondExpiration)
+	})
+	peer.UDPAddr = &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 30303}
+	assert.True(t, r0.hasExpired(peer))
+	assert.False(t, r0.isBonded(peer))
+}
+
+func TestFindNodeFailures(t *testing.T) {
+	r0, _ := pipe(t, true, WithRespTimeout(50*time.Millisecond))
+
+	prv, _ := crypto.GenerateKey()
+	pub := &prv.PublicKey
+	id := EncodeToHex(elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:])
+
+	// unreachable peer bonded with r0
+	peer, err := newPeer(id, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 30303}, 0)
+	assert.NoError(t, err)
+	r0.updatePeer(peer)
+	r0.updateNodeDB(peer, func(n *NodeEntry) {
+		n.LastPing = time.Now()
+	})
+
+	for i := 0; i < maxFindnodeFailures; i++ {
+		_, ok := r0.getPeer(peer.ID)
+		assert.True(t, ok)
+
+		_, err := r0.findNodes(peer, r0.local.Bytes)
+		assert.Error(t, err)
+	}
+
+	// the peer is removed after too many failures
+	_, ok := r0.getPeer(peer.ID)
+	assert.False(t, ok)
+	assert.NotContains(t, r0.table.nearest(peer.Bytes, bucketSize), peer.ID)
+
+	n, _ := r0.db.Node(peer.ID)
+	assert.Equal(t, maxFindnodeFailures, n.FindFails)
+}
+
+func TestResolve(t *testing.T) {
+	// the target advertises its tcp port in the record
+	nodes := lookupNetwork(t, 4, func(i int, key *ecdsa.PrivateKey, addr *net.UDPAddr) []BackendOption {
+		if i != 3 {
+			return nil
+		}
+		localNode, err := enode.NewLocalNode(key, nil)
+		assert.NoError(t, err)
+
+		ip := enr.IPv4(addr.IP)
+		udp, tcp := enr.Uint16(addr.Port), enr.Uint16(30303)
+		localNode.Set("ip", &ip)
+		localNode.Set("udp", &udp)
+		localNode.Set("tcp", &tcp)
+		return []BackendOption{WithLocalNode(localNode)}
+	})
+	r0, target := nodes[0], nodes[3]
+
+	// the node answers in the known endpoint
+	var id enode.ID
+	copy(id[:], nodes[1].local.Bytes)
+
+	e, err := r0.Resolve(id)
+	assert.NoError(t, err)
+	assert.Equal(t, nodes[1].local.UDPAddr.Port, int(e.UDP))
+
+	// the target is known in an old endpoint
+	stale, err := newPeer(target.local.ID, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9999}, 0)
+	assert.NoError(t, err)
+	r0.updatePeer(stale)
+
+	copy(id[:], target.local.Bytes)
+
+	e, err = r0.Resolve(id)
+	assert.NoError(t, err)
+	assert.Equal(t, target.local.UDPAddr.Port, int(e.UDP))
+	assert.Equal(t, uint16(30303), e.TCP)
+
+	// the node that did not answer is not removed from the table
+	_, ok := r0.getPeer(target.local.ID)
+	assert.True(t, ok)
+
+	// unknown node
+	copy(id[:], newRandomPeer(t).Bytes)
+
+	_, err = r0.Resolve(id)
+	assert.Error(t, err)
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	cases := []struct {
+		sender string
+		ip     string
+		port   uint16
+		valid  bool
+	}{
+		{"1.1.1.1", "2.2.2.2", 30303, true},
+		{"1.1.1.1", "2.2.2.2", 0, false},
+		{"1.1.1.1", "0.0.0.0", 30303, false},
+		{"1.1.1.1", "224.0.0.1", 30303, false},
+		{"1.1.1.1", "127.0.0.1", 30303, false},
+		{"1.1.1.1", "192.168.0.1", 30303, false},
+		{"1.1.1.1", "fe80::1", 30303, false},
+		{"192.168.0.2", "192.168.0.1", 30303, true},
+		{"192.168.0.2", "2.2.2.2", 30303, true},
+		{"127.0.0.1", "127.0.0.1", 30303, true},
+		{"127.0.0.1", "192.168.0.1", 30303, true},
+	}
+	for _, c := range cases {
+		err := validateEndpoint(net.ParseIP(c.sender), net.ParseIP(c.ip), c.port)
+		assert.Equal(t, c.valid, err == nil, "%s from %s", c.ip, c.sender)
+	}
+}
+
+func TestEndpointTCPPort(t *testing.T) {
+	// findnode waits for more neighbors until the response timeout
+	network := NewMockNetwork()
+	r0 := newTestDiscovery(t, network.NewTransport(), false, WithTCPPort(30310), WithRespTimeout(500*time.Millisecond))
+	r1 := newTestDiscovery(t, network.NewTransport(), false, WithRespTimeout(500*time.Millisecond))
+
+	// the tcp port is advertised in the ping
+	assert.True(t, r0.probeNode(r1.local))
+
+	assert.Eventually(t, func() bool {
+		p, ok := r1.getPeer(r0.local.ID)
+		return ok && p.TCP == 30310
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// the tcp port is included in the neighbors
+	peer := newRandomPeer(t)
+	peer.TCP = 30311
+	r1.updatePeer(peer)
+
+	// invalid endpoints are not accepted
+	invalid := newRandomPeer(t)
+	invalid.UDPAddr.IP = net.ParseIP("224.0.0.1")
+	r1.updatePeer(invalid)
+
+	nodes, err := r0.findNodes(r1.local, peer.Bytes)
+	assert.NoError(t, err)
+
+	found := map[string]*Peer{}
+	for _, n := range nodes {
+		found[n.ID] = n
+	}
+	if assert.Contains(t, found, peer.ID) {
+		assert.Equal(t, uint16(30311), found[peer.ID].TCP)
+	}
+	assert.NotContains(t, found, invalid.ID)
+}
+
+func TestSplitNeighbors(t *testing.T) {
+	expiration := uint64(time.Now().Add(20 * time.Second).Unix())
+
+	nodes := []rpcNode{}
+	for i := 0; i < bucketSize; i++ {
+		nodes = append(nodes, rpcNode{
+			IP:  net.ParseIP("2001:db8::1"),
+			UDP: 30303,
+			TCP: 30303,
+			ID:  make([]byte, nodeIDBytes),
+		})
+	}
+
+	chunks := splitNeighbors(nodes, expiration)
+	assert.Len(t, chunks, 2)
+
+	total := 0
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, neighborsPacketSize(chunk, expiration), maxPacketSize)
+		total += len(chunk)
+	}
+	assert.Equal(t, bucketSize, total)
+
+	// the first packet is full
+	assert.Greater(t, neighborsPacketSize(nodes[:len(chunks[0])+1], expiration), maxPacketSize)
+
+	assert.Empty(t, splitNeighbors(nil, expiration))
+}
+
+func TestFindNodeTooManyNodes(t *testing.T) {
+	r0, r1 := pipe(t, true)
+
+	// r0 and r1 have an endpoint proof of each other
+	bond(r0, r1)
+
+	type result struct {
+		peers []*Peer
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		peers, err := r0.findNodes(r1.local, r0.local.Bytes)
+		done <- result{peers, err}
+	}()
+
+	// findnode request
+	p := <-r1.packetCh
+	_, sigdata, _, err := decodePacket(p.Buf)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(findnodePacket), sigdata[0])
+
+	// the response has more nodes than requested
+	nodes := []rpcNode{}
+	for i := 0; i < bucketSize+1; i++ {
+		nodes = append(nodes, newRandomPeer(t).toRPCNode())
+	}
+	expiration := uint64(time.Now().Add(20 * time.Second).Unix())
+	chunks := splitNeighbors(nodes, expiration)
+	assert.Len(t, chunks, 2)
+
+	for _, chunk := range chunks {
+		assert.NoError(t, r1.sendPacket(r0.local, neighborsPacket, &neighborsResponse{
+			Nodes:      chunk,
+			Expiration: expiration,
+		}))
+		r0.HandlePacket(<-r0.packetCh)
+	}
+
+	// the packet that exceeds the requested nodes is rejected
+	select {
+	case res := <-done:
+		assert.NoError(t, res.err)
+		assert.Len(t, res.peers, len(chunks[0]))
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
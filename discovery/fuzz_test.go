@@ -0,0 +1,141 @@
+package discovery
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+func fuzzSeedMessages() map[byte]rlpMessage {
+	endpoint := rpcEndpoint{IP: net.ParseIP("127.0.0.1").To4(), UDP: 30303, TCP: 30304}
+	expiration := uint64(time.Now().Add(time.Hour).Unix())
+
+	prv, _ := crypto.GenerateKey()
+	record := &enr.Record{}
+	ip := enr.IPv4(net.ParseIP("127.0.0.1"))
+	record.Set("ip", &ip)
+	record.Sign(prv)
+
+	return map[byte]rlpMessage{
+		pingPacket: &pingRequest{
+			Version:    4,
+			From:       endpoint,
+			To:         endpoint,
+			Expiration: expiration,
+			ENRSeq:     1,
+		},
+		pongPacket: &pongResponse{
+			To:         endpoint,
+			ReplyTok:   make([]byte, macSize),
+			Expiration: expiration,
+		},
+		findnodePacket: &findNodeRequest{
+			Target:     make([]byte, nodeIDBytes),
+			Expiration: expiration,
+		},
+		neighborsPacket: &neighborsResponse{
+			Nodes: []rpcNode{
+				{IP: endpoint.IP, UDP: 30303, TCP: 30303, ID: make([]byte, nodeIDBytes)},
+			},
+			Expiration: expiration,
+		},
+		enrRequestPacket: &enrRequest{
+			Expiration: expiration,
+		},
+		enrResponsePacket: &enrResponse{
+			ReplyTok: make([]byte, macSize),
+			Record:   record,
+		},
+	}
+}
+
+// fuzzMessage is a discv4 message that can be decoded
+type fuzzMessage interface {
+	rlpMessage
+	UnmarshalRLP(v *fastrlp.Value) error
+}
+
+func newFuzzMessage(code byte) fuzzMessage {
+	switch code {
+	case pingPacket:
+		return &pingRequest{}
+	case pongPacket:
+		return &pongResponse{}
+	case findnodePacket:
+		return &findNodeRequest{}
+	case neighborsPacket:
+		return &neighborsResponse{}
+	case enrRequestPacket:
+		return &enrRequest{}
+	case enrResponsePacket:
+		return &enrResponse{}
+	}
+	return nil
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	for code, msg := range fuzzSeedMessages() {
+		f.Add(code, msg.MarshalRLP(nil))
+	}
+
+	f.Fuzz(func(t *testing.T, code byte, data []byte) {
+		msg := newFuzzMessage(code)
+		if msg == nil {
+			return
+		}
+		p := &fastrlp.Parser{}
+		v, err := p.Parse(data)
+		if err != nil {
+			return
+		}
+		if err := msg.UnmarshalRLP(v); err != nil {
+			return
+		}
+
+		// the encoding of a decoded message is stable
+		enc := msg.MarshalRLP(nil)
+
+		msg2 := newFuzzMessage(code)
+		v, err = p.Parse(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := msg2.UnmarshalRLP(v); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, msg2.MarshalRLP(nil)) {
+			t.Fatal("round trip encoding does not match")
+		}
+	})
+}
+
+func FuzzHandlePacket(f *testing.F) {
+	r0, r1 := pipe(f, false)
+
+	// r1 has an endpoint proof of r0 to decode every packet
+	r1.updateNodeDB(r0.local, func(n *NodeEntry) {
+		n.IP = r0.local.UDPAddr.IP
+		n.LastPong = time.Now()
+	})
+
+	for code, msg := range fuzzSeedMessages() {
+		packet, err := r0.encodePacket(code, msg)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(packet)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r1.HandlePacket(&Packet{
+			Buf:       data,
+			From:      r0.local.UDPAddr,
+			Timestamp: time.Now(),
+		})
+	})
+}
@@ -0,0 +1,431 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// Iterator iterates over the nodes found by a discovery source
+type Iterator interface {
+	// Next moves to the next node. It blocks until a node is available
+	// and returns false if the iterator is exhausted or closed.
+	Next() bool
+
+	// Node returns the current node
+	Node() *enode.Node
+
+	// Close ends the iteration. Any call to Next blocked is released.
+	Close()
+}
+
+// ReadNodes reads up to n distinct nodes from the iterator
+func ReadNodes(it Iterator, n int) []*enode.Node {
+	seen := map[enode.ID]*enode.Node{}
+	res := []*enode.Node{}
+	for len(res) < n && it.Next() {
+		node := it.Node()
+		if _, ok := seen[node.ID()]; ok {
+			continue
+		}
+		seen[node.ID()] = node
+		res = append(res, node)
+	}
+	return res
+}
+
+// sliceIter is an iterator over a list of nodes
+type sliceIter struct {
+	lock  sync.Mutex
+	nodes []*enode.Node
+	cur   *enode.Node
+}
+
+// IterNodes returns an iterator over the nodes
+func IterNodes(nodes []*enode.Node) Iterator {
+	return &sliceIter{nodes: nodes}
+}
+
+func (s *sliceIter) Next() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.nodes) == 0 {
+		s.cur = nil
+		return false
+	}
+	s.cur, s.nodes = s.nodes[0], s.nodes[1:]
+	return true
+}
+
+func (s *sliceIter) Node() *enode.Node {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.cur
+}
+
+func (s *sliceIter) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nodes = nil
+}
+
+// filterIter skips the nodes of the iterator that do not pass the check
+type filterIter struct {
+	Iterator
+	check func(*enode.Node) bool
+}
+
+// Filter returns an iterator with the nodes of 'it' that pass the check
+func Filter(it Iterator, check func(*enode.Node) bool) Iterator {
+	return &filterIter{it, check}
+}
+
+func (f *filterIter) Next() bool {
+	for f.Iterator.Next() {
+		if f.check(f.Node()) {
+			return true
+		}
+	}
+	return false
+}
+
+// numRecordRequests is the number of records requested at the same time
+const numRecordRequests = 8
+
+// recordIter requests the record of the nodes without one. The requests
+// run concurrently so that the nodes that do not answer do not block
+// the iteration.
+type recordIter struct {
+	it        Iterator
+	request   func(*enode.Node) (*enr.Record, error)
+	cur       *enode.Node
+	resCh     chan *enode.Node
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+// ResolveRecords returns an iterator that requests the record of the nodes of 'it'
+// that do not have one. The node is kept without a record if the request fails.
+// The nodes are not returned in the same order as in 'it'.
+func ResolveRecords(it Iterator, request func(*enode.Node) (*enr.Record, error)) Iterator {
+	r := &recordIter{
+		it:      it,
+		request: request,
+		resCh:   make(chan *enode.Node),
+		closeCh: make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *recordIter) run() {
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		close(r.resCh)
+	}()
+
+	slots := make(chan struct{}, numRecordRequests)
+	for r.it.Next() {
+		n := r.it.Node()
+		if n.Record() != nil {
+			if !r.send(n) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-r.closeCh:
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			r.send(r.resolve(n))
+		}()
+	}
+}
+
+// resolve returns the node with its record if the request succeeds
+func (r *recordIter) resolve(n *enode.Node) *enode.Node {
+	record, err := r.request(n)
+	if err != nil {
+		return n
+	}
+	res, err := enode.NodeWithEnode(record, n.Enode())
+	if err != nil {
+		return n
+	}
+	return res
+}
+
+func (r *recordIter) send(n *enode.Node) bool {
+	select {
+	case r.resCh <- n:
+		return true
+	case <-r.closeCh:
+		return false
+	}
+}
+
+func (r *recordIter) Next() bool {
+	select {
+	case n, ok := <-r.resCh:
+		if ok {
+			r.cur = n
+			return true
+		}
+	case <-r.closeCh:
+	}
+	r.cur = nil
+	return false
+}
+
+func (r *recordIter) Node() *enode.Node {
+	return r.cur
+}
+
+func (r *recordIter) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closeCh)
+		r.it.Close()
+	})
+}
+
+// lookupIter is an iterator over the results of repeated lookups
+type lookupIter struct {
+	lookup func(ctx context.Context) []*enode.Node
+	buf    []*enode.Node
+	cur    *enode.Node
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// lookupRetryDelay is the time to wait before a new lookup
+// if the previous one did not return any node
+var lookupRetryDelay = 1 * time.Second
+
+// NewLookupIterator returns an iterator that runs the lookup function
+// every time it runs out of nodes. It never ends until it is closed.
+// The context of the lookup is cancelled when the iterator is closed.
+func NewLookupIterator(lookup func(ctx context.Context) []*enode.Node) Iterator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lookupIter{
+		lookup: lookup,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (l *lookupIter) Next() bool {
+	for {
+		select {
+		case <-l.ctx.Done():
+			l.cur = nil
+			return false
+		default:
+		}
+		if len(l.buf) != 0 {
+			break
+		}
+
+		l.buf = l.lookup(l.ctx)
+		if len(l.buf) == 0 {
+			select {
+			case <-time.After(lookupRetryDelay):
+			case <-l.ctx.Done():
+			}
+		}
+	}
+	l.cur, l.buf = l.buf[0], l.buf[1:]
+	return true
+}
+
+func (l *lookupIter) Node() *enode.Node {
+	return l.cur
+}
+
+func (l *lookupIter) Close() {
+	l.cancel()
+}
+
+// FairMix takes nodes from multiple sources in a round robin order. If the next
+// source does not have a node ready within the timeout, the node is taken from
+// any source. The timeout of a source halves every time it is not ready so that
+// slow sources do not block the iteration. Next blocks until any source
+// has a node or the mixer is closed.
+type FairMix struct {
+	timeout time.Duration
+	fromAny chan *enode.Node
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+	cur     *enode.Node
+
+	lock    sync.Mutex
+	sources []*mixSource
+	last    int
+	closed  bool
+}
+
+type mixSource struct {
+	it      Iterator
+	next    chan *enode.Node
+	timeout time.Duration
+}
+
+// NewFairMix creates a mixer of iterators. A negative timeout
+// waits indefinitely for the next source.
+func NewFairMix(timeout time.Duration) *FairMix {
+	return &FairMix{
+		timeout: timeout,
+		fromAny: make(chan *enode.Node),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// AddSource adds a new source of nodes
+func (m *FairMix) AddSource(it Iterator) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		it.Close()
+		return
+	}
+	s := &mixSource{it: it, next: make(chan *enode.Node), timeout: m.timeout}
+	m.sources = append(m.sources, s)
+
+	m.wg.Add(1)
+	go m.runSource(s)
+}
+
+// Close closes the mixer and all its sources
+func (m *FairMix) Close() {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.closeCh)
+	for _, s := range m.sources {
+		s.it.Close()
+	}
+	m.sources = nil
+	m.lock.Unlock()
+
+	m.wg.Wait()
+}
+
+// Next implements the Iterator interface
+func (m *FairMix) Next() bool {
+	m.cur = nil
+
+	for {
+		source := m.pickSource()
+		if source == nil {
+			return m.nextFromAny()
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if source.timeout >= 0 {
+			timer = time.NewTimer(source.timeout)
+			timeout = timer.C
+		}
+
+		select {
+		case <-m.closeCh:
+			stopTimer(timer)
+			return false
+
+		case n, ok := <-source.next:
+			stopTimer(timer)
+			if ok {
+				// the source is ready, reset its timeout
+				source.timeout = m.timeout
+				m.cur = n
+				return true
+			}
+			// the source is exhausted
+			m.deleteSource(source)
+
+		case <-timeout:
+			source.timeout /= 2
+			return m.nextFromAny()
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// Node implements the Iterator interface
+func (m *FairMix) Node() *enode.Node {
+	return m.cur
+}
+
+func (m *FairMix) nextFromAny() bool {
+	select {
+	case n := <-m.fromAny:
+		m.cur = n
+		return true
+	case <-m.closeCh:
+		return false
+	}
+}
+
+// pickSource returns the next source in round robin order
+func (m *FairMix) pickSource() *mixSource {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.sources) == 0 {
+		return nil
+	}
+	m.last = (m.last + 1) % len(m.sources)
+	return m.sources[m.last]
+}
+
+func (m *FairMix) deleteSource(s *mixSource) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i := range m.sources {
+		if m.sources[i] == s {
+			m.sources = append(m.sources[:i], m.sources[i+1:]...)
+			return
+		}
+	}
+}
+
+// runSource reads the nodes of the source and sends them either
+// to the round robin of the source or to any caller
+func (m *FairMix) runSource(s *mixSource) {
+	defer m.wg.Done()
+	defer close(s.next)
+
+	for s.it.Next() {
+		n := s.it.Node()
+		select {
+		case s.next <- n:
+		case m.fromAny <- n:
+		case <-m.closeCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// testNodes returns n nodes with the given tcp port and their index as udp port
+func testNodes(n int, tcp uint16) []*enode.Node {
+	nodes := []*enode.Node{}
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		nodes = append(nodes, enode.NewNode(&key.PublicKey, net.ParseIP("127.0.0.1"), tcp, uint16(i)))
+	}
+	return nodes
+}
+
+func TestIterator_Filter(t *testing.T) {
+	nodes := testNodes(10, 1)
+
+	it := Filter(IterNodes(nodes), func(n *enode.Node) bool {
+		return n.UDP()%2 == 0
+	})
+	res := ReadNodes(it, 10)
+	assert.Len(t, res, 5)
+	for _, n := range res {
+		assert.Equal(t, uint16(0), n.UDP()%2)
+	}
+}
+
+func TestIterator_ReadNodesDistinct(t *testing.T) {
+	nodes := testNodes(3, 1)
+	nodes = append(nodes, nodes...)
+
+	res := ReadNodes(IterNodes(nodes), 10)
+	assert.Len(t, res, 3)
+}
+
+func TestIterator_Lookup(t *testing.T) {
+	calls := 0
+	it := NewLookupIterator(func(ctx context.Context) []*enode.Node {
+		calls++
+		return testNodes(2, uint16(calls))
+	})
+
+	res := ReadNodes(it, 5)
+	assert.Len(t, res, 5)
+	assert.Equal(t, 3, calls)
+
+	it.Close()
+	assert.False(t, it.Next())
+}
+
+func TestIterator_LookupClose(t *testing.T) {
+	it := NewLookupIterator(func(ctx context.Context) []*enode.Node {
+		return nil
+	})
+
+	doneCh := make(chan bool)
+	go func() {
+		doneCh <- it.Next()
+	}()
+
+	it.Close()
+	select {
+	case ok := <-doneCh:
+		assert.False(t, ok)
+	case <-time.After(lookupRetryDelay / 2):
+		t.Fatal("next not released on close")
+	}
+}
+
+func TestIterator_LookupCancel(t *testing.T) {
+	started := make(chan struct{})
+	it := NewLookupIterator(func(ctx context.Context) []*enode.Node {
+		close(started)
+		// the lookup runs until the iterator is closed
+		<-ctx.Done()
+		return nil
+	})
+
+	doneCh := make(chan bool)
+	go func() {
+		doneCh <- it.Next()
+	}()
+
+	<-started
+	it.Close()
+	select {
+	case ok := <-doneCh:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("lookup not cancelled on close")
+	}
+}
+
+func TestFairMix_RoundRobin(t *testing.T) {
+	mix := NewFairMix(time.Second)
+	defer mix.Close()
+
+	for i := 1; i <= 3; i++ {
+		mix.AddSource(IterNodes(testNodes(10, uint16(i))))
+	}
+
+	// every source is ready, the nodes are taken in turns
+	count := map[uint16]int{}
+	for i := 0; i < 15; i++ {
+		assert.True(t, mix.Next())
+		count[mix.Node().TCP()]++
+	}
+	for i := uint16(1); i <= 3; i++ {
+		assert.Equal(t, 5, count[i])
+	}
+}
+
+func TestFairMix_SlowSource(t *testing.T) {
+	mix := NewFairMix(10 * time.Millisecond)
+	defer mix.Close()
+
+	// a source that never returns a node does not block the mix
+	blocked := NewLookupIterator(func(ctx context.Context) []*enode.Node {
+		return nil
+	})
+	mix.AddSource(blocked)
+	mix.AddSource(IterNodes(testNodes(5, 1)))
+
+	res := ReadNodes(mix, 5)
+	assert.Len(t, res, 5)
+}
+
+func TestFairMix_Close(t *testing.T) {
+	mix := NewFairMix(time.Second)
+	mix.AddSource(IterNodes(testNodes(1, 1)))
+
+	assert.True(t, mix.Next())
+
+	doneCh := make(chan bool)
+	go func() {
+		doneCh <- mix.Next()
+	}()
+
+	mix.Close()
+	select {
+	case ok := <-doneCh:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("next not released on close")
+	}
+
+	// sources added after close are closed
+	it := IterNodes(testNodes(1, 2))
+	mix.AddSource(it)
+	assert.False(t, it.Next())
+}
+
+func TestIterator_ResolveRecords(t *testing.T) {
+	keys := map[enode.ID]*ecdsa.PrivateKey{}
+	nodes := []*enode.Node{}
+	for i := 0; i < 2; i++ {
+		key, _ := crypto.GenerateKey()
+		n := enode.NewNode(&key.PublicKey, net.ParseIP("127.0.0.1"), 30303, 30303)
+		keys[n.ID()] = key
+		nodes = append(nodes, n)
+	}
+
+	// the second node already has a record
+	record := &enr.Record{}
+	assert.NoError(t, record.Sign(keys[nodes[1].ID()]))
+	n, err := enode.NodeWithEnode(record, nodes[1].Enode())
+	assert.NoError(t, err)
+	nodes[1] = n
+
+	requested := 0
+	it := ResolveRecords(IterNodes(nodes), func(n *enode.Node) (*enr.Record, error) {
+		requested++
+		r := &enr.Record{}
+		r.SetSeq(5)
+		return r, r.Sign(keys[n.ID()])
+	})
+
+	res := map[enode.ID]*enode.Node{}
+	for _, n := range ReadNodes(it, 2) {
+		res[n.ID()] = n
+	}
+	assert.Len(t, res, 2)
+
+	n0 := res[nodes[0].ID()]
+	assert.Equal(t, uint64(5), n0.Record().Seq())
+	assert.Equal(t, uint64(0), res[nodes[1].ID()].Record().Seq())
+
+	// the endpoint is kept since the record does not have one
+	assert.Equal(t, "127.0.0.1", n0.IP().String())
+	assert.Equal(t, uint16(30303), n0.TCP())
+
+	// only the nodes without record are requested
+	assert.Equal(t, 1, requested)
+}
+
+func TestIterator_ResolveRecordsConcurrent(t *testing.T) {
+	nodes := testNodes(10, 1)
+
+	// the first node never answers
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+
+	it := ResolveRecords(IterNodes(nodes), func(n *enode.Node) (*enr.Record, error) {
+		if n.ID() == nodes[0].ID() {
+			<-blockCh
+		}
+		return nil, fmt.Errorf("not found")
+	})
+	defer it.Close()
+
+	// the other nodes are not blocked by the request of the first one
+	res := ReadNodes(it, 9)
+	assert.Len(t, res, 9)
+	for _, n := range res {
+		assert.NotEqual(t, nodes[0].ID(), n.ID())
+	}
+}
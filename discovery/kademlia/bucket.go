@@ -5,15 +5,23 @@ import (
 	"sync"
 )
 
+// maxReplacements is the maximum number of peers in the replacement list of a bucket
+const maxReplacements = 10
+
 // Bucket holds a list of peers.
 type Bucket struct {
 	lk   sync.RWMutex
 	list *list.List
+
+	// replacements are the peers seen when the bucket was full, the most
+	// recently seen first. They replace the peers that fail the revalidation.
+	replacements *list.List
 }
 
 func newBucket() *Bucket {
 	b := new(Bucket)
 	b.list = list.New()
+	b.replacements = list.New()
 	return b
 }
 
@@ -67,6 +75,13 @@ func (b *Bucket) PushFront(p *Entry) {
 	b.lk.Unlock()
 }
 
+// PushBack adds the peer to the back of the bucket, as the least recently seen
+func (b *Bucket) PushBack(p *Entry) {
+	b.lk.Lock()
+	b.list.PushBack(p)
+	b.lk.Unlock()
+}
+
 func (b *Bucket) PopBack() string {
 	b.lk.Lock()
 	defer b.lk.Unlock()
@@ -75,6 +90,58 @@ func (b *Bucket) PopBack() string {
 	return last.Value.(*Entry).id
 }
 
+// Replacements returns the replacement peers, the most recently seen first
+func (b *Bucket) Replacements() []string {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	ps := make([]string, 0, b.replacements.Len())
+	for e := b.replacements.Front(); e != nil; e = e.Next() {
+		ps = append(ps, e.Value.(*Entry).id)
+	}
+	return ps
+}
+
+// AddReplacement adds the peer to the front of the replacement list
+func (b *Bucket) AddReplacement(p *Entry) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	for e := b.replacements.Front(); e != nil; e = e.Next() {
+		if e.Value.(*Entry).id == p.id {
+			b.replacements.MoveToFront(e)
+			return
+		}
+	}
+	b.replacements.PushFront(p)
+	if b.replacements.Len() > maxReplacements {
+		b.replacements.Remove(b.replacements.Back())
+	}
+}
+
+// RemoveReplacement removes the peer from the replacement list
+func (b *Bucket) RemoveReplacement(id string) bool {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	for e := b.replacements.Front(); e != nil; e = e.Next() {
+		if e.Value.(*Entry).id == id {
+			b.replacements.Remove(e)
+			return true
+		}
+	}
+	return false
+}
+
+// popReplacement removes and returns the most recently seen replacement
+func (b *Bucket) popReplacement() (*Entry, bool) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	front := b.replacements.Front()
+	if front == nil {
+		return nil, false
+	}
+	b.replacements.Remove(front)
+	return front.Value.(*Entry), true
+}
+
 func (b *Bucket) Len() int {
 	b.lk.RLock()
 	defer b.lk.RUnlock()
@@ -88,10 +155,15 @@ func (b *Bucket) Split(cpl int, target ID) *Bucket {
 	b.lk.Lock()
 	defer b.lk.Unlock()
 
-	out := list.New()
 	newbuck := newBucket()
-	newbuck.list = out
-	e := b.list.Front()
+	splitList(b.list, newbuck.list, cpl, target)
+	splitList(b.replacements, newbuck.replacements, cpl, target)
+	return newbuck
+}
+
+// splitList moves the peers with CPL greater than cpl from 'in' to 'out'
+func splitList(in, out *list.List, cpl int, target ID) {
+	e := in.Front()
 	for e != nil {
 		peerID := e.Value.(*Entry).hash
 		peerCPL := CommonPrefixLen(peerID, target)
@@ -99,10 +171,9 @@ func (b *Bucket) Split(cpl int, target ID) *Bucket {
 			cur := e
 			out.PushBack(e.Value)
 			e = e.Next()
-			b.list.Remove(cur)
+			in.Remove(cur)
 			continue
 		}
 		e = e.Next()
 	}
-	return newbuck
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"hash"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -33,7 +34,9 @@ type RoutingTable struct {
 	PeerRemoved func(string)
 	PeerAdded   func(string)
 
-	hash hash.Hash
+	// the hash is shared by all the lookups
+	hash     hash.Hash
+	hashLock sync.Mutex
 }
 
 type Entry struct {
@@ -56,6 +59,9 @@ func NewRoutingTable(bucketsize int, peer string, latency time.Duration, hash ha
 }
 
 func (rt *RoutingTable) hashPeer(p string) []byte {
+	rt.hashLock.Lock()
+	defer rt.hashLock.Unlock()
+
 	if rt.hash == nil {
 		rt.hash = sha3.New256()
 	}
@@ -77,6 +83,7 @@ func (rt *RoutingTable) Update(p string) (evicted string, err error) {
 	}
 
 	bucket := rt.Buckets[bucketID]
+	entry := &Entry{id: p, hash: peerID}
 	if bucket.Has(p) {
 		// If the peer is already in the table, move it to the front.
 		// This signifies that it it "more active" and the less active nodes
@@ -87,7 +94,8 @@ func (rt *RoutingTable) Update(p string) (evicted string, err error) {
 
 	// We have enough space in the bucket (whether spawned or grouped).
 	if bucket.Len() < rt.bucketsize {
-		bucket.PushFront(&Entry{id: p, hash: peerID})
+		bucket.PushFront(entry)
+		bucket.RemoveReplacement(p)
 		rt.PeerAdded(p)
 		return "", nil
 	}
@@ -102,17 +110,52 @@ func (rt *RoutingTable) Update(p string) (evicted string, err error) {
 		}
 		bucket = rt.Buckets[bucketID]
 		if bucket.Len() >= rt.bucketsize {
-			// if after all the unfolding, we're unable to find room for this peer, scrap it.
+			// if after all the unfolding, we're unable to find room for this peer,
+			// keep it as a replacement.
+			bucket.AddReplacement(entry)
 			return "", ErrPeerRejectedNoCapacity
 		}
-		bucket.PushFront(&Entry{id: p, hash: peerID})
+		bucket.PushFront(entry)
+		bucket.RemoveReplacement(p)
 		rt.PeerAdded(p)
 		return "", nil
 	}
 
+	// keep the peer as a replacement in case any of the peers of the bucket fails
+	bucket.AddReplacement(entry)
 	return "", ErrPeerRejectedNoCapacity
 }
 
+// Replace removes a peer that failed the revalidation and replaces it with the most
+// recently seen peer in the replacement list of its bucket, if any.
+func (rt *RoutingTable) Replace(p string) (replacement string, ok bool) {
+	peerID := rt.hashPeer(p)
+	cpl := CommonPrefixLen(peerID, rt.local)
+
+	rt.tabLock.Lock()
+	defer rt.tabLock.Unlock()
+
+	bucketID := cpl
+	if bucketID >= len(rt.Buckets) {
+		bucketID = len(rt.Buckets) - 1
+	}
+
+	bucket := rt.Buckets[bucketID]
+	if !bucket.Remove(p) {
+		return "", false
+	}
+	rt.PeerRemoved(p)
+
+	entry, ok := bucket.popReplacement()
+	if !ok {
+		return "", false
+	}
+	// replacements are less active than the peers in the bucket
+	bucket.PushBack(entry)
+	rt.PeerAdded(entry.id)
+	return entry.id, true
+}
+
 // Remove deletes a peer from the routing table. This is to be used
 // when we are sure a node has disconnected completely.
 func (rt *RoutingTable) Remove(p string) {
@@ -128,6 +171,7 @@ func (rt *RoutingTable) Remove(p string) {
 	}
 
 	bucket := rt.Buckets[bucketID]
+	bucket.RemoveReplacement(p)
 	if bucket.Remove(p) {
 		rt.PeerRemoved(p)
 	}
@@ -224,6 +268,19 @@ func (rt *RoutingTable) Size() int {
 	return tot
 }
 
+// LeastRecent returns the least recently seen peer of a random non empty bucket
+func (rt *RoutingTable) LeastRecent() (string, bool) {
+	rt.tabLock.RLock()
+	defer rt.tabLock.RUnlock()
+
+	for _, i := range rand.Perm(len(rt.Buckets)) {
+		if peers := rt.Buckets[i].Peers(); len(peers) != 0 {
+			return peers[len(peers)-1], true
+		}
+	}
+	return "", false
+}
+
 // ListPeers takes a RoutingTable and returns a list of all peers from all buckets in the table.
 func (rt *RoutingTable) ListPeers() []string {
 	var peers []string
@@ -148,6 +148,96 @@ func TestKademlia_EldestPreferred(t *testing.T) {
 	}
 }
 
+func TestKademlia_Replacements(t *testing.T) {
+	local := randPeerID()
+	rt := NewRoutingTable(10, local, time.Hour, sha3.New256())
+
+	peers := make([]string, 15)
+	for i := 0; i < 15; {
+		if p := randPeerID(); CommonPrefixLen(convertPeerID(local), convertPeerID(p)) == 0 {
+			peers[i] = p
+			i++
+		}
+	}
+
+	added, removed := []string{}, []string{}
+	rt.PeerAdded = func(p string) {
+		added = append(added, p)
+	}
+	rt.PeerRemoved = func(p string) {
+		removed = append(removed, p)
+	}
+
+	for _, p := range peers {
+		rt.Update(p)
+	}
+	if len(added) != 10 {
+		t.Fatalf("expected 10 peers added but found %d", len(added))
+	}
+
+	// the rejected peers are kept as replacements, the most recent first
+	bucket := rt.Buckets[0]
+	replacements := bucket.Replacements()
+	if len(replacements) != 5 {
+		t.Fatalf("expected 5 replacements but found %d", len(replacements))
+	}
+	if replacements[0] != peers[14] {
+		t.Fatal("expected the last peer to be the first replacement")
+	}
+
+	// replace the least recently seen peer
+	eldest := bucket.Peers()[bucket.Len()-1]
+	replacement, ok := rt.Replace(eldest)
+	if !ok {
+		t.Fatal("expected the peer to be replaced")
+	}
+	if replacement != peers[14] {
+		t.Fatalf("expected replacement %s but found %s", peers[14], replacement)
+	}
+	if rt.Find(eldest) != "" {
+		t.Fatal("the replaced peer should not be in the table")
+	}
+	if rt.Find(replacement) != replacement {
+		t.Fatal("the replacement should be in the table")
+	}
+	if len(removed) != 1 || removed[0] != eldest {
+		t.Fatal("expected the replaced peer to be removed")
+	}
+	if added[len(added)-1] != replacement {
+		t.Fatal("expected the replacement to be added")
+	}
+	if len(bucket.Replacements()) != 4 {
+		t.Fatal("expected the replacement to be popped from the list")
+	}
+
+	// a removed peer is not kept as replacement
+	rt.Remove(peers[13])
+	for _, p := range bucket.Replacements() {
+		if p == peers[13] {
+			t.Fatal("removed peer should not be a replacement")
+		}
+	}
+}
+
+func TestKademlia_ReplacementsLimit(t *testing.T) {
+	b := newBucket()
+	for i := 0; i < maxReplacements+5; i++ {
+		b.AddReplacement(randEntry())
+	}
+	if len(b.Replacements()) != maxReplacements {
+		t.Fatalf("expected %d replacements", maxReplacements)
+	}
+
+	// adding an existing replacement moves it to the front
+	last := b.Replacements()[maxReplacements-1]
+	b.AddReplacement(&Entry{id: last, hash: hashit(last)})
+
+	replacements := b.Replacements()
+	if len(replacements) != maxReplacements || replacements[0] != last {
+		t.Fatal("expected the replacement to be moved to the front")
+	}
+}
+
 func TestKademlia_FindMultiple(t *testing.T) {
 	local := randPeerID()
 	rt := NewRoutingTable(20, local, time.Hour, sha3.New256())
@@ -202,6 +292,36 @@ func TestKademlia_Multithreaded(t *testing.T) {
 	<-done
 }
 
+func TestKademlia_ReplaceMultithreaded(t *testing.T) {
+	tab := NewRoutingTable(5, "localPeer", time.Hour, sha3.New256())
+	var peers []string
+	for i := 0; i < 100; i++ {
+		peers = append(peers, randPeerID())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			n := rand.Intn(len(peers))
+			tab.Update(peers[n])
+			if id, ok := tab.LeastRecent(); ok {
+				tab.Replace(id)
+			}
+		}
+		done <- struct{}{}
+	}()
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			tab.LeastRecent()
+			tab.ListPeers()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
 func BenchmarkUpdates(b *testing.B) {
 	b.StopTimer()
 	tab := NewRoutingTable(20, "localKey", time.Hour, sha3.New256())
@@ -0,0 +1,144 @@
+package discovery
+
+import (
+	"context"
+)
+
+// lookupEntry is a node found during a lookup
+type lookupEntry struct {
+	peer *Peer
+	hash [32]byte
+}
+
+// lookup is an iterative kademlia lookup of the nodes closest to a target.
+// It queries up to alpha nodes at the same time and it ends once the
+// bucketSize closest nodes found have been queried.
+type lookup struct {
+	b      *Backend
+	target []byte
+	hash   [32]byte
+
+	// result are the closest nodes found sorted by distance to the target
+	result []*lookupEntry
+	seen   map[string]struct{}
+	asked  map[string]struct{}
+
+	replyCh chan []*Peer
+	queries int
+
+	// skip, if set, ignores some of the nodes found
+	skip func(peer *Peer) bool
+}
+
+func newLookup(b *Backend, target []byte) *lookup {
+	return &lookup{
+		b:       b,
+		target:  target,
+		hash:    nodeHash(target),
+		seen:    map[string]struct{}{},
+		asked:   map[string]struct{}{},
+		replyCh: make(chan []*Peer, alpha),
+	}
+}
+
+// run performs the lookup and returns the closest nodes to the target
+func (l *lookup) run(ctx context.Context) ([]*Peer, error) {
+	seeds, err := l.b.NearestPeersFromTarget(l.target)
+	if err != nil {
+		return nil, err
+	}
+	l.addNodes(seeds)
+
+	for {
+		// query the closest nodes that have not been asked yet
+		for i := 0; i < len(l.result) && l.queries < alpha; i++ {
+			peer := l.result[i].peer
+			if _, ok := l.asked[peer.ID]; ok {
+				continue
+			}
+			l.asked[peer.ID] = struct{}{}
+			l.queries++
+			go l.query(peer)
+		}
+		if l.queries == 0 {
+			// all the closest nodes have been asked
+			break
+		}
+
+		select {
+		case nodes := <-l.replyCh:
+			l.queries--
+			l.addNodes(nodes)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-l.b.shutdownCh:
+			return nil, nil
+		}
+	}
+
+	peers := make([]*Peer, 0, len(l.result))
+	for _, e := range l.result {
+		peers = append(peers, e.peer)
+	}
+	return peers, nil
+}
+
+func (l *lookup) query(peer *Peer) {
+	nodes, err := l.b.findNodes(peer, l.target)
+	if err != nil {
+		l.b.logger.Printf("[TRACE] lookup query failed: id, %s, err, %v", peer.ID, err)
+	}
+	// replyCh has room for all the queries in flight, the query
+	// does not block even if the lookup has been cancelled
+	l.replyCh <- nodes
+}
+
+// addNodes adds the nodes to the result keeping only
+// the bucketSize closest ones to the target
+func (l *lookup) addNodes(nodes []*Peer) {
+	for _, peer := range nodes {
+		if peer.ID == l.b.local.ID {
+			continue
+		}
+		if l.skip != nil && l.skip(peer) {
+			continue
+		}
+		if _, ok := l.seen[peer.ID]; ok {
+			continue
+		}
+		l.seen[peer.ID] = struct{}{}
+
+		entry := &lookupEntry{peer: peer, hash: nodeHash(peer.Bytes)}
+
+		// insert the entry sorted by distance
+		i := 0
+		for i < len(l.result) && distCmp(l.hash, l.result[i].hash, entry.hash) < 0 {
+			i++
+		}
+		if i == bucketSize {
+			continue
+		}
+		l.result = append(l.result, nil)
+		copy(l.result[i+1:], l.result[i:])
+		l.result[i] = entry
+
+		if len(l.result) > bucketSize {
+			l.result = l.result[:bucketSize]
+		}
+	}
+}
+
+// distCmp compares the distances a->target and b->target. It returns -1
+// if a is closer to target, 1 if b is closer and 0 if they are equal.
+func distCmp(target, a, b [32]byte) int {
+	for i := range target {
+		da := a[i] ^ target[i]
+		db := b[i] ^ target[i]
+		if da > db {
+			return 1
+		} else if da < db {
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,188 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+)
+
+func newRandomPeer(t *testing.T) *Peer {
+	prv, _ := crypto.GenerateKey()
+	pub := &prv.PublicKey
+
+	peer, err := newPeer(EncodeToHex(elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:]), &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 30303}, 0)
+	assert.NoError(t, err)
+	return peer
+}
+
+// bond sets an endpoint proof in both directions so that
+// the nodes answer the findnode requests of each other
+func bond(a, b *Backend) {
+	now := time.Now()
+	a.updateNodeDB(b.local, func(n *NodeEntry) {
+		n.IP = b.local.UDPAddr.IP
+		n.LastPing = now
+		n.LastPong = now
+	})
+	b.updateNodeDB(a.local, func(n *NodeEntry) {
+		n.IP = a.local.UDPAddr.IP
+		n.LastPing = now
+		n.LastPong = now
+	})
+}
+
+// lookupNetwork creates a network where the first node only knows
+// the second one and the other nodes know each other. The options
+// of each node are returned by opts if not nil.
+func lookupNetwork(t *testing.T, size int, opts func(i int, key *ecdsa.PrivateKey, addr *net.UDPAddr) []BackendOption) []*Backend {
+	return lookupNetworkOn(t, NewMockNetwork(), size, opts)
+}
+
+// lookupNetworkOn creates the lookup network on the given mock network
+func lookupNetworkOn(t *testing.T, network *MockNetwork, size int, opts func(i int, key *ecdsa.PrivateKey, addr *net.UDPAddr) []BackendOption) []*Backend {
+	// the transports are created before the nodes start to send packets
+	transports := []Transport{}
+	for i := 0; i < size; i++ {
+		transports = append(transports, network.NewTransport())
+	}
+	nodes := []*Backend{}
+	for i, tr := range transports {
+		key, _ := crypto.GenerateKey()
+
+		// findnode waits for more neighbors until the response timeout
+		nodeOpts := []BackendOption{WithRespTimeout(500 * time.Millisecond)}
+		if opts != nil {
+			nodeOpts = append(nodeOpts, opts(i, key, tr.Addr())...)
+		}
+		nodes = append(nodes, newTestDiscoveryWithKey(t, key, tr, false, nodeOpts...))
+	}
+	for i, a := range nodes {
+		for _, b := range nodes[i+1:] {
+			bond(a, b)
+		}
+	}
+	nodes[0].updatePeer(nodes[1].local)
+	for _, a := range nodes[1:] {
+		for _, b := range nodes[1:] {
+			if a != b {
+				a.updatePeer(b.local)
+			}
+		}
+	}
+	nodes[0].active = true
+	return nodes
+}
+
+func TestLookup_AddNodes(t *testing.T) {
+	b := newTestDiscovery(t, NewMockNetwork().NewTransport(), false)
+
+	peers := []*Peer{b.local}
+	for i := 0; i < 2*bucketSize; i++ {
+		peers = append(peers, newRandomPeer(t))
+	}
+	// duplicated nodes are ignored
+	peers = append(peers, peers[1])
+
+	l := newLookup(b, newRandomPeer(t).Bytes)
+	l.addNodes(peers)
+
+	assert.Len(t, l.result, bucketSize)
+	for i, e := range l.result {
+		assert.NotEqual(t, b.local.ID, e.peer.ID)
+		if i > 0 {
+			assert.Equal(t, -1, distCmp(l.hash, l.result[i-1].hash, e.hash))
+		}
+	}
+}
+
+func TestLookup_Target(t *testing.T) {
+	nodes := lookupNetwork(t, 8, nil)
+	target := nodes[5].local
+
+	res, err := nodes[0].LookupTarget(context.Background(), target.Bytes)
+	assert.NoError(t, err)
+	assert.Len(t, res, len(nodes)-1)
+	assert.Equal(t, target.ID, res[0].ID)
+
+	hash := nodeHash(target.Bytes)
+	for i := 1; i < len(res); i++ {
+		assert.Equal(t, -1, distCmp(hash, nodeHash(res[i-1].Bytes), nodeHash(res[i].Bytes)))
+	}
+}
+
+func TestLookup_Concurrent(t *testing.T) {
+	nodes := lookupNetwork(t, 8, nil)
+
+	var wg sync.WaitGroup
+	for _, n := range nodes[2:5] {
+		wg.Add(1)
+		go func(target *Peer) {
+			defer wg.Done()
+
+			res, err := nodes[0].LookupTarget(context.Background(), target.Bytes)
+			assert.NoError(t, err)
+			if assert.NotEmpty(t, res) {
+				assert.Equal(t, target.ID, res[0].ID)
+			}
+		}(n.local)
+	}
+	wg.Wait()
+}
+
+func TestLookup_Cancel(t *testing.T) {
+	r0, _ := pipe(t, true)
+	r0.active = true
+
+	// unreachable peer bonded with r0
+	peer := newRandomPeer(t)
+	r0.updatePeer(peer)
+	r0.updateNodeDB(peer, func(n *NodeEntry) {
+		n.LastPing = time.Now()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := r0.LookupTarget(ctx, peer.Bytes)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestSetHandler_Concurrent(t *testing.T) {
+	r0, _ := pipe(t, true)
+
+	ack0 := make(chan respMessage, 1)
+	cancel0 := r0.setHandler("a", neighborsPacket, ack0, time.Second)
+	ack1 := make(chan respMessage, 1)
+	cancel1 := r0.setHandler("a", neighborsPacket, ack1, time.Second)
+
+	// the responses go to the oldest request with room
+	assert.True(t, r0.deliver("a", neighborsPacket, []byte{0x1}, nil))
+	assert.True(t, r0.deliver("a", neighborsPacket, []byte{0x2}, nil))
+	assert.Equal(t, []byte{0x1}, (<-ack0).Payload)
+	assert.Equal(t, []byte{0x2}, (<-ack1).Payload)
+
+	cancel0()
+	assert.True(t, r0.deliver("a", neighborsPacket, []byte{0x3}, nil))
+	assert.Equal(t, []byte{0x3}, (<-ack1).Payload)
+
+	cancel1()
+	assert.False(t, r0.deliver("a", neighborsPacket, []byte{0x4}, nil))
+
+	// the channel is closed once the handler expires
+	ack2 := make(chan respMessage, 1)
+	r0.setHandler("a", pingPacket, ack2, 50*time.Millisecond)
+	select {
+	case resp := <-ack2:
+		assert.False(t, resp.Complete)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.False(t, r0.deliver("a", pingPacket, nil, nil))
+}
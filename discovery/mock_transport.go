@@ -2,27 +2,84 @@ package discovery
 
 import (
 	"fmt"
+	"math/rand"
 	"net"
+	"sync"
 	"time"
 )
 
 // Based on https://github.com/hashicorp/memberlist/blob/master/mock_transport.go
 
-// MockNetwork mocks a network of peers
+// LinkConfig are the conditions of the packets sent between two transports
+type LinkConfig struct {
+	// Latency is the minimum delay of the packets
+	Latency time.Duration
+
+	// Jitter is a random delay between 0 and Jitter added to the latency.
+	// Packets sent close in time might arrive out of order.
+	Jitter time.Duration
+
+	// Loss is the probability of a packet to be dropped (0 to 1)
+	Loss float64
+
+	// Duplicate is the probability of a packet to be delivered twice (0 to 1)
+	Duplicate float64
+}
+
+// MockNetwork mocks a network of peers. By default the packets are delivered
+// instantly and reliably, the conditions of the links can be set with SetLink.
+// The zero value is ready to use.
 type MockNetwork struct {
+	lock       sync.Mutex
 	transports map[string]*MockTransport
 	port       int
+
+	// link conditions
+	defaultLink *LinkConfig
+	links       map[linkKey]*LinkConfig
+	rand        *rand.Rand
+
+	// nat maps the internal address of a transport to its external address
+	nat map[string]*net.UDPAddr
+
+	// partitioned are the links that do not deliver packets
+	partitioned map[linkKey]struct{}
 }
 
-func newMockNetwork() *MockNetwork {
-	return &MockNetwork{
-		transports: map[string]*MockTransport{},
-		port:       0,
+// linkKey is a directional link between two addresses
+type linkKey struct {
+	from, to string
+}
+
+// NewMockNetwork creates a new mock network
+func NewMockNetwork() *MockNetwork {
+	return &MockNetwork{}
+}
+
+func (m *MockNetwork) init() {
+	if m.transports == nil {
+		m.transports = map[string]*MockTransport{}
+	}
+	if m.links == nil {
+		m.links = map[linkKey]*LinkConfig{}
+	}
+	if m.nat == nil {
+		m.nat = map[string]*net.UDPAddr{}
+	}
+	if m.partitioned == nil {
+		m.partitioned = map[linkKey]struct{}{}
+	}
+	if m.rand == nil {
+		m.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 	}
 }
 
 // NewTransport creates a new mockup transport
 func (m *MockNetwork) NewTransport() Transport {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init()
 	m.port++
 	addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: int(m.port)}
 
@@ -31,13 +88,155 @@ func (m *MockNetwork) NewTransport() Transport {
 		addr:     addr,
 		packetCh: make(chan *Packet, 10),
 	}
-	if m.transports == nil {
-		m.transports = make(map[string]*MockTransport)
-	}
 	m.transports[addr.String()] = t
 	return t
 }
 
+// SetSeed sets the seed of the random source used for the link conditions
+func (m *MockNetwork) SetSeed(seed int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.rand = rand.New(rand.NewSource(seed))
+}
+
+// SetDefaultLink sets the conditions of the links without a specific config
+func (m *MockNetwork) SetDefaultLink(config *LinkConfig) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.defaultLink = config
+}
+
+// SetLink sets the conditions of the link between two transports
+// in both directions. A nil config uses the default conditions.
+func (m *MockNetwork) SetLink(a, b Transport, config *LinkConfig) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init()
+	for _, k := range links(a, b) {
+		if config == nil {
+			delete(m.links, k)
+		} else {
+			m.links[k] = config
+		}
+	}
+}
+
+// SetNAT makes the packets of the transport come from the external address and
+// routes the packets sent to the external address to the transport. A nil
+// address removes the translation.
+func (m *MockNetwork) SetNAT(t Transport, external *net.UDPAddr) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init()
+	if external == nil {
+		delete(m.nat, t.Addr().String())
+	} else {
+		m.nat[t.Addr().String()] = external
+	}
+}
+
+// Partition drops the packets between the two transports until the link is healed
+func (m *MockNetwork) Partition(a, b Transport) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init()
+	for _, k := range links(a, b) {
+		m.partitioned[k] = struct{}{}
+	}
+}
+
+// Heal restores the link between the two transports
+func (m *MockNetwork) Heal(a, b Transport) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, k := range links(a, b) {
+		delete(m.partitioned, k)
+	}
+}
+
+// HealAll restores all the partitioned links
+func (m *MockNetwork) HealAll() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.partitioned = map[linkKey]struct{}{}
+}
+
+func links(a, b Transport) []linkKey {
+	x, y := a.Addr().String(), b.Addr().String()
+	return []linkKey{{x, y}, {y, x}}
+}
+
+// route returns the destination of a packet, the address the packet comes
+// from and the delays of the copies to deliver (none if it is dropped)
+func (m *MockNetwork) route(from *MockTransport, addr string) (*MockTransport, *net.UDPAddr, []time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init()
+	dest, ok := m.transports[addr]
+	if !ok {
+		// the address might be the external address of a transport
+		for internal, external := range m.nat {
+			if external.String() == addr {
+				dest, ok = m.transports[internal], true
+				break
+			}
+		}
+	}
+	if !ok || dest == nil {
+		return nil, nil, nil, fmt.Errorf("no route to %q", addr)
+	}
+
+	src := from.addr
+	if external, ok := m.nat[src.String()]; ok {
+		src = external
+	}
+
+	key := linkKey{from.addr.String(), dest.addr.String()}
+	if _, ok := m.partitioned[key]; ok {
+		return dest, src, nil, nil
+	}
+
+	config, ok := m.links[key]
+	if !ok {
+		config = m.defaultLink
+	}
+	if config == nil {
+		return dest, src, []time.Duration{0}, nil
+	}
+	if m.rand.Float64() < config.Loss {
+		return dest, src, nil, nil
+	}
+	copies := 1
+	if m.rand.Float64() < config.Duplicate {
+		copies++
+	}
+	delays := []time.Duration{}
+	for i := 0; i < copies; i++ {
+		delay := config.Latency
+		if config.Jitter > 0 {
+			delay += time.Duration(m.rand.Int63n(int64(config.Jitter)))
+		}
+		delays = append(delays, delay)
+	}
+	return dest, src, delays, nil
+}
+
+// removeTransport removes a closed transport from the network
+func (m *MockNetwork) removeTransport(t *MockTransport) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.transports, t.addr.String())
+}
+
 // MockTransport mocks a udp transport
 type MockTransport struct {
 	net      *MockNetwork
@@ -57,20 +256,34 @@ func (m *MockTransport) PacketCh() chan *Packet {
 
 // WriteTo implements the transport interface
 func (m *MockTransport) WriteTo(b []byte, addr string) (time.Time, error) {
-	dest, ok := m.net.transports[addr]
-	if !ok {
-		return time.Time{}, fmt.Errorf("no route to %q", addr)
+	dest, src, delays, err := m.net.route(m, addr)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	now := time.Now()
-	dest.packetCh <- &Packet{
-		Buf:       b,
-		From:      m.addr,
-		Timestamp: now,
+	for _, delay := range delays {
+		if delay == 0 {
+			dest.packetCh <- &Packet{
+				Buf:       b,
+				From:      src,
+				Timestamp: now,
+			}
+			continue
+		}
+		time.AfterFunc(delay, func() {
+			// the packet is dropped if the receive buffer is full
+			select {
+			case dest.packetCh <- &Packet{Buf: b, From: src, Timestamp: time.Now()}:
+			default:
+			}
+		})
 	}
 	return now, nil
 }
 
-// Shutdown implements the transport interface
+// Shutdown implements the transport interface. The
+// transport does not receive packets anymore.
 func (m *MockTransport) Shutdown() {
+	m.net.removeTransport(m)
 }
@@ -0,0 +1,210 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+)
+
+func readPacket(t *testing.T, tr Transport, timeout time.Duration) *Packet {
+	select {
+	case p := <-tr.PacketCh():
+		return p
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestMockNetwork_Link(t *testing.T) {
+	network := NewMockNetwork()
+	network.SetSeed(1)
+
+	t0 := network.NewTransport()
+	t1 := network.NewTransport()
+
+	// the packets are lost
+	network.SetLink(t0, t1, &LinkConfig{Loss: 1})
+	_, err := t0.WriteTo([]byte{0x1}, t1.Addr().String())
+	assert.NoError(t, err)
+	assert.Nil(t, readPacket(t, t1, 50*time.Millisecond))
+
+	// the packets are delayed and duplicated
+	network.SetLink(t0, t1, &LinkConfig{Latency: 100 * time.Millisecond, Duplicate: 1})
+	now := time.Now()
+	_, err = t1.WriteTo([]byte{0x2}, t0.Addr().String())
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		p := readPacket(t, t0, time.Second)
+		if assert.NotNil(t, p) {
+			assert.Equal(t, []byte{0x2}, p.Buf)
+			assert.True(t, p.Timestamp.Sub(now) >= 100*time.Millisecond)
+		}
+	}
+
+	// the default conditions are used without a specific config
+	network.SetLink(t0, t1, nil)
+	network.SetDefaultLink(&LinkConfig{Loss: 1})
+	_, err = t0.WriteTo([]byte{0x3}, t1.Addr().String())
+	assert.NoError(t, err)
+	assert.Nil(t, readPacket(t, t1, 50*time.Millisecond))
+}
+
+func TestMockNetwork_Partition(t *testing.T) {
+	network := NewMockNetwork()
+
+	t0 := network.NewTransport()
+	t1 := network.NewTransport()
+	t2 := network.NewTransport()
+
+	network.Partition(t0, t1)
+	_, err := t0.WriteTo([]byte{0x1}, t1.Addr().String())
+	assert.NoError(t, err)
+	assert.Nil(t, readPacket(t, t1, 50*time.Millisecond))
+
+	// other links are not affected
+	_, err = t0.WriteTo([]byte{0x1}, t2.Addr().String())
+	assert.NoError(t, err)
+	assert.NotNil(t, readPacket(t, t2, time.Second))
+
+	network.Heal(t0, t1)
+	_, err = t1.WriteTo([]byte{0x1}, t0.Addr().String())
+	assert.NoError(t, err)
+	assert.NotNil(t, readPacket(t, t0, time.Second))
+
+	// a closed transport is not reachable
+	t1.Shutdown()
+	_, err = t0.WriteTo([]byte{0x1}, t1.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestMockNetwork_NAT(t *testing.T) {
+	network := NewMockNetwork()
+
+	t0 := network.NewTransport()
+	t1 := network.NewTransport()
+
+	external := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 40000}
+	network.SetNAT(t0, external)
+
+	// the packets come from the external address
+	_, err := t0.WriteTo([]byte{0x1}, t1.Addr().String())
+	assert.NoError(t, err)
+	p := readPacket(t, t1, time.Second)
+	if assert.NotNil(t, p) {
+		assert.Equal(t, external.String(), p.From.String())
+	}
+
+	// and the replies to the external address are routed back
+	_, err = t1.WriteTo([]byte{0x2}, external.String())
+	assert.NoError(t, err)
+	assert.NotNil(t, readPacket(t, t0, time.Second))
+}
+
+func TestMockNetwork_Revalidate(t *testing.T) {
+	network := NewMockNetwork()
+	t0, t1 := network.NewTransport(), network.NewTransport()
+
+	r0 := newTestDiscovery(t, t0, false, WithRespTimeout(200*time.Millisecond))
+	r1 := newTestDiscovery(t, t1, false)
+
+	peer, err := newPeer(r1.local.ID, r1.local.UDPAddr, 0)
+	assert.NoError(t, err)
+
+	// the probe fails while the nodes are partitioned
+	network.Partition(t0, t1)
+	assert.False(t, r0.probeNode(peer))
+
+	network.Heal(t0, t1)
+	assert.True(t, r0.probeNode(peer))
+
+	// a slow link within the response timeout
+	network.SetLink(t0, t1, &LinkConfig{Latency: 20 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	assert.True(t, r0.probeNode(peer))
+}
+
+func TestMockNetwork_LookupLatency(t *testing.T) {
+	network := NewMockNetwork()
+	network.SetSeed(1)
+
+	// the packets are delayed, some of them duplicated and out of order
+	network.SetDefaultLink(&LinkConfig{Latency: 10 * time.Millisecond, Jitter: 20 * time.Millisecond, Duplicate: 0.2})
+
+	nodes := lookupNetworkOn(t, network, 6, nil)
+	target := nodes[4].local
+
+	res, err := nodes[0].LookupTarget(context.Background(), target.Bytes)
+	assert.NoError(t, err)
+	assert.Len(t, res, len(nodes)-1)
+	assert.Equal(t, target.ID, res[0].ID)
+}
+
+func TestMockNetwork_LookupLoss(t *testing.T) {
+	network := NewMockNetwork()
+	nodes := lookupNetworkOn(t, network, 6, nil)
+
+	// the packets between the first node and the third one are lost
+	network.SetLink(nodes[0].transport, nodes[2].transport, &LinkConfig{Loss: 1})
+
+	target := nodes[4].local
+	res, err := nodes[0].LookupTarget(context.Background(), target.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, target.ID, res[0].ID)
+
+	// the query to the unreachable node failed
+	n, ok := nodes[0].db.Node(nodes[2].local.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 1, n.FindFails)
+}
+
+func TestMockNetwork_LookupNAT(t *testing.T) {
+	network := NewMockNetwork()
+
+	// r0 is behind a nat
+	t0 := network.NewTransport()
+	external := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 40000}
+	network.SetNAT(t0, external)
+
+	key, _ := crypto.GenerateKey()
+	localNode, err := enode.NewLocalNode(key, nil)
+	assert.NoError(t, err)
+	r0 := newTestDiscoveryWithKey(t, key, t0, false, WithLocalNode(localNode), WithRespTimeout(500*time.Millisecond))
+
+	// enough nodes for the local node to predict the ip with their pongs
+	others := []*Backend{}
+	for i := 0; i < 10; i++ {
+		others = append(others, newTestDiscovery(t, network.NewTransport(), false, WithRespTimeout(500*time.Millisecond)))
+	}
+	for _, o := range others {
+		assert.True(t, r0.probeNode(o.local))
+	}
+
+	// the record has the external ip reported in the pongs
+	assert.True(t, localNode.IP().Equal(external.IP))
+
+	// the other nodes bond back with r0 on its external endpoint
+	assert.Eventually(t, func() bool {
+		for _, o := range others {
+			p, ok := o.getPeer(r0.local.ID)
+			if !ok || p.UDPAddr.String() != external.String() || o.hasExpired(p) {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// and answer its queries through the nat
+	r0.active = true
+	target := others[1].local
+	res, err := r0.LookupTarget(context.Background(), target.Bytes)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, res) {
+		assert.Equal(t, target.ID, res[0].ID)
+	}
+	n, _ := r0.db.Node(target.ID)
+	assert.Equal(t, 0, n.FindFails)
+}
@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"net"
+	"strings"
+)
+
+// Netlist is a list of ip networks
+type Netlist []*net.IPNet
+
+// ParseNetlist parses a comma separated list of networks in CIDR notation
+func ParseNetlist(s string) (Netlist, error) {
+	list := Netlist{}
+	for _, str := range strings.Split(s, ",") {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(str)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+// Contains returns true if the ip belongs to any of the networks
+func (l Netlist) Contains(ip net.IP) bool {
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// String implements the stringer interface
+func (l Netlist) String() string {
+	strs := []string{}
+	for _, n := range l {
+		strs = append(strs, n.String())
+	}
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetlist(t *testing.T) {
+	list, err := ParseNetlist("10.0.0.0/8, 192.168.1.0/24,fd00::/8")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8,192.168.1.0/24,fd00::/8", list.String())
+
+	assert.True(t, list.Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, list.Contains(net.ParseIP("192.168.1.10")))
+	assert.True(t, list.Contains(net.ParseIP("fd00::1")))
+	assert.False(t, list.Contains(net.ParseIP("192.168.2.10")))
+	assert.False(t, list.Contains(net.ParseIP("1.1.1.1")))
+
+	_, err = ParseNetlist("10.0.0.0")
+	assert.Error(t, err)
+}
+
+func TestNetRestrict(t *testing.T) {
+	network := NewMockNetwork()
+	t0, t1 := network.NewTransport(), network.NewTransport()
+
+	r0 := newTestDiscovery(t, t0, false, WithRespTimeout(200*time.Millisecond))
+	r1 := newTestDiscovery(t, t1, false)
+
+	peer, err := newPeer(r1.local.ID, r1.local.UDPAddr, 0)
+	assert.NoError(t, err)
+
+	// r1 drops the packets from outside of the allowed networks
+	list, _ := ParseNetlist("10.0.0.0/8")
+	r1.SetNetRestrict(list)
+
+	assert.False(t, r0.probeNode(peer))
+
+	list, _ = ParseNetlist("127.0.0.0/8")
+	r1.SetNetRestrict(list)
+	assert.True(t, r0.probeNode(peer))
+}
@@ -0,0 +1,277 @@
+package discovery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// nodeDBExpiration is the time after which a node not seen is removed from the database
+	nodeDBExpiration = 24 * time.Hour
+
+	// nodeDBCleanupInterval is the interval to remove the expired nodes
+	nodeDBCleanupInterval = 1 * time.Hour
+
+	// nodeDBFlushInterval is the interval to write the nodes to disk
+	nodeDBFlushInterval = 5 * time.Minute
+
+	// seedCount is the number of nodes from the database used to seed the table
+	seedCount = 30
+
+	// seedMaxAge is the maximum age of a node in the database to seed the table.
+	// The database might have expired nodes if it was just loaded from disk.
+	seedMaxAge = nodeDBExpiration
+
+	// maxUnbondedNodes is the maximum number of nodes in the database that never
+	// answered a ping. Any node id can ping us, the new nodes are not stored above
+	// the limit so that the database does not grow without bound.
+	maxUnbondedNodes = 1000
+)
+
+// NodeEntry is a node stored in the node database
+type NodeEntry struct {
+	// ID is the hex encoded public key of the node
+	ID string
+
+	// IP, UDP and TCP are the endpoint of the node
+	IP  net.IP
+	UDP uint16
+	TCP uint16
+
+	// LastPing is the last time we received a ping from the node
+	LastPing time.Time
+
+	// LastPong is the last time we received a pong from the node
+	LastPong time.Time
+
+	// FindFails is the number of consecutive findnode requests without response
+	FindFails int
+
+	// Record is the text form of the node record (ENR), if known
+	Record string
+}
+
+func (n *NodeEntry) copy() *NodeEntry {
+	nn := new(NodeEntry)
+	*nn = *n
+	return nn
+}
+
+// bonded returns true if the node answered a ping
+func (n *NodeEntry) bonded() bool {
+	return !n.LastPong.IsZero()
+}
+
+// lastSeen returns the last time the node was seen
+func (n *NodeEntry) lastSeen() time.Time {
+	if n.LastPing.After(n.LastPong) {
+		return n.LastPing
+	}
+	return n.LastPong
+}
+
+// NodeDB stores the nodes found by the discovery protocol
+type NodeDB interface {
+	// Node returns a node
+	Node(id string) (*NodeEntry, bool)
+
+	// UpdateNode adds or replaces a node
+	UpdateNode(node *NodeEntry) error
+
+	// DeleteNode removes a node
+	DeleteNode(id string) error
+
+	// QuerySeeds returns up to n nodes with an endpoint that answered a ping
+	// in the last maxAge, the most recently bonded nodes first
+	QuerySeeds(n int, maxAge time.Duration) []*NodeEntry
+
+	// Expire removes the nodes not seen since maxAge
+	Expire(maxAge time.Duration) error
+
+	// Flush writes the nodes to the persistent storage, if any
+	Flush() error
+
+	// Close closes the database
+	Close() error
+}
+
+// MemoryNodeDB is a NodeDB that keeps the nodes in memory
+type MemoryNodeDB struct {
+	lock  sync.Mutex
+	nodes map[string]*NodeEntry
+
+	// unbonded is the number of nodes that never answered a ping
+	unbonded int
+}
+
+var _ NodeDB = (*MemoryNodeDB)(nil)
+
+// NewMemoryNodeDB creates an in-memory NodeDB
+func NewMemoryNodeDB() *MemoryNodeDB {
+	return &MemoryNodeDB{
+		nodes: map[string]*NodeEntry{},
+	}
+}
+
+// Node implements the NodeDB interface
+func (m *MemoryNodeDB) Node(id string) (*NodeEntry, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	n, ok := m.nodes[id]
+	if !ok {
+		return nil, false
+	}
+	return n.copy(), true
+}
+
+// UpdateNode implements the NodeDB interface. Nodes that never answered
+// a ping are dropped if there are already maxUnbondedNodes of them.
+func (m *MemoryNodeDB) UpdateNode(node *NodeEntry) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	old, ok := m.nodes[node.ID]
+	if !node.bonded() && (!ok || old.bonded()) && m.unbonded >= maxUnbondedNodes {
+		return nil
+	}
+	if ok {
+		m.delete(node.ID)
+	}
+	m.nodes[node.ID] = node.copy()
+	if !node.bonded() {
+		m.unbonded++
+	}
+	return nil
+}
+
+// DeleteNode implements the NodeDB interface
+func (m *MemoryNodeDB) DeleteNode(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.delete(id)
+	return nil
+}
+
+func (m *MemoryNodeDB) delete(id string) {
+	node, ok := m.nodes[id]
+	if !ok {
+		return
+	}
+	if !node.bonded() {
+		m.unbonded--
+	}
+	delete(m.nodes, id)
+}
+
+// QuerySeeds implements the NodeDB interface
+func (m *MemoryNodeDB) QuerySeeds(n int, maxAge time.Duration) []*NodeEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+
+	res := []*NodeEntry{}
+	for _, node := range m.nodes {
+		if !node.bonded() || node.IP == nil || node.UDP == 0 {
+			continue
+		}
+		if now.Sub(node.LastPong) < maxAge {
+			res = append(res, node.copy())
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].LastPong.After(res[j].LastPong)
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// Expire implements the NodeDB interface
+func (m *MemoryNodeDB) Expire(maxAge time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	for id, node := range m.nodes {
+		if now.Sub(node.lastSeen()) > maxAge {
+			m.delete(id)
+		}
+	}
+	return nil
+}
+
+// Flush implements the NodeDB interface
+func (m *MemoryNodeDB) Flush() error {
+	return nil
+}
+
+// Close implements the NodeDB interface
+func (m *MemoryNodeDB) Close() error {
+	return nil
+}
+
+// JSONNodeDB stores the nodes locally in json format. The nodes are
+// loaded on creation and written to disk on flush and on close.
+type JSONNodeDB struct {
+	*MemoryNodeDB
+	path string
+}
+
+var _ NodeDB = (*JSONNodeDB)(nil)
+
+// NewJSONNodeDB creates a json NodeDB
+func NewJSONNodeDB(path string) (*JSONNodeDB, error) {
+	j := &JSONNodeDB{
+		MemoryNodeDB: NewMemoryNodeDB(),
+		path:         filepath.Join(path, "nodes.json"),
+	}
+	if _, err := os.Stat(j.path); os.IsNotExist(err) {
+		return j, nil
+	}
+
+	data, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.nodes); err != nil {
+		return nil, err
+	}
+	for _, node := range j.nodes {
+		if !node.bonded() {
+			j.unbonded++
+		}
+	}
+	return j, nil
+}
+
+// Flush implements the NodeDB interface. The nodes are written
+// to a temporary file first so that a crash does not corrupt them.
+func (j *JSONNodeDB) Flush() error {
+	j.lock.Lock()
+	data, err := json.MarshalIndent(j.nodes, "", "    ")
+	j.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// Close implements the NodeDB interface
+func (j *JSONNodeDB) Close() error {
+	return j.Flush()
+}
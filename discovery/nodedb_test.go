@@ -0,0 +1,108 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeDB_QuerySeeds(t *testing.T) {
+	db := NewMemoryNodeDB()
+	now := time.Now()
+	ip := net.ParseIP("127.0.0.1")
+
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "a", IP: ip, UDP: 30303, LastPong: now.Add(-1 * time.Hour)}))
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "b", IP: ip, UDP: 30303, LastPong: now.Add(-2 * time.Hour), LastPing: now.Add(-1 * time.Minute)}))
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "c", IP: ip, UDP: 30303, LastPong: now.Add(-10 * time.Hour)}))
+
+	// nodes that never answered a ping or without endpoint are not seeds
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "d", IP: ip, UDP: 30303, LastPing: now}))
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "e", LastPong: now}))
+
+	seeds := db.QuerySeeds(10, 5*time.Hour)
+	assert.Len(t, seeds, 2)
+	assert.Equal(t, "a", seeds[0].ID)
+	assert.Equal(t, "b", seeds[1].ID)
+
+	seeds = db.QuerySeeds(1, 5*time.Hour)
+	assert.Len(t, seeds, 1)
+
+	assert.NoError(t, db.Expire(5*time.Hour))
+	_, ok := db.Node("c")
+	assert.False(t, ok)
+}
+
+func TestNodeDB_MaxUnbonded(t *testing.T) {
+	defer func(n int) {
+		maxUnbondedNodes = n
+	}(maxUnbondedNodes)
+	maxUnbondedNodes = 2
+
+	db := NewMemoryNodeDB()
+	now := time.Now()
+
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, db.UpdateNode(&NodeEntry{ID: id, LastPing: now}))
+	}
+	_, ok := db.Node("c")
+	assert.False(t, ok)
+
+	// the known nodes are still updated and bonded nodes are always stored
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "b", LastPing: now.Add(time.Minute)}))
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "d", LastPong: now}))
+	_, ok = db.Node("d")
+	assert.True(t, ok)
+
+	// there is room again once one of them bonds
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "a", LastPing: now, LastPong: now}))
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "c", LastPing: now}))
+	_, ok = db.Node("c")
+	assert.True(t, ok)
+}
+
+func TestNodeDB_JSON(t *testing.T) {
+	path := t.TempDir()
+
+	db, err := NewJSONNodeDB(path)
+	assert.NoError(t, err)
+
+	entry := &NodeEntry{
+		ID:        "a",
+		IP:        net.ParseIP("127.0.0.1"),
+		UDP:       30303,
+		TCP:       30303,
+		LastPong:  time.Now().Round(0),
+		FindFails: 1,
+		Record:    "enr:-",
+	}
+	assert.NoError(t, db.UpdateNode(entry))
+	assert.NoError(t, db.Close())
+
+	db, err = NewJSONNodeDB(path)
+	assert.NoError(t, err)
+
+	found, ok := db.Node("a")
+	assert.True(t, ok)
+	assert.True(t, entry.LastPong.Equal(found.LastPong))
+	found.LastPong = entry.LastPong
+	assert.Equal(t, entry, found)
+}
+
+func TestNodeDB_JSONFlush(t *testing.T) {
+	path := t.TempDir()
+
+	db, err := NewJSONNodeDB(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.UpdateNode(&NodeEntry{ID: "a", LastPong: time.Now()}))
+	assert.NoError(t, db.Flush())
+
+	// the nodes are on disk without closing the database
+	db2, err := NewJSONNodeDB(path)
+	assert.NoError(t, err)
+
+	_, ok := db2.Node("a")
+	assert.True(t, ok)
+}
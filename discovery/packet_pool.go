@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"sync"
+)
+
+// PacketPool handles the incoming packets with a fixed number of goroutines.
+// Packets that arrive with the queue full are dropped.
+type PacketPool struct {
+	queue     chan *Packet
+	handler   func(*Packet)
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPacketPool starts 'workers' goroutines that handle the packets
+// with the handler. At most 'queueSize' packets wait to be handled.
+func NewPacketPool(workers, queueSize int, handler func(*Packet)) *PacketPool {
+	p := &PacketPool{
+		queue:   make(chan *Packet, queueSize),
+		handler: handler,
+		closeCh: make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *PacketPool) run() {
+	for {
+		select {
+		case packet := <-p.queue:
+			p.handler(packet)
+		case <-p.closeCh:
+			return
+		}
+	}
+}
+
+// Dispatch queues the packet to be handled. It returns
+// false if the packet is dropped because the queue is full.
+func (p *PacketPool) Dispatch(packet *Packet) bool {
+	select {
+	case p.queue <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the goroutines of the pool
+func (p *PacketPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closeCh)
+	})
+}
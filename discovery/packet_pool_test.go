@@ -0,0 +1,41 @@
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketPool_Bounded(t *testing.T) {
+	block := make(chan struct{})
+	handled := make(chan *Packet, 10)
+
+	p := NewPacketPool(2, 3, func(packet *Packet) {
+		<-block
+		handled <- packet
+	})
+	defer p.Close()
+
+	// two packets are being handled and three wait in the queue
+	for i := 0; i < 5; i++ {
+		assert.Eventually(t, func() bool {
+			return p.Dispatch(&Packet{})
+		}, time.Second, 10*time.Millisecond)
+	}
+	assert.Eventually(t, func() bool {
+		return len(p.queue) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	// the queue is full
+	assert.False(t, p.Dispatch(&Packet{}))
+
+	close(block)
+	for i := 0; i < 5; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
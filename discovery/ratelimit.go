@@ -0,0 +1,130 @@
+package discovery
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ipLimiterExpiration is the time after which the bucket of an
+// ip without packets is removed
+const ipLimiterExpiration = 1 * time.Minute
+
+// maxIPBuckets is the maximum number of ips tracked by the limiter
+var maxIPBuckets = 10000
+
+// TokenBucket is a rate limiter that allows 'rate' events
+// per second with bursts of up to 'burst' events
+type TokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket that starts full
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Allow returns true if there is a token available and consumes it
+func (t *TokenBucket) Allow(now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// refill the tokens since the last event
+	if !t.last.IsZero() {
+		if elapsed := now.Sub(t.last).Seconds(); elapsed > 0 {
+			t.tokens += elapsed * t.rate
+			if t.tokens > t.burst {
+				t.tokens = t.burst
+			}
+		}
+	}
+	t.last = now
+
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// lastSeen returns the time of the last event
+func (t *TokenBucket) lastSeen() time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.last
+}
+
+// IPRateLimiter limits the rate of packets of each source ip
+// with a token bucket per ip
+type IPRateLimiter struct {
+	lock    sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*TokenBucket
+	last    time.Time
+}
+
+// NewIPRateLimiter creates a limiter that allows 'rate' packets per
+// second for each ip with bursts of up to 'burst' packets
+func NewIPRateLimiter(rate float64, burst int) *IPRateLimiter {
+	return &IPRateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: map[string]*TokenBucket{},
+		last:    time.Now(),
+	}
+}
+
+// Allow returns true if the ip has a token available and consumes it
+func (l *IPRateLimiter) Allow(ip net.IP, now time.Time) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.last) > ipLimiterExpiration {
+		l.cleanup(now)
+	}
+
+	key := ip.String()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIPBuckets {
+			l.cleanup(now)
+			l.evict()
+		}
+		b = NewTokenBucket(l.rate, l.burst)
+		l.buckets[key] = b
+	}
+	return b.Allow(now)
+}
+
+// cleanup removes the buckets of the ips that have not sent
+// packets recently, a full bucket is the same as a new one
+func (l *IPRateLimiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen()) > ipLimiterExpiration {
+			delete(l.buckets, key)
+		}
+	}
+	l.last = now
+}
+
+// evict removes arbitrary buckets until there is room for a new one. Removing
+// a bucket only gives the ip a full bucket again, the packets of the new
+// ips are not dropped even if the packets come from many (spoofed) ips.
+func (l *IPRateLimiter) evict() {
+	for key := range l.buckets {
+		if len(l.buckets) < maxIPBuckets {
+			return
+		}
+		delete(l.buckets, key)
+	}
+}
@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPRateLimiter(t *testing.T) {
+	l := NewIPRateLimiter(10, 5)
+
+	ip0 := net.ParseIP("1.1.1.1")
+	ip1 := net.ParseIP("2.2.2.2")
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.True(t, l.Allow(ip0, now))
+	}
+	// the burst is consumed
+	assert.False(t, l.Allow(ip0, now))
+
+	// other ips have their own bucket
+	assert.True(t, l.Allow(ip1, now))
+
+	// the tokens refill with the rate
+	now = now.Add(200 * time.Millisecond)
+	assert.True(t, l.Allow(ip0, now))
+	assert.True(t, l.Allow(ip0, now))
+	assert.False(t, l.Allow(ip0, now))
+}
+
+func TestIPRateLimiter_Cleanup(t *testing.T) {
+	l := NewIPRateLimiter(10, 5)
+
+	now := time.Now()
+	assert.True(t, l.Allow(net.ParseIP("1.1.1.1"), now))
+	assert.Len(t, l.buckets, 1)
+
+	now = now.Add(2 * ipLimiterExpiration)
+	assert.True(t, l.Allow(net.ParseIP("2.2.2.2"), now))
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestIPRateLimiter_MaxBuckets(t *testing.T) {
+	defer func(n int) {
+		maxIPBuckets = n
+	}(maxIPBuckets)
+	maxIPBuckets = 10
+
+	l := NewIPRateLimiter(10, 5)
+
+	// the packets of new ips are allowed but the buckets are capped
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.Allow(net.IPv4(1, 1, 1, byte(i)), now))
+		assert.LessOrEqual(t, len(l.buckets), maxIPBuckets)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(10, 2)
+
+	now := time.Now()
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Allow(now))
+
+	// the tokens do not exceed the burst
+	now = now.Add(time.Second)
+	assert.True(t, b.Allow(now))
+	assert.True(t, b.Allow(now))
+	assert.False(t, b.Allow(now))
+}
@@ -0,0 +1,390 @@
+package discovery
+
+import (
+	"container/list"
+	"errors"
+	"math/bits"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/umbracle/go-devp2p/discovery/kademlia"
+	"golang.org/x/crypto/sha3"
+)
+
+// TableKind is the type of routing table used by the discv4 backend
+type TableKind int
+
+const (
+	// KademliaTable is a routing table that splits the buckets dynamically
+	KademliaTable TableKind = iota
+
+	// LogDistTable is a routing table with fixed log distance buckets over
+	// the keccak256 hash of the node public key. It limits the number of nodes
+	// in the same /24 ipv4 subnet or /64 ipv6 subnet.
+	LogDistTable
+)
+
+const (
+	// numLogDistBuckets is the number of buckets of the log distance table
+	numLogDistBuckets = 256
+
+	// maxTableReplacements is the maximum number of replacements in a bucket
+	maxTableReplacements = 10
+
+	// bucketIPLimit is the maximum number of nodes of a subnet in a bucket
+	bucketIPLimit = 2
+
+	// tableIPLimit is the maximum number of nodes of a subnet in the table
+	tableIPLimit = 10
+
+	// ipSubnetBits and ip6SubnetBits are the size of the ipv4 and ipv6
+	// subnets used by the ip limits. An ipv6 /64 is usually assigned
+	// to a single host or network, like an ipv4 address.
+	ipSubnetBits  = 24
+	ip6SubnetBits = 64
+)
+
+var (
+	errTableFull = errors.New("table bucket is full")
+	errIPLimit   = errors.New("ip subnet limit reached")
+)
+
+// routingTable is the table of nodes used by the discv4 backend
+type routingTable interface {
+	// update adds or refreshes the peer in the table
+	update(peer *Peer) error
+
+	// remove removes the peer from the table
+	remove(id string)
+
+	// replace removes the peer and replaces it with a peer
+	// from the replacement list, if any
+	replace(id string) (string, bool)
+
+	// nearest returns the peers closest to the target
+	nearest(target []byte, count int) []string
+
+	// leastRecent returns the least recently seen peer of a random bucket
+	leastRecent() (string, bool)
+}
+
+// newRoutingTable creates a routing table of the given kind
+func newRoutingTable(kind TableKind, local *Peer) routingTable {
+	if kind == LogDistTable {
+		return newLogDistTable(local, bucketSize)
+	}
+	return &kademliaTable{
+		RoutingTable: kademlia.NewRoutingTable(bucketSize, local.ID, 1000*time.Second, sha3.NewLegacyKeccak256()),
+	}
+}
+
+// kademliaTable is a routingTable backed by the kademlia routing table
+type kademliaTable struct {
+	*kademlia.RoutingTable
+}
+
+func (k *kademliaTable) update(peer *Peer) error {
+	_, err := k.Update(peer.ID)
+	return err
+}
+
+func (k *kademliaTable) remove(id string) {
+	k.Remove(id)
+}
+
+func (k *kademliaTable) replace(id string) (string, bool) {
+	return k.Replace(id)
+}
+
+func (k *kademliaTable) nearest(target []byte, count int) []string {
+	return k.NearestPeers(EncodeToHex(target), count)
+}
+
+func (k *kademliaTable) leastRecent() (string, bool) {
+	return k.LeastRecent()
+}
+
+// tableEntry is a node in the log distance table
+type tableEntry struct {
+	id   string
+	hash [32]byte
+	ip   net.IP
+}
+
+// logDistBucket holds the entries at the same log distance, the
+// most recently seen first
+type logDistBucket struct {
+	entries      *list.List
+	replacements *list.List
+	ips          ipSubnetSet
+}
+
+// logDistTable is a routing table with a bucket for each log distance to the
+// local node. Nodes are identified by the keccak256 hash of the public key.
+type logDistTable struct {
+	lock       sync.Mutex
+	local      [32]byte
+	bucketsize int
+	buckets    [numLogDistBuckets]*logDistBucket
+	ips        ipSubnetSet
+}
+
+func newLogDistTable(local *Peer, bucketsize int) *logDistTable {
+	t := &logDistTable{
+		local:      nodeHash(local.Bytes),
+		bucketsize: bucketsize,
+		ips:        ipSubnetSet{limit: tableIPLimit},
+	}
+	for i := range t.buckets {
+		t.buckets[i] = &logDistBucket{
+			entries:      list.New(),
+			replacements: list.New(),
+			ips:          ipSubnetSet{limit: bucketIPLimit},
+		}
+	}
+	return t
+}
+
+// nodeHash returns the hash of the public key used to compute the distances
+func nodeHash(pub []byte) (h [32]byte) {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(pub)
+	hash.Sum(h[:0])
+	return
+}
+
+// logDist returns the logarithmic distance between a and b, log2(a ^ b)
+func logDist(a, b [32]byte) int {
+	lz := 0
+	for i := range a {
+		x := a[i] ^ b[i]
+		if x == 0 {
+			lz += 8
+		} else {
+			lz += bits.LeadingZeros8(x)
+			break
+		}
+	}
+	return len(a)*8 - lz
+}
+
+// bucket returns the bucket of the hash, nil if the hash is the local node
+func (t *logDistTable) bucket(hash [32]byte) *logDistBucket {
+	d := logDist(t.local, hash)
+	if d == 0 {
+		return nil
+	}
+	return t.buckets[d-1]
+}
+
+func findEntry(l *list.List, id string) *list.Element {
+	for e := l.Front(); e != nil; e = e.Next() {
+		if e.Value.(*tableEntry).id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *logDistTable) update(peer *Peer) error {
+	entry := &tableEntry{
+		id:   peer.ID,
+		hash: nodeHash(peer.Bytes),
+		ip:   peer.UDPAddr.IP,
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	b := t.bucket(entry.hash)
+	if b == nil {
+		return nil
+	}
+	if e := findEntry(b.entries, entry.id); e != nil {
+		// the node is already in the table, move it to the front
+		// if the endpoint is still within the ip limits
+		current := e.Value.(*tableEntry)
+		if !current.ip.Equal(entry.ip) {
+			t.removeIP(b, current.ip)
+			if !t.addIP(b, entry.ip) {
+				t.addIP(b, current.ip)
+				return errIPLimit
+			}
+			current.ip = entry.ip
+		}
+		b.entries.MoveToFront(e)
+		return nil
+	}
+
+	if b.entries.Len() >= t.bucketsize {
+		// keep the node as a replacement in case any of the nodes of the bucket fails
+		if e := findEntry(b.replacements, entry.id); e != nil {
+			b.replacements.Remove(e)
+		}
+		b.replacements.PushFront(entry)
+		if b.replacements.Len() > maxTableReplacements {
+			b.replacements.Remove(b.replacements.Back())
+		}
+		return errTableFull
+	}
+	if !t.addIP(b, entry.ip) {
+		return errIPLimit
+	}
+	if e := findEntry(b.replacements, entry.id); e != nil {
+		b.replacements.Remove(e)
+	}
+	b.entries.PushFront(entry)
+	return nil
+}
+
+func (t *logDistTable) addIP(b *logDistBucket, ip net.IP) bool {
+	if !t.ips.add(ip) {
+		return false
+	}
+	if !b.ips.add(ip) {
+		t.ips.remove(ip)
+		return false
+	}
+	return true
+}
+
+func (t *logDistTable) removeIP(b *logDistBucket, ip net.IP) {
+	t.ips.remove(ip)
+	b.ips.remove(ip)
+}
+
+func (t *logDistTable) remove(id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.removeLocked(id)
+}
+
+func (t *logDistTable) removeLocked(id string) *logDistBucket {
+	for _, b := range t.buckets {
+		if e := findEntry(b.replacements, id); e != nil {
+			b.replacements.Remove(e)
+		}
+		if e := findEntry(b.entries, id); e != nil {
+			t.removeIP(b, e.Value.(*tableEntry).ip)
+			b.entries.Remove(e)
+			return b
+		}
+	}
+	return nil
+}
+
+func (t *logDistTable) replace(id string) (string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	b := t.removeLocked(id)
+	if b == nil {
+		return "", false
+	}
+	// promote the most recently seen replacement within the ip limits
+	for e := b.replacements.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*tableEntry)
+		if !t.addIP(b, entry.ip) {
+			continue
+		}
+		b.replacements.Remove(e)
+		// replacements are less active than the nodes in the bucket
+		b.entries.PushBack(entry)
+		return entry.id, true
+	}
+	return "", false
+}
+
+func (t *logDistTable) nearest(target []byte, count int) []string {
+	hash := nodeHash(target)
+
+	t.lock.Lock()
+	entries := []*tableEntry{}
+	for _, b := range t.buckets {
+		for e := b.entries.Front(); e != nil; e = e.Next() {
+			entries = append(entries, e.Value.(*tableEntry))
+		}
+	}
+	t.lock.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		for k := range hash {
+			di := entries[i].hash[k] ^ hash[k]
+			dj := entries[j].hash[k] ^ hash[k]
+			if di != dj {
+				return di < dj
+			}
+		}
+		return false
+	})
+	if len(entries) > count {
+		entries = entries[:count]
+	}
+
+	res := make([]string, len(entries))
+	for i, e := range entries {
+		res[i] = e.id
+	}
+	return res
+}
+
+func (t *logDistTable) leastRecent() (string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, i := range rand.Perm(len(t.buckets)) {
+		if back := t.buckets[i].entries.Back(); back != nil {
+			return back.Value.(*tableEntry).id, true
+		}
+	}
+	return "", false
+}
+
+// ipSubnetSet counts the ips for each /24 ipv4 subnet and /64 ipv6
+// subnet. Loopback and private addresses are not limited.
+type ipSubnetSet struct {
+	limit   int
+	subnets map[string]int
+}
+
+func ipSubnet(ip net.IP) (string, bool) {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return "", false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(ipSubnetBits, 32)).String(), true
+	}
+	return ip.Mask(net.CIDRMask(ip6SubnetBits, 128)).String(), true
+}
+
+// add adds the ip to the set if its subnet is within the limit
+func (s *ipSubnetSet) add(ip net.IP) bool {
+	subnet, ok := ipSubnet(ip)
+	if !ok {
+		return true
+	}
+	if s.subnets == nil {
+		s.subnets = map[string]int{}
+	}
+	if s.subnets[subnet] >= s.limit {
+		return false
+	}
+	s.subnets[subnet]++
+	return true
+}
+
+func (s *ipSubnetSet) remove(ip net.IP) {
+	subnet, ok := ipSubnet(ip)
+	if !ok {
+		return
+	}
+	if s.subnets[subnet] <= 1 {
+		delete(s.subnets, subnet)
+	} else {
+		s.subnets[subnet]--
+	}
+}
@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	crand "crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randTablePeer(ip string) *Peer {
+	buf := make([]byte, 64)
+	crand.Read(buf)
+	return &Peer{
+		ID:      EncodeToHex(buf),
+		Bytes:   buf,
+		UDPAddr: &net.UDPAddr{IP: net.ParseIP(ip), Port: 30303},
+	}
+}
+
+// randPeerAtDist returns a random peer at the given log distance of the table
+func randPeerAtDist(tab *logDistTable, dist int, ip string) *Peer {
+	for {
+		p := randTablePeer(ip)
+		if logDist(tab.local, nodeHash(p.Bytes)) == dist {
+			return p
+		}
+	}
+}
+
+func TestLogDist(t *testing.T) {
+	var a, b [32]byte
+	assert.Equal(t, 0, logDist(a, b))
+
+	b[31] = 1
+	assert.Equal(t, 1, logDist(a, b))
+
+	b[0] = 0x80
+	assert.Equal(t, 256, logDist(a, b))
+
+	b[0] = 0x01
+	assert.Equal(t, 249, logDist(a, b))
+}
+
+func TestLogDistTable_BucketIPLimit(t *testing.T) {
+	tab := newLogDistTable(randTablePeer("127.0.0.1"), bucketSize)
+
+	peers := []*Peer{}
+	for i := 0; i < bucketIPLimit; i++ {
+		p := randPeerAtDist(tab, 256, "1.2.3.4")
+		assert.NoError(t, tab.update(p))
+		peers = append(peers, p)
+	}
+	assert.Equal(t, errIPLimit, tab.update(randPeerAtDist(tab, 256, "1.2.3.5")))
+
+	// other subnets and buckets are accepted
+	assert.NoError(t, tab.update(randPeerAtDist(tab, 256, "1.2.4.4")))
+	assert.NoError(t, tab.update(randPeerAtDist(tab, 255, "1.2.3.4")))
+
+	// removing a node releases its subnet
+	tab.remove(peers[0].ID)
+	assert.NoError(t, tab.update(randPeerAtDist(tab, 256, "1.2.3.5")))
+}
+
+func TestLogDistTable_IP6Limit(t *testing.T) {
+	tab := newLogDistTable(randTablePeer("127.0.0.1"), bucketSize)
+
+	for i := 0; i < bucketIPLimit; i++ {
+		assert.NoError(t, tab.update(randPeerAtDist(tab, 256, "2001:db8:1:1::1")))
+	}
+	assert.Equal(t, errIPLimit, tab.update(randPeerAtDist(tab, 256, "2001:db8:1:1::2")))
+
+	// the ipv6 subnet is a /64
+	assert.NoError(t, tab.update(randPeerAtDist(tab, 256, "2001:db8:1:2::1")))
+}
+
+func TestLogDistTable_TableIPLimit(t *testing.T) {
+	tab := newLogDistTable(randTablePeer("127.0.0.1"), bucketSize)
+
+	accepted := 0
+	for dist := 256; dist > 256-tableIPLimit; dist-- {
+		if tab.update(randPeerAtDist(tab, dist, "1.2.3.4")) == nil {
+			accepted++
+		}
+	}
+	assert.Equal(t, tableIPLimit, accepted)
+	assert.Equal(t, errIPLimit, tab.update(randPeerAtDist(tab, 256-tableIPLimit, "1.2.3.4")))
+}
+
+func TestLogDistTable_PrivateIPs(t *testing.T) {
+	tab := newLogDistTable(randTablePeer("127.0.0.1"), bucketSize)
+
+	// private addresses are not limited
+	for i := 0; i < bucketSize; i++ {
+		assert.NoError(t, tab.update(randPeerAtDist(tab, 256, "127.0.0.1")))
+	}
+	assert.Equal(t, errTableFull, tab.update(randPeerAtDist(tab, 256, "10.0.0.1")))
+}
+
+func TestLogDistTable_Replace(t *testing.T) {
+	tab := newLogDistTable(randTablePeer("127.0.0.1"), bucketSize)
+
+	peers := []*Peer{}
+	for i := 0; i < bucketSize+1; i++ {
+		peers = append(peers, randPeerAtDist(tab, 256, "127.0.0.1"))
+	}
+	for _, p := range peers[:bucketSize] {
+		assert.NoError(t, tab.update(p))
+	}
+
+	// the last peer is kept as a replacement
+	assert.Equal(t, errTableFull, tab.update(peers[bucketSize]))
+
+	// the first peer is the least recently seen
+	id, ok := tab.leastRecent()
+	assert.True(t, ok)
+	assert.Equal(t, peers[0].ID, id)
+
+	replacement, ok := tab.replace(id)
+	assert.True(t, ok)
+	assert.Equal(t, peers[bucketSize].ID, replacement)
+
+	all := tab.nearest(peers[0].Bytes, 2*bucketSize)
+	assert.Len(t, all, bucketSize)
+	assert.NotContains(t, all, peers[0].ID)
+	assert.Contains(t, all, replacement)
+
+	// no more replacements
+	_, ok = tab.replace(peers[1].ID)
+	assert.False(t, ok)
+}
+
+func TestLogDistTable_Nearest(t *testing.T) {
+	tab := newLogDistTable(randTablePeer("127.0.0.1"), bucketSize)
+
+	for i := 0; i < 50; i++ {
+		tab.update(randTablePeer("127.0.0.1"))
+	}
+
+	target := randTablePeer("127.0.0.1").Bytes
+	hash := nodeHash(target)
+
+	res := tab.nearest(target, 10)
+	assert.Len(t, res, 10)
+
+	for i := 1; i < len(res); i++ {
+		a, _ := DecodeHex(res[i-1])
+		b, _ := DecodeHex(res[i])
+		ha, hb := nodeHash(a), nodeHash(b)
+		for k := range hash {
+			da, db := ha[k]^hash[k], hb[k]^hash[k]
+			if da != db {
+				assert.True(t, da < db)
+				break
+			}
+		}
+	}
+}
+
+func TestBackend_LogDistTable(t *testing.T) {
+	r0, r1 := pipe(t, true, WithTable(LogDistTable))
+
+	testProbeNode(t, r0, r1)
+
+	peers, err := r0.NearestPeers()
+	assert.NoError(t, err)
+	assert.Len(t, peers, 1)
+	assert.Equal(t, r1.local.ID, peers[0].ID)
+}
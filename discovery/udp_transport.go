@@ -1,41 +1,56 @@
 package discovery
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"sync/atomic"
 	"time"
 )
 
-// UDPTransport implements the UDP Transport
+// UDPTransport implements the UDP Transport. It can listen on several
+// addresses at the same time (i.e. ipv4 and ipv6 for dual-stack).
 type UDPTransport struct {
-	addr     *net.UDPAddr
-	logger   log.Logger
-	packetCh chan *Packet
-	listener *net.UDPConn
-	shutdown int32
+	addrs     []*net.UDPAddr
+	logger    *log.Logger
+	packetCh  chan *Packet
+	listeners []*net.UDPConn
+	shutdown  int32
 }
 
-func newUDPTransport(udpAddr *net.UDPAddr) (Transport, error) {
-	listener, err := net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		return nil, nil
+// NewUDPTransport creates an udp transport listening on the given addresses
+func NewUDPTransport(udpAddrs ...*net.UDPAddr) (*UDPTransport, error) {
+	if len(udpAddrs) == 0 {
+		return nil, fmt.Errorf("at least one address expected")
 	}
 
 	t := &UDPTransport{
-		addr:     udpAddr,
-		listener: listener,
+		logger:   log.New(ioutil.Discard, "", 0),
 		packetCh: make(chan *Packet),
 	}
-	go t.listen()
+	for _, udpAddr := range udpAddrs {
+		listener, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			t.Shutdown()
+			return nil, err
+		}
+		// use the port assigned by the system if none was given
+		port := listener.LocalAddr().(*net.UDPAddr).Port
+		t.addrs = append(t.addrs, &net.UDPAddr{IP: udpAddr.IP, Port: port, Zone: udpAddr.Zone})
+		t.listeners = append(t.listeners, listener)
+	}
+	for _, listener := range t.listeners {
+		go t.listen(listener)
+	}
 	return t, nil
 }
 
-func (u *UDPTransport) listen() {
+func (u *UDPTransport) listen(listener *net.UDPConn) {
 	for {
 		buf := make([]byte, udpPacketBufSize)
 
-		n, addr, err := u.listener.ReadFrom(buf)
+		n, addr, err := listener.ReadFrom(buf)
 		ts := time.Now()
 		if err != nil {
 			if s := atomic.LoadInt32(&u.shutdown); s == 1 {
@@ -57,9 +72,32 @@ func (u *UDPTransport) listen() {
 	}
 }
 
-// Addr implements the transport interface
+// Addr implements the transport interface. It returns
+// the first of the addresses the transport listens on
 func (u *UDPTransport) Addr() *net.UDPAddr {
-	return u.addr
+	return u.addrs[0]
+}
+
+// Addrs returns all the addresses the transport listens on
+func (u *UDPTransport) Addrs() []*net.UDPAddr {
+	return u.addrs
+}
+
+// listenerFor returns the listener of the same ip family as addr
+func (u *UDPTransport) listenerFor(addr *net.UDPAddr) *net.UDPConn {
+	isIPv4 := addr.IP.To4() != nil
+	for indx, local := range u.addrs {
+		if (local.IP.To4() != nil) == isIPv4 {
+			return u.listeners[indx]
+		}
+	}
+	// wildcard listeners are dual-stack
+	for indx, local := range u.addrs {
+		if local.IP.IsUnspecified() {
+			return u.listeners[indx]
+		}
+	}
+	return u.listeners[0]
 }
 
 // PacketCh implements the transport interface
@@ -73,12 +111,14 @@ func (u *UDPTransport) WriteTo(b []byte, addr string) (time.Time, error) {
 	if err != nil {
 		return time.Time{}, err
 	}
-	_, err = u.listener.WriteTo(b, udpAddr)
+	_, err = u.listenerFor(udpAddr).WriteTo(b, udpAddr)
 	return time.Now(), err
 }
 
 // Shutdown implements the transport interface
 func (u *UDPTransport) Shutdown() {
 	atomic.StoreInt32(&u.shutdown, 1)
-	u.listener.Close()
+	for _, listener := range u.listeners {
+		listener.Close()
+	}
 }
@@ -0,0 +1,39 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPTransport_DualStack(t *testing.T) {
+	t0, err := NewUDPTransport(
+		&net.UDPAddr{IP: net.ParseIP("127.0.0.1")},
+		&net.UDPAddr{IP: net.ParseIP("::1")},
+	)
+	assert.NoError(t, err)
+	defer t0.Shutdown()
+
+	t1, err := NewUDPTransport(
+		&net.UDPAddr{IP: net.ParseIP("127.0.0.1")},
+		&net.UDPAddr{IP: net.ParseIP("::1")},
+	)
+	assert.NoError(t, err)
+	defer t1.Shutdown()
+
+	for _, dst := range t1.Addrs() {
+		_, err := t0.WriteTo([]byte{0x1}, dst.String())
+		assert.NoError(t, err)
+
+		select {
+		case packet := <-t1.PacketCh():
+			from := packet.From.(*net.UDPAddr)
+			// the packet is sent from the listener with the same family
+			assert.Equal(t, dst.IP.To4() == nil, from.IP.To4() == nil)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
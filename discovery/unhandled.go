@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// unhandledQueueSize is the number of unhandled packets waiting
+// to be read by the secondary protocol
+const unhandledQueueSize = 128
+
+// UnhandledStats are the counts of the packets that the
+// discv4 backend could not authenticate
+type UnhandledStats struct {
+	// Received is the number of packets handed to the secondary protocol
+	Received uint64 `json:"received"`
+
+	// Dropped is the number of packets dropped because the
+	// secondary protocol was not reading them
+	Dropped uint64 `json:"dropped"`
+}
+
+// UnhandledTransport is the transport of a protocol that shares the udp
+// socket with discv4 (i.e. discv5). It receives the packets that the discv4
+// backend cannot authenticate and writes with the shared transport.
+type UnhandledTransport struct {
+	transport Transport
+	packetCh  chan *Packet
+	received  uint64
+	dropped   uint64
+}
+
+func newUnhandledTransport(transport Transport) *UnhandledTransport {
+	return &UnhandledTransport{
+		transport: transport,
+		packetCh:  make(chan *Packet, unhandledQueueSize),
+	}
+}
+
+// handle hands the packet to the secondary protocol without blocking
+func (u *UnhandledTransport) handle(packet *Packet) {
+	select {
+	case u.packetCh <- packet:
+		atomic.AddUint64(&u.received, 1)
+	default:
+		atomic.AddUint64(&u.dropped, 1)
+	}
+}
+
+// Stats returns the counts of the unhandled packets
+func (u *UnhandledTransport) Stats() UnhandledStats {
+	return UnhandledStats{
+		Received: atomic.LoadUint64(&u.received),
+		Dropped:  atomic.LoadUint64(&u.dropped),
+	}
+}
+
+// Addr implements the transport interface
+func (u *UnhandledTransport) Addr() *net.UDPAddr {
+	return u.transport.Addr()
+}
+
+// Addrs returns all the addresses of the shared transport
+func (u *UnhandledTransport) Addrs() []*net.UDPAddr {
+	if multi, ok := u.transport.(interface{ Addrs() []*net.UDPAddr }); ok {
+		return multi.Addrs()
+	}
+	return []*net.UDPAddr{u.transport.Addr()}
+}
+
+// PacketCh implements the transport interface
+func (u *UnhandledTransport) PacketCh() chan *Packet {
+	return u.packetCh
+}
+
+// WriteTo implements the transport interface
+func (u *UnhandledTransport) WriteTo(b []byte, addr string) (time.Time, error) {
+	return u.transport.WriteTo(b, addr)
+}
+
+// Shutdown implements the transport interface. The shared
+// transport is closed by the discv4 backend.
+func (u *UnhandledTransport) Shutdown() {
+}
@@ -0,0 +1,953 @@
+package discv5
+
+import (
+	"context"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/discovery"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+var (
+	defaultRespTimeout = 5 * time.Second
+	lookupInterval     = 1 * time.Minute
+)
+
+const (
+	alpha = 3
+
+	// maxNodesResponse is the maximum number of nodes returned for a findnode request
+	maxNodesResponse = bucketSize
+
+	// nodesPerMessage is the number of records in each nodes message. Records
+	// have at most 300 bytes so three of them fit in a packet.
+	nodesPerMessage = 3
+
+	// randomPacketSize is the size of the random message sent to start a handshake
+	randomPacketSize = 20
+
+	// numPacketWorkers is the number of goroutines handling the incoming
+	// packets and packetQueueSize the number of packets waiting to be handled
+	numPacketWorkers = 16
+	packetQueueSize  = 512
+
+	// packetRate and packetBurst are the packets per second
+	// and the burst of packets accepted from a single ip
+	packetRate  = 100.0
+	packetBurst = 200
+)
+
+// call is a request waiting for a response
+type call struct {
+	node   *Node
+	msg    message
+	respCh chan message
+
+	// handshake is true once the request has been resent in a handshake
+	handshake bool
+}
+
+// challenge is a WHOAREYOU packet sent to a node
+type challenge struct {
+	// data is the unmasked WHOAREYOU packet used in the key derivation
+	data []byte
+
+	// node is the node as known when the challenge was sent, nil if unknown
+	node *Node
+
+	sent time.Time
+}
+
+// Backend is the discv5 discovery protocol
+type Backend struct {
+	logger    *log.Logger
+	key       *ecdsa.PrivateKey
+	id        NodeID
+	localNode *enode.LocalNode
+	transport discovery.Transport
+	table     *table
+	sessions  *sessionCache
+	talk      *talkRegistry
+	pool      *discovery.PacketPool
+	limiter   *discovery.IPRateLimiter
+
+	lock sync.Mutex
+
+	// calls are the requests waiting for a response indexed by request id
+	calls map[string]*call
+
+	// pending are the requests indexed by the nonce of the last packet
+	// sent. They are resent in a handshake if the node replies with a WHOAREYOU.
+	pending map[Nonce]*call
+
+	// challenges are the WHOAREYOU packets sent indexed by the node
+	challenges map[sessionKey]*challenge
+
+	// respTimeout is the time to wait for the response of a request
+	respTimeout time.Duration
+
+	closeCh   chan struct{}
+	closed    int32
+	bootnodes []*Node
+}
+
+var _ discovery.Discovery = (*Backend)(nil)
+
+// DiscV5 creates a discv5 backend listening on the udp address of the config
+func DiscV5(ctx context.Context, conf *discovery.DiscoveryConfig) (discovery.Discovery, error) {
+	udpAddrs := conf.BindAddrs
+	if len(udpAddrs) == 0 {
+		udpAddrs = []*net.UDPAddr{{IP: conf.Enode.IP, Port: int(conf.Enode.UDP)}}
+	}
+
+	transport, err := discovery.NewUDPTransport(udpAddrs...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewBackend(conf.Logger, conf.Key, conf.LocalNode, transport)
+	if err != nil {
+		transport.Shutdown()
+		return nil, err
+	}
+	b.SetBootnodes(conf.Bootnodes)
+	return b, nil
+}
+
+// BackendOption is an option to configure the backend
+type BackendOption func(*Backend)
+
+// WithRespTimeout sets the time to wait for the response of a request
+func WithRespTimeout(d time.Duration) BackendOption {
+	return func(b *Backend) {
+		b.respTimeout = d
+	}
+}
+
+// NewBackend creates a new discv5 backend. If the local node is nil, a
+// new one is created with the address of the transport.
+func NewBackend(logger *log.Logger, key *ecdsa.PrivateKey, localNode *enode.LocalNode, transport discovery.Transport, opts ...BackendOption) (*Backend, error) {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	if localNode == nil {
+		var err error
+		if localNode, err = enode.NewLocalNode(key, nil); err != nil {
+			return nil, err
+		}
+		addr := transport.Addr()
+		udp := enr.Uint16(addr.Port)
+
+		localNode.SetStaticIP(addr.IP)
+		localNode.Set("udp", &udp)
+	}
+	if err := localNode.Sign(); err != nil {
+		return nil, err
+	}
+
+	id := PubkeyToID(&key.PublicKey)
+	b := &Backend{
+		logger:     logger,
+		key:        key,
+		id:         id,
+		localNode:  localNode,
+		transport:  transport,
+		table:      newTable(id),
+		sessions:   newSessionCache(),
+		talk:       newTalkRegistry(),
+		limiter:    discovery.NewIPRateLimiter(packetRate, packetBurst),
+		calls:      map[string]*call{},
+		pending:    map[Nonce]*call{},
+		challenges: map[sessionKey]*challenge{},
+		closeCh:    make(chan struct{}),
+
+		respTimeout: defaultRespTimeout,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	b.pool = discovery.NewPacketPool(numPacketWorkers, packetQueueSize, b.handlePoolPacket)
+	go b.listen()
+
+	return b, nil
+}
+
+// ID returns the node id of the local node
+func (b *Backend) ID() NodeID {
+	return b.id
+}
+
+// Self returns the local node
+func (b *Backend) Self() *Node {
+	addr := b.transport.Addr()
+	return &Node{
+		ID:     b.id,
+		Pubkey: &b.key.PublicKey,
+		Addr:   &net.UDPAddr{IP: addr.IP, Port: addr.Port},
+		Record: b.localNode.Record(),
+	}
+}
+
+// SetBootnodes sets the bootnodes in text record format (enr:...)
+func (b *Backend) SetBootnodes(bootnodes []string) {
+	for _, str := range bootnodes {
+		n, err := ParseNode(str)
+		if err != nil {
+			b.logger.Printf("[ERROR] failed to parse bootnode: bootnode, %s, err, %v", str, err)
+			continue
+		}
+		b.bootnodes = append(b.bootnodes, n)
+	}
+}
+
+// Nodes returns the nodes in the table
+func (b *Backend) Nodes() []*Node {
+	return b.table.all()
+}
+
+// RandomNodes implements the discovery interface
+func (b *Backend) RandomNodes() discovery.Iterator {
+	return discovery.NewLookupIterator(func(ctx context.Context) []*enode.Node {
+		res := []*enode.Node{}
+		for _, n := range b.LookupRandom(ctx) {
+			if node, err := enode.NodeFromRecord(n.Record); err == nil {
+				res = append(res, node)
+			}
+		}
+		return res
+	})
+}
+
+// Schedule implements the discovery interface
+func (b *Backend) Schedule() {
+	go b.schedule()
+}
+
+// Close implements the discovery interface
+func (b *Backend) Close() error {
+	if !atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		return nil
+	}
+	close(b.closeCh)
+	b.pool.Close()
+	b.transport.Shutdown()
+	return nil
+}
+
+func (b *Backend) isClosed() bool {
+	return atomic.LoadInt32(&b.closed) == 1
+}
+
+func (b *Backend) schedule() {
+	for _, n := range b.bootnodes {
+		if err := b.Ping(n); err != nil {
+			b.logger.Printf("[DEBUG] failed to ping bootnode: node, %s, err, %v", n, err)
+		}
+	}
+
+	for {
+		b.LookupRandom(context.Background())
+
+		select {
+		case <-time.After(lookupInterval):
+		case <-b.closeCh:
+			return
+		}
+	}
+}
+
+func (b *Backend) listen() {
+	for {
+		select {
+		case packet := <-b.transport.PacketCh():
+			if addr, ok := packet.From.(*net.UDPAddr); ok && !b.limiter.Allow(addr.IP, packet.Timestamp) {
+				b.logger.Printf("[TRACE] packet rate limited: addr, %s", addr)
+				continue
+			}
+			if !b.pool.Dispatch(packet) {
+				b.logger.Printf("[TRACE] packet queue full, dropping packet: addr, %s", packet.From)
+			}
+		case <-b.closeCh:
+			return
+		}
+	}
+}
+
+// handlePoolPacket handles the packets of the worker pool
+func (b *Backend) handlePoolPacket(packet *discovery.Packet) {
+	if err := b.handlePacket(packet); err != nil {
+		b.logger.Printf("[TRACE] failed to handle packet: err, %v", err)
+	}
+}
+
+// addNode adds a node that has replied to a request to the table
+func (b *Backend) addNode(n *Node) {
+	b.table.add(n)
+}
+
+func (b *Backend) writeTo(packet []byte, addr *net.UDPAddr) error {
+	_, err := b.transport.WriteTo(packet, addr.String())
+	return err
+}
+
+// --- outgoing packets ---
+
+// encodeMessagePacket encodes an ordinary message packet encrypted with the key
+func (b *Backend) encodeMessagePacket(destID NodeID, key []byte, msg message) ([]byte, Nonce, error) {
+	h, err := newHeader(flagMessage, b.id[:])
+	if err != nil {
+		return nil, Nonce{}, err
+	}
+	ct, err := encryptMessage(key, h.Nonce, encodeMessage(msg), h.encode())
+	if err != nil {
+		return nil, Nonce{}, err
+	}
+	packet, err := encodePacket(destID, h, ct)
+	if err != nil {
+		return nil, Nonce{}, err
+	}
+	return packet, h.Nonce, nil
+}
+
+// encodeRandomPacket encodes a message packet with random content. It is
+// sent when there is no session with the node to trigger the handshake.
+func (b *Backend) encodeRandomPacket(destID NodeID) ([]byte, Nonce, error) {
+	h, err := newHeader(flagMessage, b.id[:])
+	if err != nil {
+		return nil, Nonce{}, err
+	}
+	msg := make([]byte, randomPacketSize)
+	if _, err := crand.Read(msg); err != nil {
+		return nil, Nonce{}, err
+	}
+	packet, err := encodePacket(destID, h, msg)
+	if err != nil {
+		return nil, Nonce{}, err
+	}
+	return packet, h.Nonce, nil
+}
+
+// sendRequest sends the request of the call, encrypted if there is
+// a session with the node or with random content otherwise
+func (b *Backend) sendRequest(c *call) error {
+	var packet []byte
+	var nonce Nonce
+	var err error
+
+	if sess := b.sessions.get(c.node.ID, c.node.Addr.String()); sess != nil {
+		packet, nonce, err = b.encodeMessagePacket(c.node.ID, sess.writeKey, c.msg)
+	} else {
+		packet, nonce, err = b.encodeRandomPacket(c.node.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	b.pending[nonce] = c
+	b.lock.Unlock()
+
+	return b.writeTo(packet, c.node.Addr)
+}
+
+// sendResponse sends a response to a node we have a session with
+func (b *Backend) sendResponse(id NodeID, addr *net.UDPAddr, msg message) error {
+	sess := b.sessions.get(id, addr.String())
+	if sess == nil {
+		return fmt.Errorf("no session with node %s", id)
+	}
+	packet, _, err := b.encodeMessagePacket(id, sess.writeKey, msg)
+	if err != nil {
+		return err
+	}
+	return b.writeTo(packet, addr)
+}
+
+// sendWhoareyou challenges the node to start a handshake
+func (b *Backend) sendWhoareyou(id NodeID, addr *net.UDPAddr, nonce Nonce) error {
+	key := sessionKey{id, addr.String()}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if c, ok := b.challenges[key]; ok && time.Since(c.sent) < b.respTimeout {
+		// there is already a handshake in progress with the node
+		return nil
+	}
+
+	auth := &whoareyouAuth{}
+	if _, err := crand.Read(auth.IDNonce[:]); err != nil {
+		return err
+	}
+	node, ok := b.table.get(id)
+	if ok {
+		auth.ENRSeq = node.Record.Seq()
+	} else {
+		node = nil
+	}
+
+	h := &header{
+		Flag:     flagWhoareyou,
+		Nonce:    nonce,
+		AuthData: auth.encode(),
+	}
+	if _, err := crand.Read(h.IV[:]); err != nil {
+		return err
+	}
+	packet, err := encodePacket(id, h, nil)
+	if err != nil {
+		return err
+	}
+
+	b.challenges[key] = &challenge{
+		data: h.encode(),
+		node: node,
+		sent: time.Now(),
+	}
+	return b.writeTo(packet, addr)
+}
+
+// --- incoming packets ---
+
+func (b *Backend) handlePacket(packet *discovery.Packet) error {
+	addr, ok := packet.From.(*net.UDPAddr)
+	if !ok {
+		return fmt.Errorf("expected udp addr")
+	}
+
+	h, headerData, msgData, err := decodeHeader(b.id, packet.Buf)
+	if err != nil {
+		return err
+	}
+
+	switch h.Flag {
+	case flagMessage:
+		return b.handleMessagePacket(h, headerData, msgData, addr)
+	case flagWhoareyou:
+		return b.handleWhoareyou(h, headerData, addr)
+	case flagHandshake:
+		return b.handleHandshake(h, headerData, msgData, addr)
+	default:
+		return fmt.Errorf("unknown flag %d", h.Flag)
+	}
+}
+
+func (b *Backend) handleMessagePacket(h *header, headerData, msgData []byte, addr *net.UDPAddr) error {
+	if len(h.AuthData) != messageAuthSize {
+		return fmt.Errorf("invalid message authdata size %d", len(h.AuthData))
+	}
+	var srcID NodeID
+	copy(srcID[:], h.AuthData)
+
+	sess := b.sessions.get(srcID, addr.String())
+	if sess == nil {
+		return b.sendWhoareyou(srcID, addr, h.Nonce)
+	}
+	pt, err := decryptMessage(sess.readKey, h.Nonce, msgData, headerData)
+	if err != nil {
+		// the node might have lost the session, start a new handshake
+		return b.sendWhoareyou(srcID, addr, h.Nonce)
+	}
+	msg, err := decodeMessage(pt)
+	if err != nil {
+		return err
+	}
+	return b.handleMessage(srcID, addr, msg)
+}
+
+func (b *Backend) handleWhoareyou(h *header, headerData []byte, addr *net.UDPAddr) error {
+	var auth whoareyouAuth
+	if err := auth.decode(h.AuthData); err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	c, ok := b.pending[h.Nonce]
+	if ok {
+		delete(b.pending, h.Nonce)
+	}
+	b.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unsolicited whoareyou")
+	}
+	if !equalAddr(c.node.Addr, addr) {
+		return fmt.Errorf("whoareyou from the wrong address %s", addr)
+	}
+	if c.handshake {
+		return fmt.Errorf("handshake with node %s failed", c.node.ID)
+	}
+	c.handshake = true
+
+	// the challenge data is the unmasked WHOAREYOU packet
+	challengeData := headerData
+
+	ephKey, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	ephPubkey := crypto.CompressPubKey(&ephKey.PublicKey)
+
+	initKey, recKey, err := deriveKeys(crypto.ECDH(ephKey, c.node.Pubkey), b.id, c.node.ID, challengeData)
+	if err != nil {
+		return err
+	}
+	sig, err := signIDNonce(b.key, challengeData, ephPubkey, c.node.ID)
+	if err != nil {
+		return err
+	}
+
+	auth2 := &handshakeAuth{
+		SrcID:     b.id,
+		Signature: sig,
+		EphPubkey: ephPubkey,
+	}
+	if record := b.localNode.Record(); auth.ENRSeq < record.Seq() {
+		auth2.Record = record.MarshalRLP()
+	}
+
+	h2, err := newHeader(flagHandshake, auth2.encode())
+	if err != nil {
+		return err
+	}
+	ct, err := encryptMessage(initKey, h2.Nonce, encodeMessage(c.msg), h2.encode())
+	if err != nil {
+		return err
+	}
+	packet, err := encodePacket(c.node.ID, h2, ct)
+	if err != nil {
+		return err
+	}
+
+	b.sessions.store(c.node.ID, addr.String(), &session{writeKey: initKey, readKey: recKey})
+
+	b.lock.Lock()
+	b.pending[h2.Nonce] = c
+	b.lock.Unlock()
+
+	return b.writeTo(packet, addr)
+}
+
+func (b *Backend) handleHandshake(h *header, headerData, msgData []byte, addr *net.UDPAddr) error {
+	var auth handshakeAuth
+	if err := auth.decode(h.AuthData); err != nil {
+		return err
+	}
+
+	key := sessionKey{auth.SrcID, addr.String()}
+
+	b.lock.Lock()
+	ch, ok := b.challenges[key]
+	if ok {
+		delete(b.challenges, key)
+	}
+	b.lock.Unlock()
+
+	if !ok {
+		return fmt.Errorf("handshake without challenge")
+	}
+
+	node := ch.node
+	if len(auth.Record) != 0 {
+		record := &enr.Record{}
+		if err := record.UnmarshalRLP(auth.Record); err != nil {
+			return err
+		}
+		n, err := NewNode(record)
+		if err != nil {
+			return err
+		}
+		if n.ID != auth.SrcID {
+			return fmt.Errorf("handshake record does not belong to the node")
+		}
+		if node == nil || node.Record.Seq() < record.Seq() {
+			node = n
+		}
+	}
+	if node == nil {
+		return fmt.Errorf("handshake without record from unknown node %s", auth.SrcID)
+	}
+
+	if err := verifyIDSignature(node.Pubkey, auth.Signature, ch.data, auth.EphPubkey, b.id); err != nil {
+		return err
+	}
+	ephPubkey, err := crypto.ParseCompressedPubKey(auth.EphPubkey)
+	if err != nil {
+		return err
+	}
+	initKey, recKey, err := deriveKeys(crypto.ECDH(b.key, ephPubkey), auth.SrcID, b.id, ch.data)
+	if err != nil {
+		return err
+	}
+	pt, err := decryptMessage(initKey, h.Nonce, msgData, headerData)
+	if err != nil {
+		return err
+	}
+	msg, err := decodeMessage(pt)
+	if err != nil {
+		return err
+	}
+
+	b.sessions.store(auth.SrcID, addr.String(), &session{writeKey: recKey, readKey: initKey})
+
+	// only add the node to the table if the endpoint in the
+	// record is the one the packet comes from
+	if equalAddr(node.Addr, addr) {
+		b.addNode(node)
+	}
+	return b.handleMessage(auth.SrcID, addr, msg)
+}
+
+// --- messages ---
+
+func (b *Backend) handleMessage(id NodeID, addr *net.UDPAddr, msg message) error {
+	switch obj := msg.(type) {
+	case *ping:
+		return b.handlePing(id, addr, obj)
+	case *findnode:
+		return b.handleFindnode(id, addr, obj)
+	case *talkRequest:
+		return b.handleTalkRequest(id, addr, obj)
+	default:
+		return b.handleResponse(id, msg)
+	}
+}
+
+func (b *Backend) handlePing(id NodeID, addr *net.UDPAddr, msg *ping) error {
+	resp := &pong{
+		ReqID:  msg.ReqID,
+		ENRSeq: b.localNode.Seq(),
+		ToIP:   addr.IP,
+		ToPort: uint16(addr.Port),
+	}
+	if err := b.sendResponse(id, addr, resp); err != nil {
+		return err
+	}
+
+	// request the record of the node if it has been updated
+	if n, ok := b.table.get(id); ok && n.Record.Seq() < msg.ENRSeq {
+		go b.RequestENR(n)
+	}
+	return nil
+}
+
+func (b *Backend) handleFindnode(id NodeID, addr *net.UDPAddr, msg *findnode) error {
+	records := []*enr.Record{}
+	for _, d := range msg.Distances {
+		if d == 0 {
+			records = append(records, b.localNode.Record())
+		} else {
+			for _, n := range b.table.atDistance(d) {
+				records = append(records, n.Record)
+			}
+		}
+		if len(records) >= maxNodesResponse {
+			records = records[:maxNodesResponse]
+			break
+		}
+	}
+
+	total := (len(records) + nodesPerMessage - 1) / nodesPerMessage
+	if total == 0 {
+		// reply with one empty message if there are no nodes
+		total = 1
+	}
+	for i := 0; i < total; i++ {
+		resp := &nodes{
+			ReqID:   msg.ReqID,
+			Total:   uint8(total),
+			Records: records[i*nodesPerMessage : min((i+1)*nodesPerMessage, len(records))],
+		}
+		if err := b.sendResponse(id, addr, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleResponse delivers the response to the call waiting for it
+func (b *Backend) handleResponse(id NodeID, msg message) error {
+	b.lock.Lock()
+	c, ok := b.calls[string(msg.RequestID())]
+	b.lock.Unlock()
+
+	if !ok || c.node.ID != id {
+		return fmt.Errorf("unsolicited response from %s", id)
+	}
+	select {
+	case c.respCh <- msg:
+	default:
+	}
+	return nil
+}
+
+// --- requests ---
+
+// request sends the message to the node and passes the responses to the
+// handler until it returns true or the request times out
+func (b *Backend) request(n *Node, msg message, timeout time.Duration, handler func(message) (bool, error)) error {
+	if b.isClosed() {
+		return fmt.Errorf("backend closed")
+	}
+
+	reqID := make([]byte, maxRequestIDSize)
+	if _, err := crand.Read(reqID); err != nil {
+		return err
+	}
+	switch obj := msg.(type) {
+	case *ping:
+		obj.ReqID = reqID
+	case *findnode:
+		obj.ReqID = reqID
+	case *talkRequest:
+		obj.ReqID = reqID
+	default:
+		return fmt.Errorf("message %d is not a request", msg.Kind())
+	}
+
+	c := &call{
+		node:   n,
+		msg:    msg,
+		respCh: make(chan message, 10),
+	}
+
+	b.lock.Lock()
+	b.calls[string(reqID)] = c
+	b.lock.Unlock()
+
+	defer func() {
+		b.lock.Lock()
+		delete(b.calls, string(reqID))
+		for nonce, pc := range b.pending {
+			if pc == c {
+				delete(b.pending, nonce)
+			}
+		}
+		b.lock.Unlock()
+	}()
+
+	if err := b.sendRequest(c); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case resp := <-c.respCh:
+			done, err := handler(resp)
+			if err != nil {
+				return err
+			}
+			if done {
+				// the node is alive
+				b.addNode(n)
+				return nil
+			}
+		case <-timer.C:
+			// remove the node that does not answer so that
+			// another one can take its place in the bucket
+			b.table.remove(n.ID)
+			return fmt.Errorf("request to node %s timeout", n)
+		case <-b.closeCh:
+			return fmt.Errorf("backend closed")
+		}
+	}
+}
+
+// Ping checks that the node is alive
+func (b *Backend) Ping(n *Node) error {
+	var seq uint64
+	err := b.request(n, &ping{ENRSeq: b.localNode.Seq()}, b.respTimeout, func(msg message) (bool, error) {
+		resp, ok := msg.(*pong)
+		if !ok {
+			return false, fmt.Errorf("expected pong but found %d", msg.Kind())
+		}
+		seq = resp.ENRSeq
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if seq > n.Record.Seq() {
+		go b.RequestENR(n)
+	}
+	return nil
+}
+
+// RequestENR requests the latest record of the node
+func (b *Backend) RequestENR(n *Node) (*Node, error) {
+	nodes, err := b.FindNode(n, []uint{0})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 {
+		return nil, fmt.Errorf("expected one record but found %d", len(nodes))
+	}
+	if nodes[0].Record.Seq() > n.Record.Seq() {
+		b.table.add(nodes[0])
+	}
+	return nodes[0], nil
+}
+
+// FindNode queries the nodes at the given log distances from the node
+func (b *Backend) FindNode(n *Node, distances []uint) ([]*Node, error) {
+	received := 0
+	found := []*Node{}
+
+	err := b.request(n, &findnode{Distances: distances}, b.respTimeout, func(msg message) (bool, error) {
+		resp, ok := msg.(*nodes)
+		if !ok {
+			return false, fmt.Errorf("expected nodes but found %d", msg.Kind())
+		}
+		if resp.Total == 0 || int(resp.Total) > (maxNodesResponse+nodesPerMessage-1)/nodesPerMessage {
+			return false, fmt.Errorf("invalid total %d", resp.Total)
+		}
+		for _, record := range resp.Records {
+			m, err := NewNode(record)
+			if err != nil {
+				b.logger.Printf("[DEBUG] invalid record in nodes response: node, %s, err, %v", n, err)
+				continue
+			}
+			if !containsDistance(distances, logDistance(n.ID, m.ID)) {
+				b.logger.Printf("[DEBUG] node at wrong distance in nodes response: node, %s", n)
+				continue
+			}
+			if len(found) < maxNodesResponse {
+				found = append(found, m)
+			}
+		}
+		received++
+		return received == int(resp.Total), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func containsDistance(distances []uint, d uint) bool {
+	for _, i := range distances {
+		if i == d {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupDistances returns the distances to query a node in a lookup
+func lookupDistances(target, dest NodeID) []uint {
+	d := logDistance(target, dest)
+	res := []uint{d}
+	if d < numBuckets {
+		res = append(res, d+1)
+	}
+	if d > 1 {
+		res = append(res, d-1)
+	}
+	return res
+}
+
+// LookupRandom performs a lookup of a random node id
+func (b *Backend) LookupRandom(ctx context.Context) []*Node {
+	var target NodeID
+	crand.Read(target[:])
+	return b.Lookup(ctx, target)
+}
+
+// Lookup performs an iterative lookup of the target. It returns the
+// closest nodes found or nil if the context is cancelled.
+func (b *Backend) Lookup(ctx context.Context, target NodeID) []*Node {
+	result := b.table.closest(target, bucketSize)
+
+	asked := map[NodeID]bool{b.id: true}
+	seen := map[NodeID]bool{b.id: true}
+	for _, n := range result {
+		seen[n.ID] = true
+	}
+
+	for !b.isClosed() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		query := []*Node{}
+		for _, n := range result {
+			if !asked[n.ID] && len(query) < alpha {
+				asked[n.ID] = true
+				query = append(query, n)
+			}
+		}
+		if len(query) == 0 {
+			break
+		}
+
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		for _, n := range query {
+			wg.Add(1)
+			go func(n *Node) {
+				defer wg.Done()
+
+				found, err := b.FindNode(n, lookupDistances(target, n.ID))
+				if err != nil {
+					b.logger.Printf("[DEBUG] failed to query node: node, %s, err, %v", n, err)
+					return
+				}
+
+				lock.Lock()
+				defer lock.Unlock()
+
+				for _, m := range found {
+					if !seen[m.ID] {
+						seen[m.ID] = true
+						result = append(result, m)
+					}
+				}
+			}(n)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			// the queries finish in the background
+			return nil
+		}
+
+		sort.Slice(result, func(i, j int) bool {
+			return closer(target, result[i].ID, result[j].ID)
+		})
+		if len(result) > bucketSize {
+			result = result[:bucketSize]
+		}
+	}
+	return result
+}
+
+func min(i, j int) int {
+	if i < j {
+		return i
+	}
+	return j
+}
+
+// equalAddr returns true if both addresses are the same
+func equalAddr(a, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
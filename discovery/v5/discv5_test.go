@@ -0,0 +1,202 @@
+package discv5
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/discovery"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+func newTestBackend(t *testing.T, network *discovery.MockNetwork, opts ...BackendOption) *Backend {
+	key, _ := crypto.GenerateKey()
+
+	b, err := NewBackend(nil, key, nil, network.NewTransport(), opts...)
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		b.Close()
+	})
+	return b
+}
+
+func TestPingHandshake(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	assert.NoError(t, b0.Ping(b1.Self()))
+
+	// both nodes have a session and know each other
+	assert.NotNil(t, b0.sessions.get(b1.id, b1.Self().Addr.String()))
+	assert.NotNil(t, b1.sessions.get(b0.id, b0.Self().Addr.String()))
+
+	_, ok := b0.table.get(b1.id)
+	assert.True(t, ok)
+	_, ok = b1.table.get(b0.id)
+	assert.True(t, ok)
+
+	// the session is reused in both directions
+	assert.NoError(t, b0.Ping(b1.Self()))
+	assert.NoError(t, b1.Ping(b0.Self()))
+	assert.Len(t, b1.challenges, 0)
+}
+
+func TestPingSessionLost(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	assert.NoError(t, b0.Ping(b1.Self()))
+
+	// b1 drops the session, b0 has to do a new handshake
+	b1.sessions.delete(b0.id, b0.Self().Addr.String())
+	assert.NoError(t, b0.Ping(b1.Self()))
+	assert.NotNil(t, b1.sessions.get(b0.id, b0.Self().Addr.String()))
+}
+
+func TestPingTimeout(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network, WithRespTimeout(100*time.Millisecond))
+	b1 := newTestBackend(t, network)
+
+	assert.NoError(t, b0.Ping(b1.Self()))
+	_, ok := b0.table.get(b1.id)
+	assert.True(t, ok)
+
+	network.Partition(b0.transport, b1.transport)
+	assert.Error(t, b0.Ping(b1.Self()))
+
+	// the node that does not answer is removed from the table
+	_, ok = b0.table.get(b1.id)
+	assert.False(t, ok)
+}
+
+func TestFindNode(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	// populate the table of b1
+	for i := 0; i < 10; i++ {
+		b := newTestBackend(t, network)
+		assert.NoError(t, b.Ping(b1.Self()))
+	}
+
+	// distance 0 returns the record of the node
+	found, err := b0.FindNode(b1.Self(), []uint{0})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, b1.id, found[0].ID)
+
+	distances := map[uint]bool{}
+	for _, n := range b1.Nodes() {
+		distances[logDistance(b1.id, n.ID)] = true
+	}
+	query := []uint{}
+	for d := range distances {
+		query = append(query, d)
+	}
+
+	found, err = b0.FindNode(b1.Self(), query)
+	assert.NoError(t, err)
+
+	// b0 is also in the table of b1 after the handshake
+	expected := map[NodeID]bool{}
+	for _, n := range b1.Nodes() {
+		expected[n.ID] = true
+	}
+	assert.Len(t, found, len(expected))
+	for _, n := range found {
+		assert.True(t, expected[n.ID])
+	}
+}
+
+func TestLookup(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	bootnode := newTestBackend(t, network)
+
+	nodes := []*Backend{}
+	for i := 0; i < 8; i++ {
+		b := newTestBackend(t, network)
+		assert.NoError(t, b.Ping(bootnode.Self()))
+		nodes = append(nodes, b)
+	}
+
+	b0 := newTestBackend(t, network)
+	assert.NoError(t, b0.Ping(bootnode.Self()))
+
+	target := nodes[0].id
+	result := b0.Lookup(context.Background(), target)
+	assert.NotEmpty(t, result)
+	assert.Equal(t, target, result[0].ID)
+
+	// the results are sorted by distance to the target
+	for i := 1; i < len(result); i++ {
+		assert.True(t, closer(target, result[i-1].ID, result[i].ID))
+	}
+}
+
+func TestRequestENR(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	assert.NoError(t, b0.Ping(b1.Self()))
+
+	tcp := enr.Uint16(30303)
+	b1.localNode.Set("tcp", &tcp)
+
+	n, err := b0.RequestENR(b1.Self())
+	assert.NoError(t, err)
+	assert.Equal(t, b1.localNode.Seq(), n.Record.Seq())
+
+	// the table has the latest record
+	n, ok := b0.table.get(b1.id)
+	assert.True(t, ok)
+	assert.Equal(t, b1.localNode.Seq(), n.Record.Seq())
+}
+
+func TestSharedTransport(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	newNode := func() (*discovery.Backend, *Backend) {
+		key, _ := crypto.GenerateKey()
+
+		v4, err := discovery.NewBackend(nil, key, network.NewTransport())
+		assert.NoError(t, err)
+
+		// discv5 reads the packets that discv4 does not handle
+		v5, err := NewBackend(nil, key, nil, v4.Unhandled())
+		assert.NoError(t, err)
+
+		t.Cleanup(func() {
+			v5.Close()
+			v4.Close()
+		})
+		return v4, v5
+	}
+
+	v4a, v5a := newNode()
+	v4b, v5b := newNode()
+
+	// both protocols work on the same socket
+	assert.NoError(t, v5a.Ping(v5b.Self()))
+	e, err := v5b.Self().Enode()
+	assert.NoError(t, err)
+	assert.NoError(t, v4a.AddNode(e))
+	assert.Len(t, v4a.GetPeers(), 1)
+
+	assert.NotZero(t, v4a.Unhandled().Stats().Received)
+	assert.NotZero(t, v4b.Unhandled().Stats().Received)
+	assert.Zero(t, v4b.Unhandled().Stats().Dropped)
+}
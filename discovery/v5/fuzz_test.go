@@ -0,0 +1,80 @@
+package discv5
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+func FuzzDecodeMessage(f *testing.F) {
+	prv, _ := crypto.GenerateKey()
+	record := &enr.Record{}
+	ip := enr.IPv4(net.ParseIP("127.0.0.1"))
+	record.Set("ip", &ip)
+	record.Sign(prv)
+
+	seeds := []message{
+		&ping{ReqID: []byte{1}, ENRSeq: 1},
+		&pong{ReqID: []byte{1}, ENRSeq: 1, ToIP: net.ParseIP("127.0.0.1").To4(), ToPort: 30303},
+		&findnode{ReqID: []byte{1}, Distances: []uint{256, 255}},
+		&nodes{ReqID: []byte{1}, Total: 1, Records: []*enr.Record{record}},
+		&talkRequest{ReqID: []byte{1}, Protocol: "test", Message: []byte{1, 2}},
+		&talkResponse{ReqID: []byte{1}, Message: []byte{1, 2}},
+	}
+	for _, msg := range seeds {
+		f.Add(encodeMessage(msg))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := decodeMessage(data)
+		if err != nil {
+			return
+		}
+
+		// the encoding of a decoded message is stable
+		enc := encodeMessage(msg)
+		msg2, err := decodeMessage(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, encodeMessage(msg2)) {
+			t.Fatal("round trip encoding does not match")
+		}
+	})
+}
+
+func FuzzDecodeHeader(f *testing.F) {
+	var localID NodeID
+	localID[0] = 1
+
+	for _, flag := range []byte{flagMessage, flagWhoareyou, flagHandshake} {
+		h, err := newHeader(flag, make([]byte, messageAuthSize))
+		if err != nil {
+			f.Fatal(err)
+		}
+		packet, err := encodePacket(localID, h, []byte{1, 2, 3})
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(packet)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, _, _, err := decodeHeader(localID, data)
+		if err != nil {
+			return
+		}
+		var whoareyou whoareyouAuth
+		whoareyou.decode(h.AuthData)
+
+		var handshake handshakeAuth
+		if handshake.decode(h.AuthData) == nil {
+			if !bytes.Equal(h.AuthData, handshake.encode()) {
+				t.Fatal("round trip encoding does not match")
+			}
+		}
+	})
+}
@@ -0,0 +1,369 @@
+package discv5
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// Message types
+const (
+	pingMsg = iota + 1
+	pongMsg
+	findnodeMsg
+	nodesMsg
+	talkRequestMsg
+	talkResponseMsg
+)
+
+// maxRequestIDSize is the maximum size of the request id
+const maxRequestIDSize = 8
+
+// message is a discv5 message
+type message interface {
+	Kind() byte
+	RequestID() []byte
+	MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value
+	UnmarshalRLP(v *fastrlp.Value) error
+}
+
+// encodeMessage encodes the message as message-type || rlp(message-data)
+func encodeMessage(msg message) []byte {
+	a := &fastrlp.Arena{}
+	return msg.MarshalRLPWith(a).MarshalTo([]byte{msg.Kind()})
+}
+
+// decodeMessage decodes the plain text of a message
+func decodeMessage(b []byte) (message, error) {
+	if len(b) < 1 {
+		return nil, fmt.Errorf("empty message")
+	}
+
+	var msg message
+	switch b[0] {
+	case pingMsg:
+		msg = &ping{}
+	case pongMsg:
+		msg = &pong{}
+	case findnodeMsg:
+		msg = &findnode{}
+	case nodesMsg:
+		msg = &nodes{}
+	case talkRequestMsg:
+		msg = &talkRequest{}
+	case talkResponseMsg:
+		msg = &talkResponse{}
+	default:
+		return nil, fmt.Errorf("unknown message type %d", b[0])
+	}
+
+	// the parser is not reused since the records in the nodes
+	// message keep a reference to the parsed values
+	p := &fastrlp.Parser{}
+	v, err := p.Parse(b[1:])
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.UnmarshalRLP(v); err != nil {
+		return nil, err
+	}
+	if len(msg.RequestID()) > maxRequestIDSize {
+		return nil, fmt.Errorf("request id too big")
+	}
+	return msg, nil
+}
+
+func getElems(v *fastrlp.Value, num int) ([]*fastrlp.Value, error) {
+	elems, err := v.GetElems()
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) < num {
+		return nil, fmt.Errorf("expected at least %d elements but found %d", num, len(elems))
+	}
+	return elems, nil
+}
+
+// ping checks the liveness of a node
+type ping struct {
+	ReqID  []byte
+	ENRSeq uint64
+}
+
+func (p *ping) Kind() byte {
+	return pingMsg
+}
+
+func (p *ping) RequestID() []byte {
+	return p.ReqID
+}
+
+func (p *ping) MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value {
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(p.ReqID))
+	v.Set(a.NewUint(p.ENRSeq))
+	return v
+}
+
+func (p *ping) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := getElems(v, 2)
+	if err != nil {
+		return err
+	}
+	if p.ReqID, err = elems[0].GetBytes(p.ReqID[:0]); err != nil {
+		return err
+	}
+	if p.ENRSeq, err = elems[1].GetUint64(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// pong is the reply to ping
+type pong struct {
+	ReqID  []byte
+	ENRSeq uint64
+	ToIP   net.IP
+	ToPort uint16
+}
+
+func (p *pong) Kind() byte {
+	return pongMsg
+}
+
+func (p *pong) RequestID() []byte {
+	return p.ReqID
+}
+
+func (p *pong) MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value {
+	ip := p.ToIP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(p.ReqID))
+	v.Set(a.NewUint(p.ENRSeq))
+	v.Set(a.NewCopyBytes(ip))
+	v.Set(a.NewUint(uint64(p.ToPort)))
+	return v
+}
+
+func (p *pong) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := getElems(v, 4)
+	if err != nil {
+		return err
+	}
+	if p.ReqID, err = elems[0].GetBytes(p.ReqID[:0]); err != nil {
+		return err
+	}
+	if p.ENRSeq, err = elems[1].GetUint64(); err != nil {
+		return err
+	}
+	ip, err := elems[2].Bytes()
+	if err != nil {
+		return err
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return fmt.Errorf("invalid ip size %d", len(ip))
+	}
+	p.ToIP = append(net.IP{}, ip...)
+	port, err := elems[3].GetUint64()
+	if err != nil {
+		return err
+	}
+	p.ToPort = uint16(port)
+	return nil
+}
+
+// findnode queries the nodes at the given log distances
+type findnode struct {
+	ReqID     []byte
+	Distances []uint
+}
+
+func (f *findnode) Kind() byte {
+	return findnodeMsg
+}
+
+func (f *findnode) RequestID() []byte {
+	return f.ReqID
+}
+
+func (f *findnode) MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value {
+	distances := a.NewArray()
+	for _, d := range f.Distances {
+		distances.Set(a.NewUint(uint64(d)))
+	}
+
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(f.ReqID))
+	v.Set(distances)
+	return v
+}
+
+func (f *findnode) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := getElems(v, 2)
+	if err != nil {
+		return err
+	}
+	if f.ReqID, err = elems[0].GetBytes(f.ReqID[:0]); err != nil {
+		return err
+	}
+	distances, err := elems[1].GetElems()
+	if err != nil {
+		return err
+	}
+	f.Distances = f.Distances[:0]
+	for _, elem := range distances {
+		d, err := elem.GetUint64()
+		if err != nil {
+			return err
+		}
+		if d > 256 {
+			return fmt.Errorf("invalid distance %d", d)
+		}
+		f.Distances = append(f.Distances, uint(d))
+	}
+	return nil
+}
+
+// nodes is the reply to findnode. The response might be split
+// in several messages, 'Total' is the number of messages.
+type nodes struct {
+	ReqID   []byte
+	Total   uint8
+	Records []*enr.Record
+}
+
+func (n *nodes) Kind() byte {
+	return nodesMsg
+}
+
+func (n *nodes) RequestID() []byte {
+	return n.ReqID
+}
+
+func (n *nodes) MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value {
+	records := a.NewArray()
+	for _, r := range n.Records {
+		records.Set(r.MarshalRLPWith(a))
+	}
+
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(n.ReqID))
+	v.Set(a.NewUint(uint64(n.Total)))
+	v.Set(records)
+	return v
+}
+
+func (n *nodes) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := getElems(v, 3)
+	if err != nil {
+		return err
+	}
+	if n.ReqID, err = elems[0].GetBytes(n.ReqID[:0]); err != nil {
+		return err
+	}
+	total, err := elems[1].GetUint64()
+	if err != nil {
+		return err
+	}
+	if total > 255 {
+		return fmt.Errorf("invalid total %d", total)
+	}
+	n.Total = uint8(total)
+
+	records, err := elems[2].GetElems()
+	if err != nil {
+		return err
+	}
+	n.Records = n.Records[:0]
+	for _, elem := range records {
+		record := &enr.Record{}
+		if err := record.UnmarshalRLPWith(elem); err != nil {
+			return err
+		}
+		n.Records = append(n.Records, record)
+	}
+	return nil
+}
+
+// talkRequest sends an application request to the node
+type talkRequest struct {
+	ReqID    []byte
+	Protocol string
+	Message  []byte
+}
+
+func (t *talkRequest) Kind() byte {
+	return talkRequestMsg
+}
+
+func (t *talkRequest) RequestID() []byte {
+	return t.ReqID
+}
+
+func (t *talkRequest) MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value {
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(t.ReqID))
+	v.Set(a.NewString(t.Protocol))
+	v.Set(a.NewCopyBytes(t.Message))
+	return v
+}
+
+func (t *talkRequest) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := getElems(v, 3)
+	if err != nil {
+		return err
+	}
+	if t.ReqID, err = elems[0].GetBytes(t.ReqID[:0]); err != nil {
+		return err
+	}
+	protocol, err := elems[1].GetString()
+	if err != nil {
+		return err
+	}
+	t.Protocol = protocol
+	if t.Message, err = elems[2].GetBytes(t.Message[:0]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// talkResponse is the reply to talkRequest
+type talkResponse struct {
+	ReqID   []byte
+	Message []byte
+}
+
+func (t *talkResponse) Kind() byte {
+	return talkResponseMsg
+}
+
+func (t *talkResponse) RequestID() []byte {
+	return t.ReqID
+}
+
+func (t *talkResponse) MarshalRLPWith(a *fastrlp.Arena) *fastrlp.Value {
+	v := a.NewArray()
+	v.Set(a.NewCopyBytes(t.ReqID))
+	v.Set(a.NewCopyBytes(t.Message))
+	return v
+}
+
+func (t *talkResponse) UnmarshalRLP(v *fastrlp.Value) error {
+	elems, err := getElems(v, 2)
+	if err != nil {
+		return err
+	}
+	if t.ReqID, err = elems[0].GetBytes(t.ReqID[:0]); err != nil {
+		return err
+	}
+	if t.Message, err = elems[1].GetBytes(t.Message[:0]); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package discv5
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net"
+
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// NodeID is the identifier of a node in discv5, the keccak256 hash
+// of the uncompressed public key of the node
+type NodeID [32]byte
+
+func (n NodeID) String() string {
+	return hex.EncodeToString(n[:])
+}
+
+// PubkeyToID returns the node id of the public key
+func PubkeyToID(pub *ecdsa.PublicKey) NodeID {
+	var id NodeID
+	copy(id[:], crypto.Keccak256(crypto.MarshallPublicKey(pub)[1:]))
+	return id
+}
+
+// logDistance returns the logarithmic distance between two ids
+func logDistance(a, b NodeID) uint {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return uint(len(a)-i)*8 - uint(bits.LeadingZeros8(x))
+		}
+	}
+	return 0
+}
+
+// closer returns true if a is closer to the target than b
+func closer(target, a, b NodeID) bool {
+	for i := range target {
+		da, db := a[i]^target[i], b[i]^target[i]
+		if da != db {
+			return da < db
+		}
+	}
+	return false
+}
+
+// Node is a node in the discv5 network
+type Node struct {
+	ID     NodeID
+	Pubkey *ecdsa.PublicKey
+	Addr   *net.UDPAddr
+	Record *enr.Record
+}
+
+// NewNode creates a node out of its signed record
+func NewNode(record *enr.Record) (*Node, error) {
+	if err := record.VerifySignature(); err != nil {
+		return nil, err
+	}
+	pub, err := record.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := enode.SelectEnode(record, false)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.UDP == 0 {
+		return nil, fmt.Errorf("record does not have an udp port")
+	}
+	n := &Node{
+		ID:     PubkeyToID(pub),
+		Pubkey: pub,
+		Addr:   &net.UDPAddr{IP: endpoint.IP, Port: int(endpoint.UDP)},
+		Record: record,
+	}
+	return n, nil
+}
+
+// ParseNode parses a node from its text record (enr:...)
+func ParseNode(s string) (*Node, error) {
+	record, err := enr.Unmarshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return NewNode(record)
+}
+
+// Enode returns the enode address of the node. It fails if neither the
+// record nor the public key of the node are known (i.e. the sender of a
+// request that is not in the table).
+func (n *Node) Enode() (string, error) {
+	if n.Record != nil {
+		endpoint, err := enode.SelectEnode(n.Record, false)
+		if err != nil {
+			return "", err
+		}
+		return endpoint.String(), nil
+	}
+	if n.Pubkey == nil {
+		return "", fmt.Errorf("node %s is not known", n.ID)
+	}
+	endpoint := &enode.Enode{
+		ID:  enode.PubkeyToEnode(n.Pubkey),
+		IP:  n.Addr.IP,
+		UDP: uint16(n.Addr.Port),
+	}
+	return endpoint.String(), nil
+}
+
+func (n *Node) String() string {
+	return fmt.Sprintf("%s@%s", n.ID.String()[:16], n.Addr)
+}
@@ -0,0 +1,129 @@
+package discv5
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/umbracle/go-devp2p/crypto"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	idSignatureText  = "discovery v5 identity proof"
+	keyAgreementText = "discovery v5 key agreement"
+
+	// maxSessions is the maximum number of sessions cached
+	maxSessions = 1024
+)
+
+// session holds the keys agreed with a remote node in the handshake
+type session struct {
+	writeKey []byte
+	readKey  []byte
+}
+
+// deriveKeys derives the initiator and recipient keys of a session
+func deriveKeys(secret []byte, initiator, recipient NodeID, challengeData []byte) ([]byte, []byte, error) {
+	info := make([]byte, 0, len(keyAgreementText)+64)
+	info = append(info, keyAgreementText...)
+	info = append(info, initiator[:]...)
+	info = append(info, recipient[:]...)
+
+	kdf := hkdf.New(sha256.New, secret, challengeData, info)
+
+	keys := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, keys); err != nil {
+		return nil, nil, err
+	}
+	return keys[:16], keys[16:], nil
+}
+
+func idSignatureHash(challengeData, ephPubkey []byte, destID NodeID) []byte {
+	h := sha256.New()
+	h.Write([]byte(idSignatureText))
+	h.Write(challengeData)
+	h.Write(ephPubkey)
+	h.Write(destID[:])
+	return h.Sum(nil)
+}
+
+// signIDNonce creates the id signature of the handshake
+func signIDNonce(priv *ecdsa.PrivateKey, challengeData, ephPubkey []byte, destID NodeID) ([]byte, error) {
+	sig, err := crypto.Sign(priv, idSignatureHash(challengeData, ephPubkey, destID))
+	if err != nil {
+		return nil, err
+	}
+	// remove the recovery id
+	return sig[:64], nil
+}
+
+// verifyIDSignature verifies the id signature of the handshake
+func verifyIDSignature(pub *ecdsa.PublicKey, sig, challengeData, ephPubkey []byte, destID NodeID) error {
+	if !crypto.VerifySignature(pub, idSignatureHash(challengeData, ephPubkey, destID), sig) {
+		return fmt.Errorf("invalid id signature")
+	}
+	return nil
+}
+
+type sessionKey struct {
+	id   NodeID
+	addr string
+}
+
+// sessionCache stores the sessions with the remote nodes. Sessions
+// are bound to both the id and the address of the remote node.
+type sessionCache struct {
+	lock     sync.Mutex
+	sessions map[sessionKey]*session
+	order    []sessionKey
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{
+		sessions: map[sessionKey]*session{},
+	}
+}
+
+func (s *sessionCache) get(id NodeID, addr string) *session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.sessions[sessionKey{id, addr}]
+}
+
+func (s *sessionCache) store(id NodeID, addr string, sess *session) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := sessionKey{id, addr}
+	if _, ok := s.sessions[key]; !ok {
+		s.order = append(s.order, key)
+	}
+	s.sessions[key] = sess
+
+	// evict the oldest session
+	if len(s.order) > maxSessions {
+		delete(s.sessions, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *sessionCache) delete(id NodeID, addr string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := sessionKey{id, addr}
+	if _, ok := s.sessions[key]; !ok {
+		return
+	}
+	delete(s.sessions, key)
+	for i, k := range s.order {
+		if k == key {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
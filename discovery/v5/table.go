@@ -0,0 +1,124 @@
+package discv5
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// bucketSize is the maximum number of nodes in a bucket
+	bucketSize = 16
+
+	// numBuckets is the number of log distances
+	numBuckets = 256
+)
+
+// table stores the nodes in buckets by log distance to the local node
+type table struct {
+	lock    sync.Mutex
+	self    NodeID
+	buckets [numBuckets][]*Node
+}
+
+func newTable(self NodeID) *table {
+	return &table{self: self}
+}
+
+// add adds or refreshes the node in the table. It returns false if the bucket is full.
+func (t *table) add(n *Node) bool {
+	if n.ID == t.self {
+		return false
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	bucket := &t.buckets[logDistance(t.self, n.ID)-1]
+	for i, m := range *bucket {
+		if m.ID == n.ID {
+			// move the node to the end of the bucket as most recently seen.
+			// Keep the newest record.
+			if m.Record.Seq() > n.Record.Seq() {
+				n = m
+			}
+			*bucket = append(append((*bucket)[:i], (*bucket)[i+1:]...), n)
+			return true
+		}
+	}
+	if len(*bucket) >= bucketSize {
+		return false
+	}
+	*bucket = append(*bucket, n)
+	return true
+}
+
+// remove removes the node from the table
+func (t *table) remove(id NodeID) {
+	if id == t.self {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	bucket := &t.buckets[logDistance(t.self, id)-1]
+	for i, m := range *bucket {
+		if m.ID == id {
+			*bucket = append((*bucket)[:i], (*bucket)[i+1:]...)
+			return
+		}
+	}
+}
+
+// get returns the node with the given id
+func (t *table) get(id NodeID) (*Node, bool) {
+	if id == t.self {
+		return nil, false
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, n := range t.buckets[logDistance(t.self, id)-1] {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// atDistance returns the nodes at the given log distance
+func (t *table) atDistance(d uint) []*Node {
+	if d == 0 || d > numBuckets {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]*Node{}, t.buckets[d-1]...)
+}
+
+// closest returns the 'num' nodes closest to the target
+func (t *table) closest(target NodeID, num int) []*Node {
+	res := t.all()
+	sort.Slice(res, func(i, j int) bool {
+		return closer(target, res[i].ID, res[j].ID)
+	})
+	if len(res) > num {
+		res = res[:num]
+	}
+	return res
+}
+
+// all returns all the nodes in the table
+func (t *table) all() []*Node {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	res := []*Node{}
+	for _, bucket := range t.buckets {
+		res = append(res, bucket...)
+	}
+	return res
+}
@@ -0,0 +1,174 @@
+package discv5
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/umbracle/go-devp2p/discovery"
+)
+
+// TalkHandler handles the TALKREQ requests of a protocol. The node is the
+// sender of the request, its record is only set if the node is in the table.
+// Otherwise, Node.Enode returns an error.
+// The returned bytes are sent back in the TALKRESP message.
+type TalkHandler func(node *Node, req []byte) []byte
+
+// TalkOption is an option to register a talk protocol
+type TalkOption func(*talkProtocol)
+
+// WithTalkRateLimit limits the number of requests per second handled
+// for the protocol. Requests over the limit are dropped.
+func WithTalkRateLimit(rate float64, burst int) TalkOption {
+	return func(t *talkProtocol) {
+		t.limiter = discovery.NewTokenBucket(rate, burst)
+	}
+}
+
+// TalkMetrics are the counters of a talk protocol
+type TalkMetrics struct {
+	// RequestsIn is the number of requests received
+	RequestsIn uint64
+
+	// RequestsDropped is the number of requests dropped by the rate limit
+	RequestsDropped uint64
+
+	// RequestsOut is the number of requests sent
+	RequestsOut uint64
+
+	// RequestsFailed is the number of requests sent without response
+	RequestsFailed uint64
+}
+
+type talkProtocol struct {
+	handler TalkHandler
+	limiter *discovery.TokenBucket
+	metrics TalkMetrics
+}
+
+// talkRegistry stores the talk protocols
+type talkRegistry struct {
+	lock      sync.Mutex
+	protocols map[string]*talkProtocol
+}
+
+func newTalkRegistry() *talkRegistry {
+	return &talkRegistry{
+		protocols: map[string]*talkProtocol{},
+	}
+}
+
+// lookup returns the protocol if it is registered or used in a request
+func (t *talkRegistry) lookup(protocol string) (*talkProtocol, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	p, ok := t.protocols[protocol]
+	return p, ok
+}
+
+// get returns the protocol, it is created if it does not exists to track
+// the metrics. It is only used with the protocols of the local node.
+func (t *talkRegistry) get(protocol string) *talkProtocol {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	p, ok := t.protocols[protocol]
+	if !ok {
+		p = &talkProtocol{}
+		t.protocols[protocol] = p
+	}
+	return p
+}
+
+func (t *talkRegistry) register(protocol string, handler TalkHandler, opts ...TalkOption) {
+	p := t.get(protocol)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	p.handler = handler
+	p.limiter = nil
+	for _, opt := range opts {
+		opt(p)
+	}
+}
+
+func (t *talkRegistry) handle(protocol string, node *Node, req []byte) ([]byte, bool) {
+	p, ok := t.lookup(protocol)
+	if !ok {
+		// unknown protocols get an empty response
+		return nil, true
+	}
+
+	t.lock.Lock()
+	handler, limiter := p.handler, p.limiter
+	t.lock.Unlock()
+
+	if handler == nil {
+		// the protocol is only used to send requests
+		return nil, true
+	}
+	atomic.AddUint64(&p.metrics.RequestsIn, 1)
+
+	if limiter != nil && !limiter.Allow(time.Now()) {
+		atomic.AddUint64(&p.metrics.RequestsDropped, 1)
+		return nil, false
+	}
+	return handler(node, req), true
+}
+
+// RegisterTalkHandler registers the handler for the TALKREQ requests of the protocol
+func (b *Backend) RegisterTalkHandler(protocol string, handler TalkHandler, opts ...TalkOption) {
+	b.talk.register(protocol, handler, opts...)
+}
+
+// TalkMetrics returns the metrics of the protocol
+func (b *Backend) TalkMetrics(protocol string) TalkMetrics {
+	p, ok := b.talk.lookup(protocol)
+	if !ok {
+		return TalkMetrics{}
+	}
+	return TalkMetrics{
+		RequestsIn:      atomic.LoadUint64(&p.metrics.RequestsIn),
+		RequestsDropped: atomic.LoadUint64(&p.metrics.RequestsDropped),
+		RequestsOut:     atomic.LoadUint64(&p.metrics.RequestsOut),
+		RequestsFailed:  atomic.LoadUint64(&p.metrics.RequestsFailed),
+	}
+}
+
+// Talk sends a TALKREQ request of the protocol to the node and returns the response
+func (b *Backend) Talk(n *Node, protocol string, payload []byte, timeout time.Duration) ([]byte, error) {
+	p := b.talk.get(protocol)
+	atomic.AddUint64(&p.metrics.RequestsOut, 1)
+
+	var res []byte
+	err := b.request(n, &talkRequest{Protocol: protocol, Message: payload}, timeout, func(msg message) (bool, error) {
+		resp, ok := msg.(*talkResponse)
+		if !ok {
+			return false, fmt.Errorf("expected talk response but found %d", msg.Kind())
+		}
+		res = resp.Message
+		return true, nil
+	})
+	if err != nil {
+		atomic.AddUint64(&p.metrics.RequestsFailed, 1)
+		return nil, err
+	}
+	return res, nil
+}
+
+func (b *Backend) handleTalkRequest(id NodeID, addr *net.UDPAddr, msg *talkRequest) error {
+	node, ok := b.table.get(id)
+	if !ok {
+		node = &Node{ID: id, Addr: addr}
+	}
+
+	resp, ok := b.talk.handle(msg.Protocol, node, msg.Message)
+	if !ok {
+		return fmt.Errorf("talk request dropped: protocol, %s", msg.Protocol)
+	}
+	return b.sendResponse(id, addr, &talkResponse{ReqID: msg.ReqID, Message: resp})
+}
@@ -0,0 +1,84 @@
+package discv5
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/discovery"
+)
+
+func TestTalk(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	b1.RegisterTalkHandler("echo", func(node *Node, req []byte) []byte {
+		assert.Equal(t, b0.id, node.ID)
+		return append([]byte("echo "), req...)
+	})
+
+	resp, err := b0.Talk(b1.Self(), "echo", []byte("hello"), time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo hello", string(resp))
+
+	// unknown protocols get an empty response
+	resp, err = b0.Talk(b1.Self(), "unknown", []byte("hello"), time.Second)
+	assert.NoError(t, err)
+	assert.Empty(t, resp)
+
+	assert.Equal(t, TalkMetrics{RequestsOut: 1}, b0.TalkMetrics("echo"))
+	assert.Equal(t, TalkMetrics{RequestsIn: 1}, b1.TalkMetrics("echo"))
+
+	// the requests of unknown protocols are not tracked
+	assert.Equal(t, TalkMetrics{}, b1.TalkMetrics("unknown"))
+	_, ok := b1.talk.lookup("unknown")
+	assert.False(t, ok)
+}
+
+func TestTalk_UnknownSender(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	done := make(chan *Node, 1)
+	b1.RegisterTalkHandler("test", func(node *Node, req []byte) []byte {
+		done <- node
+		return req
+	})
+
+	// the sender is not in the table (the response fails
+	// since there is no session with the sender either)
+	msg := &talkRequest{Protocol: "test", Message: []byte{1}}
+	b1.handleTalkRequest(b0.id, b0.Self().Addr, msg)
+
+	node := <-done
+	assert.Nil(t, node.Record)
+	_, err := node.Enode()
+	assert.Error(t, err)
+}
+
+func TestTalkRateLimit(t *testing.T) {
+	network := &discovery.MockNetwork{}
+
+	b0 := newTestBackend(t, network)
+	b1 := newTestBackend(t, network)
+
+	b1.RegisterTalkHandler("test", func(node *Node, req []byte) []byte {
+		return req
+	}, WithTalkRateLimit(0.1, 2))
+
+	for i := 0; i < 2; i++ {
+		_, err := b0.Talk(b1.Self(), "test", []byte{1}, time.Second)
+		assert.NoError(t, err)
+	}
+
+	// the third request is dropped
+	_, err := b0.Talk(b1.Self(), "test", []byte{1}, 100*time.Millisecond)
+	assert.Error(t, err)
+
+	assert.Equal(t, TalkMetrics{RequestsOut: 3, RequestsFailed: 1}, b0.TalkMetrics("test"))
+	assert.Equal(t, TalkMetrics{RequestsIn: 3, RequestsDropped: 1}, b1.TalkMetrics("test"))
+}
@@ -0,0 +1,238 @@
+package discv5
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// Packet flags
+const (
+	flagMessage   = 0
+	flagWhoareyou = 1
+	flagHandshake = 2
+)
+
+const (
+	protocolID = "discv5"
+	version    = 1
+
+	maskingIVSize    = 16
+	nonceSize        = 12
+	idNonceSize      = 16
+	staticHeaderSize = 6 + 2 + 1 + nonceSize + 2
+
+	// sizes of the authdata for each flag
+	messageAuthSize       = 32
+	whoareyouAuthSize     = idNonceSize + 8
+	handshakeAuthHeadSize = 32 + 1 + 1
+
+	minPacketSize = 63
+	maxPacketSize = 1280
+
+	// gcmTagSize is the size of the authentication tag of the aes-gcm ciphertext
+	gcmTagSize = 16
+)
+
+// Nonce is the nonce of a packet
+type Nonce [nonceSize]byte
+
+// header is the unmasked header of a packet
+type header struct {
+	IV       [maskingIVSize]byte
+	Flag     byte
+	Nonce    Nonce
+	AuthData []byte
+}
+
+// encode returns the unmasked header including the masking iv
+func (h *header) encode() []byte {
+	buf := make([]byte, 0, maskingIVSize+staticHeaderSize+len(h.AuthData))
+	buf = append(buf, h.IV[:]...)
+	buf = append(buf, protocolID...)
+	buf = append(buf, byte(version>>8), byte(version))
+	buf = append(buf, h.Flag)
+	buf = append(buf, h.Nonce[:]...)
+	buf = append(buf, byte(len(h.AuthData)>>8), byte(len(h.AuthData)))
+	buf = append(buf, h.AuthData...)
+	return buf
+}
+
+// maskHeader masks the header with the id of the destination node
+func maskHeader(destID NodeID, headerData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(destID[:16])
+	if err != nil {
+		return nil, err
+	}
+	masked := make([]byte, len(headerData))
+	copy(masked, headerData[:maskingIVSize])
+
+	stream := cipher.NewCTR(block, headerData[:maskingIVSize])
+	stream.XORKeyStream(masked[maskingIVSize:], headerData[maskingIVSize:])
+	return masked, nil
+}
+
+// decodeHeader unmasks the header of the packet with our node id. It returns
+// the header, the unmasked header data (used as associated data of the
+// message) and the encrypted message.
+func decodeHeader(localID NodeID, packet []byte) (*header, []byte, []byte, error) {
+	if len(packet) < minPacketSize {
+		return nil, nil, nil, fmt.Errorf("packet too small: %d", len(packet))
+	}
+	if len(packet) > maxPacketSize {
+		return nil, nil, nil, fmt.Errorf("packet too big: %d", len(packet))
+	}
+
+	block, err := aes.NewCipher(localID[:16])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stream := cipher.NewCTR(block, packet[:maskingIVSize])
+
+	headerData := make([]byte, maskingIVSize+staticHeaderSize, len(packet))
+	copy(headerData, packet[:maskingIVSize])
+	stream.XORKeyStream(headerData[maskingIVSize:], packet[maskingIVSize:maskingIVSize+staticHeaderSize])
+
+	static := headerData[maskingIVSize:]
+	if !bytes.Equal(static[:6], []byte(protocolID)) {
+		return nil, nil, nil, fmt.Errorf("invalid protocol id")
+	}
+	if v := binary.BigEndian.Uint16(static[6:8]); v != version {
+		return nil, nil, nil, fmt.Errorf("invalid version %d", v)
+	}
+
+	h := &header{
+		Flag: static[8],
+	}
+	copy(h.IV[:], packet[:maskingIVSize])
+	copy(h.Nonce[:], static[9:9+nonceSize])
+
+	authSize := int(binary.BigEndian.Uint16(static[9+nonceSize:]))
+	offset := maskingIVSize + staticHeaderSize
+	if len(packet) < offset+authSize {
+		return nil, nil, nil, fmt.Errorf("authdata too big: %d", authSize)
+	}
+
+	headerData = headerData[:offset+authSize]
+	stream.XORKeyStream(headerData[offset:], packet[offset:offset+authSize])
+	h.AuthData = headerData[offset:]
+
+	return h, headerData, packet[offset+authSize:], nil
+}
+
+// encodePacket masks the header and appends the message
+func encodePacket(destID NodeID, h *header, msg []byte) ([]byte, error) {
+	masked, err := maskHeader(destID, h.encode())
+	if err != nil {
+		return nil, err
+	}
+	packet := append(masked, msg...)
+	if len(packet) > maxPacketSize {
+		return nil, fmt.Errorf("packet too big: %d", len(packet))
+	}
+	return packet, nil
+}
+
+// encryptMessage encrypts the message with aes-gcm using the header as associated data
+func encryptMessage(key []byte, nonce Nonce, pt, ad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce[:], pt, ad), nil
+}
+
+// decryptMessage decrypts an aes-gcm message
+func decryptMessage(key []byte, nonce Nonce, ct, ad []byte) ([]byte, error) {
+	if len(ct) < gcmTagSize {
+		return nil, fmt.Errorf("message too small")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce[:], ct, ad)
+}
+
+// newHeader creates a header with a random masking iv and nonce
+func newHeader(flag byte, authData []byte) (*header, error) {
+	h := &header{
+		Flag:     flag,
+		AuthData: authData,
+	}
+	if _, err := crand.Read(h.IV[:]); err != nil {
+		return nil, err
+	}
+	if _, err := crand.Read(h.Nonce[:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// whoareyouAuth is the authdata of a WHOAREYOU packet
+type whoareyouAuth struct {
+	IDNonce [idNonceSize]byte
+	ENRSeq  uint64
+}
+
+func (w *whoareyouAuth) encode() []byte {
+	buf := make([]byte, whoareyouAuthSize)
+	copy(buf, w.IDNonce[:])
+	binary.BigEndian.PutUint64(buf[idNonceSize:], w.ENRSeq)
+	return buf
+}
+
+func (w *whoareyouAuth) decode(b []byte) error {
+	if len(b) != whoareyouAuthSize {
+		return fmt.Errorf("invalid whoareyou authdata size %d", len(b))
+	}
+	copy(w.IDNonce[:], b[:idNonceSize])
+	w.ENRSeq = binary.BigEndian.Uint64(b[idNonceSize:])
+	return nil
+}
+
+// handshakeAuth is the authdata of a handshake packet
+type handshakeAuth struct {
+	SrcID     NodeID
+	Signature []byte
+	EphPubkey []byte
+	Record    []byte // rlp encoded record, it might be empty
+}
+
+func (h *handshakeAuth) encode() []byte {
+	buf := make([]byte, 0, handshakeAuthHeadSize+len(h.Signature)+len(h.EphPubkey)+len(h.Record))
+	buf = append(buf, h.SrcID[:]...)
+	buf = append(buf, byte(len(h.Signature)), byte(len(h.EphPubkey)))
+	buf = append(buf, h.Signature...)
+	buf = append(buf, h.EphPubkey...)
+	buf = append(buf, h.Record...)
+	return buf
+}
+
+func (h *handshakeAuth) decode(b []byte) error {
+	if len(b) < handshakeAuthHeadSize {
+		return fmt.Errorf("handshake authdata too small")
+	}
+	copy(h.SrcID[:], b[:32])
+	sigSize, keySize := int(b[32]), int(b[33])
+
+	b = b[handshakeAuthHeadSize:]
+	if len(b) < sigSize+keySize {
+		return fmt.Errorf("handshake authdata too small")
+	}
+	h.Signature = b[:sigSize]
+	h.EphPubkey = b[sigSize : sigSize+keySize]
+	h.Record = b[sigSize+keySize:]
+	return nil
+}
@@ -0,0 +1,161 @@
+package discv5
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// test vectors from the discv5 wire specification
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return b
+}
+
+func decodeID(t *testing.T, s string) NodeID {
+	var id NodeID
+	copy(id[:], decodeHex(t, s))
+	return id
+}
+
+var (
+	vecNodeA        = "aaaa8419e9f49d0083561b48287df592939a8d19947d8c0ef88f2a4856a69fbb"
+	vecNodeB        = "bbbb9d047f0488c0b5a93c1c3f2d8bafc7c8ff337024a55434a0d0555de64db9"
+	vecEphemeralKey = "fb757dc581730490a1d7a00deea65e9b1936924caaea8f44d476014856b68736"
+	vecChallenge    = "000000000000000000000000000000006469736376350001010102030405060708090a0b0c00180102030405060708090a0b0c0d0e0f100000000000000000"
+)
+
+func TestVectorECDH(t *testing.T) {
+	priv, err := crypto.ParsePrivateKey(decodeHex(t, vecEphemeralKey))
+	assert.NoError(t, err)
+	pub, err := crypto.ParseCompressedPubKey(decodeHex(t, "039961e4c2356d61bedb83052c115d311acb3a96f5777296dcf297351130266231"))
+	assert.NoError(t, err)
+
+	secret := crypto.ECDH(priv, pub)
+	assert.Equal(t, "033b11a2a1f214567e1537ce5e509ffd9b21373247f2a3ff6841f4976f53165e7e", hex.EncodeToString(secret))
+}
+
+func TestVectorKeyDerivation(t *testing.T) {
+	priv, err := crypto.ParsePrivateKey(decodeHex(t, vecEphemeralKey))
+	assert.NoError(t, err)
+	pub, err := crypto.ParseCompressedPubKey(decodeHex(t, "0317931e6e0840220642f230037d285d122bc59063221ef3226b1f403ddc69ca91"))
+	assert.NoError(t, err)
+
+	initKey, recKey, err := deriveKeys(crypto.ECDH(priv, pub), decodeID(t, vecNodeA), decodeID(t, vecNodeB), decodeHex(t, vecChallenge))
+	assert.NoError(t, err)
+	assert.Equal(t, "dccc82d81bd610f4f76d3ebe97a40571", hex.EncodeToString(initKey))
+	assert.Equal(t, "ac74bb8773749920b0d3a8881c173ec5", hex.EncodeToString(recKey))
+}
+
+func TestVectorIDSignature(t *testing.T) {
+	priv, err := crypto.ParsePrivateKey(decodeHex(t, vecEphemeralKey))
+	assert.NoError(t, err)
+
+	ephPubkey := decodeHex(t, "039961e4c2356d61bedb83052c115d311acb3a96f5777296dcf297351130266231")
+	challenge := decodeHex(t, vecChallenge)
+	destID := decodeID(t, vecNodeB)
+
+	sig, err := signIDNonce(priv, challenge, ephPubkey, destID)
+	assert.NoError(t, err)
+	assert.Equal(t, "94852a1e2318c4e5e9d422c98eaf19d1d90d876b29cd06ca7cb7546d0fff7b484fe86c09a064fe72bdbef73ba8e9c34df0cd2b53e9d65528c2c7f336d5dfc6e6", hex.EncodeToString(sig))
+
+	assert.NoError(t, verifyIDSignature(&priv.PublicKey, sig, challenge, ephPubkey, destID))
+	assert.Error(t, verifyIDSignature(&priv.PublicKey, sig, challenge, ephPubkey, decodeID(t, vecNodeA)))
+}
+
+func TestVectorPingPacket(t *testing.T) {
+	packet := decodeHex(t, "00000000000000000000000000000000088b3d4342774649325f313964a39e55ea96c005ad52be8c7560413a7008f16c9e6d2f43bbea8814a546b7409ce783d34c4f53245d08dab84102ed931f66d1492acb308fa1c6715b9d139b81acbdcc")
+
+	h, headerData, msgData, err := decodeHeader(decodeID(t, vecNodeB), packet)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(flagMessage), h.Flag)
+	assert.Equal(t, decodeHex(t, vecNodeA), h.AuthData)
+
+	// the read key of the test vector is all zeros
+	pt, err := decryptMessage(make([]byte, 16), h.Nonce, msgData, headerData)
+	assert.NoError(t, err)
+
+	msg, err := decodeMessage(pt)
+	assert.NoError(t, err)
+	assert.Equal(t, &ping{ReqID: []byte{0, 0, 0, 1}, ENRSeq: 2}, msg)
+
+	// encode the same packet
+	h2 := &header{Flag: flagMessage, Nonce: h.Nonce, AuthData: h.AuthData}
+	ct, err := encryptMessage(make([]byte, 16), h2.Nonce, encodeMessage(msg), h2.encode())
+	assert.NoError(t, err)
+
+	packet2, err := encodePacket(decodeID(t, vecNodeB), h2, ct)
+	assert.NoError(t, err)
+	assert.Equal(t, packet, packet2)
+}
+
+func TestHeaderInvalid(t *testing.T) {
+	id := decodeID(t, vecNodeB)
+
+	h, err := newHeader(flagWhoareyou, (&whoareyouAuth{ENRSeq: 1}).encode())
+	assert.NoError(t, err)
+	packet, err := encodePacket(id, h, nil)
+	assert.NoError(t, err)
+
+	// masked with another id
+	_, _, _, err = decodeHeader(decodeID(t, vecNodeA), packet)
+	assert.Error(t, err)
+
+	// too small
+	_, _, _, err = decodeHeader(id, packet[:minPacketSize-1])
+	assert.Error(t, err)
+
+	h2, _, _, err := decodeHeader(id, packet)
+	assert.NoError(t, err)
+
+	var auth whoareyouAuth
+	assert.NoError(t, auth.decode(h2.AuthData))
+	assert.Equal(t, uint64(1), auth.ENRSeq)
+}
+
+func TestMessagesEncoding(t *testing.T) {
+	priv, _ := crypto.GenerateKey()
+	udp := enr.Uint16(30303)
+	ip := enr.IPv4(net.ParseIP("127.0.0.1").To4())
+
+	record := &enr.Record{}
+	record.SetSeq(1)
+	record.Set("ip", &ip)
+	record.Set("udp", &udp)
+	assert.NoError(t, record.Sign(priv))
+
+	cases := []message{
+		&ping{ReqID: []byte{1}, ENRSeq: 10},
+		&pong{ReqID: []byte{1}, ENRSeq: 10, ToIP: net.ParseIP("127.0.0.1").To4(), ToPort: 30303},
+		&findnode{ReqID: []byte{1}, Distances: []uint{0, 255, 256}},
+		&talkRequest{ReqID: []byte{1}, Protocol: "test", Message: []byte{1, 2, 3}},
+		&talkResponse{ReqID: []byte{1}, Message: []byte{1, 2, 3}},
+	}
+	for _, c := range cases {
+		msg, err := decodeMessage(encodeMessage(c))
+		assert.NoError(t, err)
+		assert.Equal(t, c, msg)
+	}
+
+	msg, err := decodeMessage(encodeMessage(&nodes{ReqID: []byte{1}, Total: 1, Records: []*enr.Record{record}}))
+	assert.NoError(t, err)
+
+	resp := msg.(*nodes)
+	assert.Len(t, resp.Records, 1)
+	assert.Equal(t, record.Marshal(), resp.Records[0].Marshal())
+	assert.NoError(t, resp.Records[0].VerifySignature())
+
+	// request id too big
+	_, err = decodeMessage(encodeMessage(&ping{ReqID: make([]byte, 9)}))
+	assert.Error(t, err)
+
+	// distance out of range
+	_, err = decodeMessage(encodeMessage(&findnode{ReqID: []byte{1}, Distances: []uint{257}}))
+	assert.Error(t, err)
+}
@@ -7,8 +7,11 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"sync/atomic"
 
 	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/discovery"
+	"github.com/umbracle/go-devp2p/enode"
 	"github.com/umbracle/go-devp2p/enr"
 )
 
@@ -131,3 +134,37 @@ func (l *localResolver) LookupTXT(ctx context.Context, name string) ([]string, e
 	}
 	return nil, fmt.Errorf("entry '%s' not found", name)
 }
+
+// Nodes returns an iterator over the nodes of the tree. Records
+// without an endpoint are skipped.
+func (d *DnsDisc) Nodes() discovery.Iterator {
+	return &dnsIter{d: d}
+}
+
+type dnsIter struct {
+	d      *DnsDisc
+	cur    *enode.Node
+	closed int32
+}
+
+func (i *dnsIter) Next() bool {
+	for atomic.LoadInt32(&i.closed) == 0 && i.d.Has() {
+		node, err := enode.NodeFromRecord(i.d.Next())
+		if err != nil {
+			i.d.logger.Printf("[DEBUG] skip record: err, %v", err)
+			continue
+		}
+		i.cur = node
+		return true
+	}
+	i.cur = nil
+	return false
+}
+
+func (i *dnsIter) Node() *enode.Node {
+	return i.cur
+}
+
+func (i *dnsIter) Close() {
+	atomic.StoreInt32(&i.closed, 1)
+}
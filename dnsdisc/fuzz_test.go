@@ -0,0 +1,29 @@
+package dnsdisc
+
+import (
+	"testing"
+)
+
+func FuzzParseEntry(f *testing.F) {
+	f.Add("enrtree://AKA3AM6LPBYEUDMVNU3BSVQJ5AD45Y7YPOHJLEF6W26QOE4VTUDPE@snap.mainnet.ethdisco.net")
+	f.Add("enrtree-branch:BRU43CYW2S4HCEES3DXJ2QYOYQ,AU6OB5RACUZMZMDZJLNJT7TGY4,BVCJRD3VTLDVFX7OPWPMP33SAU")
+	f.Add("enrtree-root:v1 e=O4E5ES6EIACUASHASBGJGEC67M l=FDXN3SN67NA5DKA4J2GOK7BVQI seq=3189 sig=1SSfIYpZxREoK6eGeJZqicZb87O4y8D8YPOD2omG-C8Sb0aD0yInfMjX3F_GEUNHZKt4bpdQsZSJZ-16pndwtQE")
+	f.Add("enr:-HW4QOFzoVLaFJnNhbgMoDXPnOvcdVuj7pDpqRvh6BRDO68aVi5ZcjB3vzQRZH2IcLBGHzo8uUN3snqmgTiE56CH3AMBgmlkgnY0iXNlY3AyNTZrMaECC2_24YYkYHEgdzxlSNKQEnHhuNAbNlMlWJxrJxbAFvA")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		entry, err := parseEntry(s)
+		if err != nil {
+			return
+		}
+
+		// the text of a parsed entry is stable
+		str := entry.String()
+		entry2, err := parseEntry(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str != entry2.String() {
+			t.Fatalf("round trip does not match: %s %s", str, entry2.String())
+		}
+	})
+}
@@ -0,0 +1,373 @@
+package enode
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+const (
+	// iptrackWindow is the time window in which endpoint statements are considered
+	iptrackWindow = 5 * time.Minute
+
+	// iptrackMinStatements is the minimum number of statements required to predict the ip
+	iptrackMinStatements = 10
+)
+
+// SeqStore persists the sequence number of the local node record
+type SeqStore interface {
+	LoadSeq() (uint64, error)
+	StoreSeq(seq uint64) error
+}
+
+// NoopSeqStore is a SeqStore that does not persist the sequence number
+type NoopSeqStore struct {
+}
+
+// LoadSeq implements the SeqStore interface
+func (n *NoopSeqStore) LoadSeq() (uint64, error) {
+	return 0, nil
+}
+
+// StoreSeq implements the SeqStore interface
+func (n *NoopSeqStore) StoreSeq(seq uint64) error {
+	return nil
+}
+
+// JSONSeqStore stores the sequence number locally in json format
+type JSONSeqStore struct {
+	path string
+}
+
+var _ SeqStore = (*JSONSeqStore)(nil)
+
+// NewJSONSeqStore creates a json SeqStore
+func NewJSONSeqStore(path string) *JSONSeqStore {
+	return &JSONSeqStore{
+		path: filepath.Join(path, "localnode.json"),
+	}
+}
+
+type seqEntry struct {
+	Seq uint64
+}
+
+// LoadSeq implements the SeqStore interface
+func (j *JSONSeqStore) LoadSeq() (uint64, error) {
+	if _, err := os.Stat(j.path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	data, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		return 0, err
+	}
+	var entry seqEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return 0, err
+	}
+	return entry.Seq, nil
+}
+
+// StoreSeq implements the SeqStore interface
+func (j *JSONSeqStore) StoreSeq(seq uint64) error {
+	data, err := json.Marshal(&seqEntry{Seq: seq})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(j.path, data, 0644)
+}
+
+// LocalNode maintains the signed node record (ENR) of the local node.
+// The sequence number of the record is increased and persisted every
+// time any of the entries changes.
+type LocalNode struct {
+	lock sync.Mutex
+
+	key   *ecdsa.PrivateKey
+	id    ID
+	store SeqStore
+	seq   uint64
+
+	// entries are the custom entries of the record
+	entries map[string]enr.Entry
+
+	// record is the last signed record, nil if it was never signed
+	record *enr.Record
+
+	// dirty is set if the entries have changed since the last signed record
+	dirty bool
+
+	// endpoints for the ipv4 and ipv6 families
+	ip4 *localEndpoint
+	ip6 *localEndpoint
+}
+
+// localEndpoint tracks the advertised ip of one of the ip families
+type localEndpoint struct {
+	key      string
+	staticIP net.IP
+	tracker  *ipTracker
+}
+
+func (e *localEndpoint) get() net.IP {
+	if e.staticIP != nil {
+		return e.staticIP
+	}
+	return e.tracker.predicted
+}
+
+// NewLocalNode creates a new local node. The sequence number is loaded from the store.
+func NewLocalNode(key *ecdsa.PrivateKey, store SeqStore) (*LocalNode, error) {
+	if store == nil {
+		store = &NoopSeqStore{}
+	}
+	seq, err := store.LoadSeq()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load local node seq: %v", err)
+	}
+	l := &LocalNode{
+		key:     key,
+		id:      PubkeyToEnode(&key.PublicKey),
+		store:   store,
+		seq:     seq,
+		entries: map[string]enr.Entry{},
+		dirty:   true,
+		ip4: &localEndpoint{
+			key:     "ip",
+			tracker: newIPTracker(iptrackWindow, iptrackMinStatements),
+		},
+		ip6: &localEndpoint{
+			key:     "ip6",
+			tracker: newIPTracker(iptrackWindow, iptrackMinStatements),
+		},
+	}
+	return l, nil
+}
+
+// ID returns the id of the local node
+func (l *LocalNode) ID() ID {
+	return l.id
+}
+
+// Seq returns the sequence number of the record
+func (l *LocalNode) Seq() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sign()
+	return l.seq
+}
+
+// Sign signs the record if any of the entries has changed. If the record
+// cannot be signed (i.e. the entries exceed the size limit of the record)
+// the previous record is kept.
+func (l *LocalNode) Sign() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.sign()
+}
+
+// Set sets an entry in the record. The record is only updated
+// if the value is different from the current one.
+func (l *LocalNode) Set(k string, v enr.Entry) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.setLocked(k, v)
+}
+
+// Delete removes an entry from the record
+func (l *LocalNode) Delete(k string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, ok := l.entries[k]; ok {
+		delete(l.entries, k)
+		l.invalidate()
+	}
+}
+
+func (l *LocalNode) endpointFor(ip net.IP) *localEndpoint {
+	if ip.To4() != nil {
+		return l.ip4
+	}
+	return l.ip6
+}
+
+// SetStaticIP sets the ip advertised in the record for the family
+// of the ip. It has precedence over the ip predicted with the
+// endpoint statements.
+func (l *LocalNode) SetStaticIP(ip net.IP) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	e := l.endpointFor(ip)
+	e.staticIP = ip
+	l.updateIP(e)
+}
+
+// UDPEndpointStatement records the endpoint that the node at 'from'
+// has seen for us. It is used to predict our external ip.
+func (l *LocalNode) UDPEndpointStatement(from, endpoint *net.UDPAddr) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	e := l.endpointFor(endpoint.IP)
+	e.tracker.addStatement(from.String(), endpoint.IP, time.Now())
+	l.updateIP(e)
+}
+
+// IP returns the ipv4 address advertised in the record, if any
+func (l *LocalNode) IP() net.IP {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.ip4.get()
+}
+
+// IP6 returns the ipv6 address advertised in the record, if any
+func (l *LocalNode) IP6() net.IP {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.ip6.get()
+}
+
+// updateIP updates the ip entry of the endpoint if the advertised ip has changed
+func (l *LocalNode) updateIP(e *localEndpoint) {
+	e.tracker.predict(time.Now())
+
+	ip := e.get()
+	if ip == nil || ip.IsUnspecified() {
+		return
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		entry := enr.IPv4(ip4)
+		l.setLocked(e.key, &entry)
+	} else {
+		entry := enr.IPv6(ip)
+		l.setLocked(e.key, &entry)
+	}
+}
+
+func (l *LocalNode) setLocked(k string, v enr.Entry) {
+	if old, ok := l.entries[k]; ok && bytes.Equal(encodeEntry(old), encodeEntry(v)) {
+		return
+	}
+	l.entries[k] = v
+	l.invalidate()
+}
+
+// Record returns the signed record of the local node. It is
+// the previous record if the current entries cannot be signed.
+func (l *LocalNode) Record() *enr.Record {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.sign()
+	return l.record
+}
+
+func (l *LocalNode) invalidate() {
+	l.dirty = true
+}
+
+// sign builds and signs a new record if any of the entries has changed.
+// On failure the previous record is kept and the record is not signed
+// again until the entries change.
+func (l *LocalNode) sign() error {
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+
+	keys := make([]string, 0, len(l.entries))
+	for k := range l.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seq := l.seq + 1
+	record := &enr.Record{}
+	record.SetSeq(seq)
+	for _, k := range keys {
+		record.Set(k, l.entries[k])
+	}
+	if err := record.Sign(l.key); err != nil {
+		return fmt.Errorf("failed to sign local node record: %v", err)
+	}
+	if err := l.store.StoreSeq(seq); err != nil {
+		return fmt.Errorf("failed to store local node seq: %v", err)
+	}
+	l.seq = seq
+	l.record = record
+	return nil
+}
+
+func encodeEntry(e enr.Entry) []byte {
+	ar := &fastrlp.Arena{}
+	return e.MarshalRLPWith(ar).MarshalTo(nil)
+}
+
+// ipTracker predicts the external ip of the node out of the
+// endpoints that other nodes report for us
+type ipTracker struct {
+	window        time.Duration
+	minStatements int
+	statements    map[string]ipStatement
+	predicted     net.IP
+}
+
+type ipStatement struct {
+	ip   net.IP
+	time time.Time
+}
+
+func newIPTracker(window time.Duration, minStatements int) *ipTracker {
+	return &ipTracker{
+		window:        window,
+		minStatements: minStatements,
+		statements:    map[string]ipStatement{},
+	}
+}
+
+func (t *ipTracker) addStatement(from string, ip net.IP, now time.Time) {
+	t.statements[from] = ipStatement{ip: ip, time: now}
+}
+
+// predict returns the ip reported by most of the nodes within the
+// time window if there are enough statements
+func (t *ipTracker) predict(now time.Time) net.IP {
+	counts := map[string]int{}
+	for from, s := range t.statements {
+		if s.time.Add(t.window).Before(now) {
+			delete(t.statements, from)
+			continue
+		}
+		counts[s.ip.String()]++
+	}
+	if len(t.statements) < t.minStatements {
+		return t.predicted
+	}
+
+	var best string
+	for ip, count := range counts {
+		if best == "" || count > counts[best] || (count == counts[best] && ip < best) {
+			best = ip
+		}
+	}
+	t.predicted = net.ParseIP(best)
+	return t.predicted
+}
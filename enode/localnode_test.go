@@ -0,0 +1,128 @@
+package enode
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+func TestLocalNode_Seq(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	store := NewJSONSeqStore(t.TempDir())
+
+	l, err := NewLocalNode(key, store)
+	assert.NoError(t, err)
+
+	udp := enr.Uint16(30303)
+	l.Set("udp", &udp)
+	assert.Equal(t, uint64(1), l.Seq())
+
+	// setting the same value does not change the record
+	l.Set("udp", &udp)
+	assert.Equal(t, uint64(1), l.Seq())
+
+	udp2 := enr.Uint16(30304)
+	l.Set("udp", &udp2)
+	assert.Equal(t, uint64(2), l.Seq())
+
+	record := l.Record()
+	assert.Equal(t, uint64(2), record.Seq())
+
+	var found enr.Uint16
+	assert.NoError(t, record.Load("udp", &found))
+	assert.Equal(t, udp2, found)
+
+	// the seq number is loaded from the store
+	seq, err := store.LoadSeq()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+
+	l2, err := NewLocalNode(key, store)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), l2.Seq())
+}
+
+type failingSeqStore struct {
+	NoopSeqStore
+	fail bool
+}
+
+func (f *failingSeqStore) StoreSeq(seq uint64) error {
+	if f.fail {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func TestLocalNode_SignFailure(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	store := &failingSeqStore{}
+
+	l, err := NewLocalNode(key, store)
+	assert.NoError(t, err)
+
+	udp := enr.Uint16(30303)
+	l.Set("udp", &udp)
+	assert.NoError(t, l.Sign())
+	record := l.Record()
+
+	// the previous record is kept if the seq cannot be stored
+	store.fail = true
+	udp2 := enr.Uint16(30304)
+	l.Set("udp", &udp2)
+	assert.Error(t, l.Sign())
+	assert.Equal(t, record, l.Record())
+	assert.Equal(t, uint64(1), l.Seq())
+
+	// or if the record exceeds the size limit
+	store.fail = false
+	data := enr.String(make([]byte, enr.SizeLimit))
+	l.Set("data", &data)
+	assert.Error(t, l.Sign())
+	assert.Equal(t, record, l.Record())
+
+	l.Delete("data")
+	assert.NoError(t, l.Sign())
+	assert.Equal(t, uint64(2), l.Seq())
+}
+
+func TestLocalNode_PredictIP(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	l, err := NewLocalNode(key, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, l.IP())
+
+	external := &net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 30303}
+	for i := 0; i < iptrackMinStatements; i++ {
+		from := &net.UDPAddr{IP: net.ParseIP(fmt.Sprintf("10.0.0.%d", i)), Port: 30303}
+		l.UDPEndpointStatement(from, external)
+	}
+	assert.True(t, l.IP().Equal(external.IP))
+
+	var ip enr.IPv4
+	assert.NoError(t, l.Record().Load("ip", &ip))
+	assert.Equal(t, "1.2.3.4", net.IP(ip).String())
+
+	// the static ip has precedence
+	l.SetStaticIP(net.ParseIP("5.6.7.8"))
+	assert.NoError(t, l.Record().Load("ip", &ip))
+	assert.Equal(t, "5.6.7.8", net.IP(ip).String())
+}
+
+func TestIPTracker_Window(t *testing.T) {
+	tracker := newIPTracker(time.Minute, 2)
+	now := time.Now()
+
+	tracker.addStatement("a", net.ParseIP("1.1.1.1"), now.Add(-2*time.Minute))
+	tracker.addStatement("b", net.ParseIP("1.1.1.1"), now)
+	assert.Nil(t, tracker.predict(now))
+
+	tracker.addStatement("c", net.ParseIP("1.1.1.1"), now)
+	assert.Equal(t, "1.1.1.1", tracker.predict(now).String())
+}
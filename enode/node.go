@@ -0,0 +1,170 @@
+package enode
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// Node is a node of the network. It is created out of an enode url, a
+// node record (ENR) or a public key with its endpoint.
+type Node struct {
+	enode  Enode
+	pubkey *ecdsa.PublicKey
+	record *enr.Record
+}
+
+// NewNode creates a node out of a public key and its endpoint
+func NewNode(pub *ecdsa.PublicKey, ip net.IP, tcp, udp uint16) *Node {
+	return &Node{
+		enode:  Enode{ID: PubkeyToEnode(pub), IP: ip, TCP: tcp, UDP: udp},
+		pubkey: pub,
+	}
+}
+
+// NodeFromEnode creates a node out of its enode address
+func NodeFromEnode(e *Enode) (*Node, error) {
+	pub, err := e.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Node{enode: *e, pubkey: pub}, nil
+}
+
+// NodeFromRecord creates a node out of its signed record. The ipv4
+// endpoint of the record is used if it has both ipv4 and ipv6.
+func NodeFromRecord(r *enr.Record) (*Node, error) {
+	if err := r.VerifySignature(); err != nil {
+		return nil, err
+	}
+	e, err := SelectEnode(r, false)
+	if err != nil {
+		return nil, err
+	}
+	n, err := NodeFromEnode(e)
+	if err != nil {
+		return nil, err
+	}
+	n.record = r
+	return n, nil
+}
+
+// NodeWithEnode creates a node out of its signed record and the endpoint where
+// it was found (i.e. by discovery). The endpoint of the record is preferred but
+// the ip and ports that the record does not have are taken from the endpoint.
+func NodeWithEnode(r *enr.Record, e *Enode) (*Node, error) {
+	if err := r.VerifySignature(); err != nil {
+		return nil, err
+	}
+	pub, err := r.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if id := PubkeyToEnode(pub); id != e.ID {
+		return nil, fmt.Errorf("record of node %s found at node %s", id, e.ID)
+	}
+
+	n := &Node{enode: *e, pubkey: pub, record: r}
+	if re, err := SelectEnode(r, e.IP != nil && e.IP.To4() == nil); err == nil {
+		n.enode = n.fill(re)
+	}
+	return n, nil
+}
+
+// ParseNode parses either an enode url (enode://...) or a text record (enr:...)
+func ParseNode(s string) (*Node, error) {
+	if strings.HasPrefix(s, "enr:") {
+		record, err := enr.Unmarshal(s, enr.CheckSize, enr.CheckSignature)
+		if err != nil {
+			return nil, err
+		}
+		return NodeFromRecord(record)
+	}
+	e, err := ParseURL(s)
+	if err != nil {
+		return nil, err
+	}
+	return NodeFromEnode(e)
+}
+
+// ID returns the id of the node
+func (n *Node) ID() ID {
+	return n.enode.ID
+}
+
+// Pubkey returns the public key of the node
+func (n *Node) Pubkey() *ecdsa.PublicKey {
+	return n.pubkey
+}
+
+// IP returns the ip address of the node
+func (n *Node) IP() net.IP {
+	return n.enode.IP
+}
+
+// TCP returns the tcp port of the node
+func (n *Node) TCP() uint16 {
+	return n.enode.TCP
+}
+
+// UDP returns the udp port of the node
+func (n *Node) UDP() uint16 {
+	return n.enode.UDP
+}
+
+// TCPAddr returns the tcp address of the node
+func (n *Node) TCPAddr() net.TCPAddr {
+	return n.enode.TCPAddr()
+}
+
+// Record returns the record of the node, nil if it is not known
+func (n *Node) Record() *enr.Record {
+	return n.record
+}
+
+// Enode returns the enode address of the node
+func (n *Node) Enode() *Enode {
+	e := n.enode
+	return &e
+}
+
+// SelectEnode returns the enode address of the node. If the record of the
+// node includes both ipv4 and ipv6 endpoints, ipv6 is only used if requested.
+func (n *Node) SelectEnode(ipv6 bool) *Enode {
+	if n.record != nil {
+		if e, err := SelectEnode(n.record, ipv6); err == nil {
+			res := n.fill(e)
+			return &res
+		}
+	}
+	return n.Enode()
+}
+
+// fill returns the endpoint with the ports it does not have taken from the node
+func (n *Node) fill(e *Enode) Enode {
+	res := *e
+	if res.TCP == 0 {
+		res.TCP = n.enode.TCP
+	}
+	if res.UDP == 0 {
+		res.UDP = n.enode.UDP
+	}
+	return res
+}
+
+// URL returns the enode url of the node
+func (n *Node) URL() string {
+	return n.enode.String()
+}
+
+// String returns the text record of the node if known, the enode url otherwise.
+// The output can be parsed back with ParseNode.
+func (n *Node) String() string {
+	if n.record != nil {
+		return n.record.Marshal()
+	}
+	return n.URL()
+}
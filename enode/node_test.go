@@ -0,0 +1,105 @@
+package enode
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+func TestNode_Sources(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	ip4 := enr.IPv4(net.ParseIP("1.2.3.4").To4())
+	ip6 := enr.IPv6(net.ParseIP("2001:db8::1"))
+	tcp, udp := enr.TCP(30303), enr.UDP(30301)
+
+	record := &enr.Record{}
+	record.SetEntry(&ip4)
+	record.SetEntry(&ip6)
+	record.SetEntry(&tcp)
+	record.SetEntry(&udp)
+	assert.NoError(t, record.Sign(key))
+
+	n0 := NewNode(&key.PublicKey, net.ParseIP("1.2.3.4"), 30303, 30301)
+
+	n1, err := ParseNode(n0.URL())
+	assert.NoError(t, err)
+
+	n2, err := ParseNode(record.Marshal())
+	assert.NoError(t, err)
+
+	for _, n := range []*Node{n0, n1, n2} {
+		assert.Equal(t, PubkeyToEnode(&key.PublicKey), n.ID())
+		assert.True(t, key.PublicKey.Equal(n.Pubkey()))
+		assert.Equal(t, "1.2.3.4", n.IP().String())
+		assert.Equal(t, uint16(30303), n.TCP())
+		assert.Equal(t, uint16(30301), n.UDP())
+		assert.Equal(t, n0.URL(), n.URL())
+	}
+
+	// only the node created out of the record knows it
+	assert.Nil(t, n1.Record())
+	assert.Equal(t, n1.URL(), n1.String())
+	assert.Equal(t, record.Marshal(), n2.String())
+
+	// the ipv6 endpoint is only known with the record
+	assert.Equal(t, "2001:db8::1", n2.SelectEnode(true).IP.String())
+	assert.Equal(t, "1.2.3.4", n1.SelectEnode(true).IP.String())
+}
+
+func TestNode_WithEnode(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	e := &Enode{ID: PubkeyToEnode(&key.PublicKey), IP: net.ParseIP("1.2.3.4"), TCP: 30303, UDP: 30301}
+
+	// the record does not have an ip nor a tcp port
+	udp := enr.UDP(30305)
+	record := &enr.Record{}
+	record.SetEntry(&udp)
+	assert.NoError(t, record.Sign(key))
+
+	n, err := NodeWithEnode(record, e)
+	assert.NoError(t, err)
+	assert.Equal(t, record, n.Record())
+	assert.Equal(t, "1.2.3.4", n.IP().String())
+	assert.Equal(t, uint16(30303), n.TCP())
+	assert.Equal(t, uint16(30301), n.UDP())
+
+	// the endpoint of the record is preferred
+	ip := enr.IPv4(net.ParseIP("5.6.7.8").To4())
+	record.SetEntry(&ip)
+	assert.NoError(t, record.Sign(key))
+
+	n, err = NodeWithEnode(record, e)
+	assert.NoError(t, err)
+	assert.Equal(t, "5.6.7.8", n.IP().String())
+	assert.Equal(t, uint16(30303), n.TCP())
+	assert.Equal(t, uint16(30305), n.UDP())
+	assert.Equal(t, uint16(30303), n.SelectEnode(true).TCP)
+
+	// the record must belong to the node
+	other, _ := crypto.GenerateKey()
+	assert.NoError(t, record.Sign(other))
+	_, err = NodeWithEnode(record, e)
+	assert.Error(t, err)
+}
+
+func TestNode_ParseInvalid(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	ip4 := enr.IPv4(net.ParseIP("1.2.3.4").To4())
+	record := &enr.Record{}
+	record.SetEntry(&ip4)
+	assert.NoError(t, record.Sign(key))
+
+	// the record has been modified after signing
+	udp := enr.UDP(30303)
+	record.SetEntry(&udp)
+	_, err := ParseNode(record.Marshal())
+	assert.Error(t, err)
+
+	_, err = ParseNode("enode://abcd@127.0.0.1:30303")
+	assert.Error(t, err)
+}
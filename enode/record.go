@@ -0,0 +1,65 @@
+package enode
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+// RecordEnodes returns the ipv4 and ipv6 endpoints advertised in the
+// node record. Either of them is nil if the record does not include
+// an address for that family.
+func RecordEnodes(r *enr.Record) (*Enode, *Enode, error) {
+	pub, err := r.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	id := PubkeyToEnode(pub)
+
+	var tcp enr.TCP
+	var udp enr.UDP
+	r.LoadEntry(&tcp)
+	r.LoadEntry(&udp)
+
+	var ip4, ip6 *Enode
+
+	var ip enr.IPv4
+	if err := r.LoadEntry(&ip); err == nil {
+		ip4 = &Enode{ID: id, IP: net.IP(ip), TCP: uint16(tcp), UDP: uint16(udp)}
+	}
+
+	var ipv6 enr.IPv6
+	if err := r.LoadEntry(&ipv6); err == nil {
+		// tcp6 and udp6 default to tcp and udp if not present
+		tcp6, udp6 := enr.TCP6(tcp), enr.UDP6(udp)
+		r.LoadEntry(&tcp6)
+		r.LoadEntry(&udp6)
+
+		ip6 = &Enode{ID: id, IP: net.IP(ipv6), TCP: uint16(tcp6), UDP: uint16(udp6)}
+	}
+
+	if ip4 == nil && ip6 == nil {
+		return nil, nil, fmt.Errorf("record does not have an ip address")
+	}
+	return ip4, ip6, nil
+}
+
+// SelectEnode returns the endpoint to use for the record. If the record
+// advertises both families, ipv6 is only used if 'ipv6' is true.
+func SelectEnode(r *enr.Record, ipv6 bool) (*Enode, error) {
+	ip4, ip6, err := RecordEnodes(r)
+	if err != nil {
+		return nil, err
+	}
+	if ip4 == nil {
+		return ip6, nil
+	}
+	if ip6 == nil {
+		return ip4, nil
+	}
+	if ipv6 {
+		return ip6, nil
+	}
+	return ip4, nil
+}
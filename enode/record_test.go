@@ -0,0 +1,59 @@
+package enode
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enr"
+)
+
+func TestRecordEnodes_DualStack(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	ip4 := enr.IPv4(net.ParseIP("1.2.3.4").To4())
+	ip6 := enr.IPv6(net.ParseIP("2001:db8::1"))
+	tcp, udp, tcp6 := enr.Uint16(30303), enr.Uint16(30301), enr.Uint16(30304)
+
+	record := &enr.Record{}
+	record.Set("ip", &ip4)
+	record.Set("ip6", &ip6)
+	record.Set("tcp", &tcp)
+	record.Set("udp", &udp)
+	record.Set("tcp6", &tcp6)
+	assert.NoError(t, record.Sign(key))
+
+	v4, v6, err := RecordEnodes(record)
+	assert.NoError(t, err)
+
+	id := PubkeyToEnode(&key.PublicKey)
+	assert.Equal(t, id, v4.ID)
+	assert.Equal(t, "1.2.3.4", v4.IP.String())
+	assert.Equal(t, uint16(30303), v4.TCP)
+	assert.Equal(t, uint16(30301), v4.UDP)
+
+	// udp6 is not set and defaults to udp
+	assert.Equal(t, id, v6.ID)
+	assert.Equal(t, "2001:db8::1", v6.IP.String())
+	assert.Equal(t, uint16(30304), v6.TCP)
+	assert.Equal(t, uint16(30301), v6.UDP)
+
+	node, err := SelectEnode(record, false)
+	assert.NoError(t, err)
+	assert.Equal(t, v4, node)
+
+	node, err = SelectEnode(record, true)
+	assert.NoError(t, err)
+	assert.Equal(t, v6, node)
+}
+
+func TestRecordEnodes_NoIP(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	record := &enr.Record{}
+	assert.NoError(t, record.Sign(key))
+
+	_, _, err := RecordEnodes(record)
+	assert.Error(t, err)
+}
@@ -64,13 +64,43 @@ func (r *Record) AddEntry(k string, v Entry) {
 	r.entries.Sort()
 }
 
+// Set adds the entry or replaces it if the key already exists
+func (r *Record) Set(k string, v Entry) {
+	ar := &fastrlp.Arena{}
+	r.setValue(k, v.MarshalRLPWith(ar))
+}
+
+func (r *Record) setValue(k string, v *fastrlp.Value) {
+	for i := range r.entries {
+		if r.entries[i].k == k {
+			r.entries[i].v = v
+			return
+		}
+	}
+	r.entries = append(r.entries, entry{k: k, v: v})
+	r.entries.Sort()
+}
+
+// Keys returns the sorted keys of the record
+func (r *Record) Keys() []string {
+	keys := []string{}
+	for _, entry := range r.entries {
+		keys = append(keys, entry.k)
+	}
+	return keys
+}
+
 func (r *Record) Marshal() string {
 	return "enr:" + base64.RawURLEncoding.EncodeToString(r.MarshalRLP())
 }
 
 func (r *Record) MarshalRLP() []byte {
 	ar := &fastrlp.Arena{}
+	return r.MarshalRLPWith(ar).MarshalTo(nil)
+}
 
+// MarshalRLPWith marshals the record in the arena
+func (r *Record) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
 	v := ar.NewArray()
 	v.Set(ar.NewCopyBytes(r.signature))
 	v.Set(ar.NewUint(r.seq))
@@ -78,12 +108,44 @@ func (r *Record) MarshalRLP() []byte {
 		v.Set(ar.NewCopyBytes([]byte(entry.k)))
 		v.Set(entry.v)
 	}
+	return v
+}
 
-	buf := v.MarshalTo(nil)
-	return buf
+// content returns the rlp encoding of the record without the signature
+func (r *Record) content() []byte {
+	ar := &fastrlp.Arena{}
+
+	v := ar.NewArray()
+	v.Set(ar.NewUint(r.seq))
+	for _, entry := range r.entries {
+		v.Set(ar.NewCopyBytes([]byte(entry.k)))
+		v.Set(entry.v)
+	}
+	return v.MarshalTo(nil)
 }
 
-func (r *Record) Unmarshal(s string) error {
+// SizeLimit is the maximum size in bytes of an encoded record
+const SizeLimit = 300
+
+// UnmarshalOption validates a decoded record with its rlp encoding
+type UnmarshalOption func(r *Record, raw []byte) error
+
+// CheckSize rejects the records larger than SizeLimit
+func CheckSize(r *Record, raw []byte) error {
+	if len(raw) > SizeLimit {
+		return fmt.Errorf("record too large: %d bytes, limit %d", len(raw), SizeLimit)
+	}
+	return nil
+}
+
+// CheckSignature rejects the records without a valid "v4" signature
+func CheckSignature(r *Record, raw []byte) error {
+	return r.VerifySignature()
+}
+
+// Unmarshal decodes the record from its text format (enr:...) and
+// validates it with the given options
+func (r *Record) Unmarshal(s string, opts ...UnmarshalOption) error {
 	if !strings.HasPrefix(s, "enr:") {
 		return fmt.Errorf("there is no enr prefix")
 	}
@@ -94,6 +156,11 @@ func (r *Record) Unmarshal(s string) error {
 	if err := r.UnmarshalRLP(raw); err != nil {
 		return err
 	}
+	for _, opt := range opts {
+		if err := opt(r, raw); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -103,6 +170,12 @@ func (r *Record) UnmarshalRLP(b []byte) error {
 	if err != nil {
 		return err
 	}
+	return r.UnmarshalRLPWith(v)
+}
+
+// UnmarshalRLPWith unmarshals the record from a parsed value. The entries
+// of the record keep a reference to the value so the parser must not be reused.
+func (r *Record) UnmarshalRLPWith(v *fastrlp.Value) error {
 	elems, err := v.GetElems()
 	if err != nil {
 		return err
@@ -152,9 +225,11 @@ func (r *Record) UnmarshalRLP(b []byte) error {
 	return nil
 }
 
-func Unmarshal(b string) (*Record, error) {
+// Unmarshal decodes a record from its text format (enr:...). The record is
+// only validated with the given options (i.e. CheckSize, CheckSignature).
+func Unmarshal(b string, opts ...UnmarshalOption) (*Record, error) {
 	r := &Record{}
-	if err := r.Unmarshal(b); err != nil {
+	if err := r.Unmarshal(b, opts...); err != nil {
 		return nil, err
 	}
 	return r, nil
@@ -1,9 +1,13 @@
 package enr
 
 import (
+	"encoding/hex"
+	"net"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
 )
 
 func TestENR(t *testing.T) {
@@ -22,3 +26,91 @@ func TestENR(t *testing.T) {
 	found := record.Marshal()
 	assert.Equal(t, enrStr, found)
 }
+
+func TestENRSign(t *testing.T) {
+	// example record from EIP-778
+	enrStr := "enr:-IS4QHCYrYZbAKWCBRlAy5zzaDZXJBGkcnh4MHcBFZntXNFrdvJjX04jRzjzCBOonrkTfj499SZuOh8R33Ls8RRcy5wBgmlkgnY0gmlwhH8AAAGJc2VjcDI1NmsxoQPKY0yuDUmstAHYpMa2_oxVtw0RW_QAdpzBQA8yWM0xOIN1ZHCCdl8"
+
+	buf, err := hex.DecodeString("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	assert.NoError(t, err)
+
+	priv, err := crypto.ParsePrivateKey(buf)
+	assert.NoError(t, err)
+
+	ip := IPv4(net.IP{127, 0, 0, 1})
+	udp := Uint16(30303)
+
+	record := &Record{}
+	record.SetSeq(1)
+	record.Set("ip", &ip)
+	record.Set("udp", &udp)
+	assert.NoError(t, record.Sign(priv))
+
+	assert.Equal(t, enrStr, record.Marshal())
+	assert.NoError(t, record.VerifySignature())
+
+	// changing the content invalidates the signature
+	udp2 := Uint16(30304)
+	record.Set("udp", &udp2)
+	assert.Error(t, record.VerifySignature())
+}
+
+func TestENRNodeID(t *testing.T) {
+	// example record from EIP-778
+	record, err := Unmarshal("enr:-IS4QHCYrYZbAKWCBRlAy5zzaDZXJBGkcnh4MHcBFZntXNFrdvJjX04jRzjzCBOonrkTfj499SZuOh8R33Ls8RRcy5wBgmlkgnY0gmlwhH8AAAGJc2VjcDI1NmsxoQPKY0yuDUmstAHYpMa2_oxVtw0RW_QAdpzBQA8yWM0xOIN1ZHCCdl8")
+	assert.NoError(t, err)
+
+	id, err := record.NodeID()
+	assert.NoError(t, err)
+	assert.Equal(t, "a448f24c6d18e575453db13171562b71999873db5b286df957af199ec94617f7", hex.EncodeToString(id[:]))
+
+	_, err = (&Record{}).NodeID()
+	assert.Error(t, err)
+}
+
+func TestENRUnknownScheme(t *testing.T) {
+	priv, _ := crypto.GenerateKey()
+
+	record := &Record{}
+	assert.NoError(t, record.Sign(priv))
+	assert.NoError(t, record.VerifySignature())
+
+	// the records of other identity schemes cannot be verified
+	id := ID("v5")
+	record.Set("id", &id)
+	assert.Error(t, record.VerifySignature())
+	_, err := record.NodeID()
+	assert.Error(t, err)
+}
+
+func TestENRUnmarshalOptions(t *testing.T) {
+	priv, _ := crypto.GenerateKey()
+
+	record := &Record{}
+	ip := IPv4(net.IP{127, 0, 0, 1})
+	record.Set("ip", &ip)
+	assert.NoError(t, record.Sign(priv))
+
+	_, err := Unmarshal(record.Marshal(), CheckSize, CheckSignature)
+	assert.NoError(t, err)
+
+	// an invalid signature is only rejected if requested
+	udp := Uint16(30303)
+	record.Set("udp", &udp)
+	_, err = Unmarshal(record.Marshal())
+	assert.NoError(t, err)
+	_, err = Unmarshal(record.Marshal(), CheckSignature)
+	assert.Error(t, err)
+
+	// records over the size limit
+	large := &Record{}
+	str := String(strings.Repeat("a", SizeLimit))
+	large.Set("large", &str)
+	_, err = Unmarshal(large.Marshal())
+	assert.NoError(t, err)
+	_, err = Unmarshal(large.Marshal(), CheckSize)
+	assert.Error(t, err)
+
+	// and they cannot be signed
+	assert.Error(t, large.Sign(priv))
+}
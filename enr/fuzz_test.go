@@ -0,0 +1,38 @@
+package enr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzUnmarshal(f *testing.F) {
+	// example record from EIP-778
+	f.Add("enr:-IS4QHCYrYZbAKWCBRlAy5zzaDZXJBGkcnh4MHcBFZntXNFrdvJjX04jRzjzCBOonrkTfj499SZuOh8R33Ls8RRcy5wBgmlkgnY0gmlwhH8AAAGJc2VjcDI1NmsxoQPKY0yuDUmstAHYpMa2_oxVtw0RW_QAdpzBQA8yWM0xOIN1ZHCCdl8")
+	f.Add("enr:wIA")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		record, err := Unmarshal(s)
+		if err != nil {
+			return
+		}
+		record.VerifySignature()
+
+		var ip IPv4
+		record.Load("ip", &ip)
+		var ip6 IPv6
+		record.Load("ip6", &ip6)
+		var udp Uint16
+		record.Load("udp", &udp)
+
+		// the encoding of a decoded record is stable
+		enc := record.MarshalRLP()
+
+		record2 := &Record{}
+		if err := record2.UnmarshalRLP(enc); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, record2.MarshalRLP()) {
+			t.Fatal("round trip encoding does not match")
+		}
+	})
+}
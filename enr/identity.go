@@ -0,0 +1,75 @@
+package enr
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+)
+
+// IdentityScheme signs and verifies the records of an identity scheme
+type IdentityScheme interface {
+	// Sign sets the identity entries of the record and signs it
+	Sign(r *Record, priv *ecdsa.PrivateKey) error
+
+	// Verify checks the signature of the record
+	Verify(r *Record, sig []byte) error
+
+	// NodeAddr returns the node address derived from the identity entries
+	NodeAddr(r *Record) ([]byte, error)
+}
+
+// schemes are the identity schemes supported by the records
+var schemes = map[string]IdentityScheme{
+	v4: V4ID{},
+}
+
+// Sign signs the record with the "v4" identity scheme. It sets the 'id'
+// and 'secp256k1' entries of the record before signing the content.
+func (r *Record) Sign(priv *ecdsa.PrivateKey) error {
+	return V4ID{}.Sign(r, priv)
+}
+
+// PublicKey returns the public key in the 'secp256k1' entry of the record
+func (r *Record) PublicKey() (*ecdsa.PublicKey, error) {
+	var pub Secp256k1
+	if err := r.LoadEntry(&pub); err != nil {
+		return nil, err
+	}
+	return (*ecdsa.PublicKey)(&pub), nil
+}
+
+// NodeID returns the node id of the record with its identity scheme
+func (r *Record) NodeID() ([32]byte, error) {
+	var id [32]byte
+	scheme, err := r.scheme()
+	if err != nil {
+		return id, err
+	}
+	addr, err := scheme.NodeAddr(r)
+	if err != nil {
+		return id, err
+	}
+	copy(id[:], addr)
+	return id, nil
+}
+
+// VerifySignature verifies the signature of the record with its identity scheme
+func (r *Record) VerifySignature() error {
+	scheme, err := r.scheme()
+	if err != nil {
+		return err
+	}
+	return scheme.Verify(r, r.signature)
+}
+
+// scheme returns the identity scheme in the 'id' entry of the record
+func (r *Record) scheme() (IdentityScheme, error) {
+	var id ID
+	if err := r.LoadEntry(&id); err != nil {
+		return nil, err
+	}
+	scheme, ok := schemes[string(id)]
+	if !ok {
+		return nil, fmt.Errorf("identity scheme %s not supported", id)
+	}
+	return scheme, nil
+}
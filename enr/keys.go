@@ -0,0 +1,230 @@
+package enr
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/forkid"
+)
+
+// KeyedEntry is an entry stored under a well-known key of the record
+type KeyedEntry interface {
+	Entry
+	ENRKey() string
+}
+
+// SetEntry adds the keyed entry or replaces it if the key already exists
+func (r *Record) SetEntry(e KeyedEntry) {
+	r.Set(e.ENRKey(), e)
+}
+
+// LoadEntry loads the keyed entry from the record
+func (r *Record) LoadEntry(e KeyedEntry) error {
+	return r.Load(e.ENRKey(), e)
+}
+
+// ID is the name of the identity scheme ('id' entry)
+type ID string
+
+func (ID) ENRKey() string { return "id" }
+
+func (i ID) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return String(i).MarshalRLPWith(ar)
+}
+
+func (i *ID) UnmarshalRLPWith(v *fastrlp.Value) error {
+	return (*String)(i).UnmarshalRLPWith(v)
+}
+
+// Secp256k1 is the public key of the "v4" identity scheme ('secp256k1' entry)
+type Secp256k1 ecdsa.PublicKey
+
+func (Secp256k1) ENRKey() string { return "secp256k1" }
+
+func (s *Secp256k1) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return ar.NewCopyBytes(crypto.CompressPubKey((*ecdsa.PublicKey)(s)))
+}
+
+func (s *Secp256k1) UnmarshalRLPWith(v *fastrlp.Value) error {
+	buf, err := v.GetBytes(nil, 33)
+	if err != nil {
+		return err
+	}
+	pub, err := crypto.ParseCompressedPubKey(buf)
+	if err != nil {
+		return err
+	}
+	*s = Secp256k1(*pub)
+	return nil
+}
+
+// MarshalText implements the text marshaler interface
+func (s *Secp256k1) MarshalText() ([]byte, error) {
+	return []byte("0x" + hex.EncodeToString(crypto.CompressPubKey((*ecdsa.PublicKey)(s)))), nil
+}
+
+func (IPv4) ENRKey() string { return "ip" }
+
+// MarshalText implements the text marshaler interface
+func (i IPv4) MarshalText() ([]byte, error) {
+	return []byte(net.IP(i).String()), nil
+}
+
+func (IPv6) ENRKey() string { return "ip6" }
+
+// MarshalText implements the text marshaler interface
+func (i IPv6) MarshalText() ([]byte, error) {
+	return []byte(net.IP(i).String()), nil
+}
+
+// TCP is the ipv4 tcp port ('tcp' entry)
+type TCP uint16
+
+func (TCP) ENRKey() string { return "tcp" }
+
+func (t TCP) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return Uint16(t).MarshalRLPWith(ar)
+}
+
+func (t *TCP) UnmarshalRLPWith(v *fastrlp.Value) error {
+	return (*Uint16)(t).UnmarshalRLPWith(v)
+}
+
+// TCP6 is the ipv6 tcp port ('tcp6' entry)
+type TCP6 uint16
+
+func (TCP6) ENRKey() string { return "tcp6" }
+
+func (t TCP6) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return Uint16(t).MarshalRLPWith(ar)
+}
+
+func (t *TCP6) UnmarshalRLPWith(v *fastrlp.Value) error {
+	return (*Uint16)(t).UnmarshalRLPWith(v)
+}
+
+// UDP is the ipv4 udp port ('udp' entry)
+type UDP uint16
+
+func (UDP) ENRKey() string { return "udp" }
+
+func (u UDP) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return Uint16(u).MarshalRLPWith(ar)
+}
+
+func (u *UDP) UnmarshalRLPWith(v *fastrlp.Value) error {
+	return (*Uint16)(u).UnmarshalRLPWith(v)
+}
+
+// UDP6 is the ipv6 udp port ('udp6' entry)
+type UDP6 uint16
+
+func (UDP6) ENRKey() string { return "udp6" }
+
+func (u UDP6) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return Uint16(u).MarshalRLPWith(ar)
+}
+
+func (u *UDP6) UnmarshalRLPWith(v *fastrlp.Value) error {
+	return (*Uint16)(u).UnmarshalRLPWith(v)
+}
+
+// Eth is the 'eth' entry of the nodes on the eth protocol. It contains
+// the fork id of the chain the node is on.
+type Eth []forkid.ID
+
+func (Eth) ENRKey() string { return "eth" }
+
+func (e Eth) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	v := ar.NewArray()
+	for i := range e {
+		v.Set(e[i].MarshalRLPWith(ar))
+	}
+	return v
+}
+
+func (e *Eth) UnmarshalRLPWith(v *fastrlp.Value) error {
+	elems, err := v.GetElems()
+	if err != nil {
+		return err
+	}
+	if len(elems) < 1 {
+		return fmt.Errorf("at least one item expected")
+	}
+	ids := Eth{}
+	for i, elem := range elems {
+		var id forkid.ID
+		if err := id.UnmarshalRLPWith(elem); err != nil {
+			if i == 0 {
+				return err
+			}
+			// there might be additional fields for forward compatibility
+			continue
+		}
+		ids = append(ids, id)
+	}
+	*e = ids
+	return nil
+}
+
+type forkIDJSON struct {
+	Hash string `json:"hash"`
+	Next uint64 `json:"next"`
+}
+
+// MarshalJSON implements the json marshaler interface
+func (e Eth) MarshalJSON() ([]byte, error) {
+	res := []*forkIDJSON{}
+	for _, id := range e {
+		res = append(res, &forkIDJSON{Hash: "0x" + hex.EncodeToString(id.Hash), Next: id.Next})
+	}
+	return json.Marshal(res)
+}
+
+// Snap is the 'snap' entry of the nodes on the snap protocol
+type Snap struct{}
+
+func (Snap) ENRKey() string { return "snap" }
+
+func (s Snap) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return ar.NewArray()
+}
+
+func (s *Snap) UnmarshalRLPWith(v *fastrlp.Value) error {
+	// there might be additional fields for forward compatibility
+	_, err := v.GetElems()
+	return err
+}
+
+// Les is the 'les' entry of the nodes serving the light client protocol
+type Les struct {
+	VfxVersion uint64 `json:"vfxVersion"`
+}
+
+func (Les) ENRKey() string { return "les" }
+
+func (l Les) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	v := ar.NewArray()
+	v.Set(ar.NewUint(l.VfxVersion))
+	return v
+}
+
+func (l *Les) UnmarshalRLPWith(v *fastrlp.Value) error {
+	elems, err := v.GetElems()
+	if err != nil {
+		return err
+	}
+	l.VfxVersion = 0
+	if len(elems) > 0 {
+		// the version is optional
+		if l.VfxVersion, err = elems[0].GetUint64(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
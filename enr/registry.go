@@ -0,0 +1,81 @@
+package enr
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+var (
+	registryLock sync.RWMutex
+
+	// registry are the types of the entries by key
+	registry = map[string]func() Entry{
+		"id":        func() Entry { return new(ID) },
+		"secp256k1": func() Entry { return new(Secp256k1) },
+		"ip":        func() Entry { return new(IPv4) },
+		"ip6":       func() Entry { return new(IPv6) },
+		"tcp":       func() Entry { return new(TCP) },
+		"tcp6":      func() Entry { return new(TCP6) },
+		"udp":       func() Entry { return new(UDP) },
+		"udp6":      func() Entry { return new(UDP6) },
+		"eth":       func() Entry { return new(Eth) },
+		"snap":      func() Entry { return new(Snap) },
+		"les":       func() Entry { return new(Les) },
+	}
+)
+
+// RegisterEntry registers the type of the entries with the given key.
+// Protocols use it to render their own entries in the json format of the
+// record. It replaces any type registered before for the key.
+func RegisterEntry(key string, newEntry func() Entry) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[key] = newEntry
+}
+
+// NewEntry returns an empty entry of the type registered for the key
+func NewEntry(key string) (Entry, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	newEntry, ok := registry[key]
+	if !ok {
+		return nil, false
+	}
+	return newEntry(), true
+}
+
+type recordJSON struct {
+	Seq       uint64                     `json:"seq"`
+	Signature string                     `json:"signature"`
+	Entries   map[string]json.RawMessage `json:"entries"`
+}
+
+// MarshalJSON implements the json marshaler interface. The entries with a
+// registered type are decoded, the rest are the hex of their rlp encoding.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	res := &recordJSON{
+		Seq:       r.seq,
+		Signature: "0x" + hex.EncodeToString(r.signature),
+		Entries:   map[string]json.RawMessage{},
+	}
+	for _, entry := range r.entries {
+		res.Entries[entry.k] = entryJSON(entry)
+	}
+	return json.Marshal(res)
+}
+
+func entryJSON(e entry) json.RawMessage {
+	if typed, ok := NewEntry(e.k); ok {
+		if err := typed.UnmarshalRLPWith(e.v); err == nil {
+			if data, err := json.Marshal(typed); err == nil {
+				return data
+			}
+		}
+	}
+	// unknown entry or it does not match the registered type
+	data, _ := json.Marshal("0x" + hex.EncodeToString(e.v.MarshalTo(nil)))
+	return data
+}
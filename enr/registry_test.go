@@ -0,0 +1,112 @@
+package enr
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/crypto"
+)
+
+func TestKeyedEntries(t *testing.T) {
+	priv, _ := crypto.GenerateKey()
+
+	record := &Record{}
+	ip := IPv4(net.IP{127, 0, 0, 1})
+	record.SetEntry(&ip)
+	tcp := TCP(30303)
+	record.SetEntry(&tcp)
+	record.SetEntry(&Eth{{Hash: []byte{0x1, 0x2, 0x3, 0x4}, Next: 10}})
+	record.SetEntry(&Snap{})
+	record.SetEntry(&Les{VfxVersion: 1})
+	assert.NoError(t, record.Sign(priv))
+
+	record2, err := Unmarshal(record.Marshal(), CheckSignature)
+	assert.NoError(t, err)
+
+	var pub Secp256k1
+	assert.NoError(t, record2.LoadEntry(&pub))
+	assert.True(t, priv.PublicKey.Equal((*ecdsa.PublicKey)(&pub)))
+
+	var tcp2 TCP
+	assert.NoError(t, record2.LoadEntry(&tcp2))
+	assert.Equal(t, tcp, tcp2)
+
+	// the typed entries use the same encoding as the generic ones
+	var udp UDP
+	assert.Error(t, record2.LoadEntry(&udp))
+	var port Uint16
+	assert.NoError(t, record2.Load("tcp", &port))
+	assert.Equal(t, Uint16(30303), port)
+
+	var eth Eth
+	assert.NoError(t, record2.LoadEntry(&eth))
+	assert.Equal(t, Eth{{Hash: []byte{0x1, 0x2, 0x3, 0x4}, Next: 10}}, eth)
+
+	var les Les
+	assert.NoError(t, record2.LoadEntry(&les))
+	assert.Equal(t, uint64(1), les.VfxVersion)
+}
+
+type testEntry struct {
+	Value uint64 `json:"value"`
+}
+
+func (e *testEntry) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
+	return ar.NewUint(e.Value)
+}
+
+func (e *testEntry) UnmarshalRLPWith(v *fastrlp.Value) (err error) {
+	e.Value, err = v.GetUint64()
+	return err
+}
+
+func TestRecordJSON(t *testing.T) {
+	priv, _ := crypto.GenerateKey()
+
+	record := &Record{}
+	record.SetSeq(2)
+	ip := IPv4(net.IP{127, 0, 0, 1})
+	record.SetEntry(&ip)
+	udp := UDP(30303)
+	record.SetEntry(&udp)
+	record.SetEntry(&Eth{{Hash: []byte{0x1, 0x2, 0x3, 0x4}, Next: 10}})
+	record.Set("custom", &testEntry{Value: 5})
+	assert.NoError(t, record.Sign(priv))
+
+	decode := func() map[string]interface{} {
+		data, err := json.Marshal(record)
+		assert.NoError(t, err)
+
+		var res struct {
+			Seq     uint64
+			Entries map[string]interface{}
+		}
+		assert.NoError(t, json.Unmarshal(data, &res))
+		assert.Equal(t, uint64(2), res.Seq)
+		return res.Entries
+	}
+
+	entries := decode()
+	assert.Equal(t, "v4", entries["id"])
+	assert.Equal(t, "127.0.0.1", entries["ip"])
+	assert.Equal(t, float64(30303), entries["udp"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"hash": "0x01020304", "next": float64(10)}}, entries["eth"])
+
+	// the unknown entries are rendered as the hex of their rlp encoding
+	assert.Equal(t, "0x05", entries["custom"])
+
+	// and the protocols can register their types
+	RegisterEntry("custom", func() Entry { return new(testEntry) })
+	defer func() {
+		registryLock.Lock()
+		delete(registry, "custom")
+		registryLock.Unlock()
+	}()
+
+	entries = decode()
+	assert.Equal(t, map[string]interface{}{"value": float64(5)}, entries["custom"])
+}
@@ -0,0 +1,60 @@
+package enr
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/crypto"
+)
+
+// v4 is the name of the identity scheme based on secp256k1 keys
+const v4 = "v4"
+
+// V4ID is the "v4" identity scheme of EIP-778. The records have the
+// compressed secp256k1 public key in the 'secp256k1' entry and are
+// signed with the keccak256 hash of their content.
+type V4ID struct{}
+
+var _ IdentityScheme = V4ID{}
+
+// Sign sets the 'id' and 'secp256k1' entries of the record and signs its content
+func (V4ID) Sign(r *Record, priv *ecdsa.PrivateKey) error {
+	ar := &fastrlp.Arena{}
+	r.setValue("id", ar.NewString(v4))
+	r.setValue("secp256k1", ar.NewCopyBytes(crypto.CompressPubKey(&priv.PublicKey)))
+
+	sig, err := crypto.Sign(priv, crypto.Keccak256(r.content()))
+	if err != nil {
+		return err
+	}
+	// remove the recovery id at the end of the signature
+	r.signature = sig[:len(sig)-1]
+
+	if size := len(r.MarshalRLP()); size > SizeLimit {
+		r.signature = nil
+		return fmt.Errorf("record too large: %d bytes, limit %d", size, SizeLimit)
+	}
+	return nil
+}
+
+// Verify checks the signature against the public key of the record
+func (V4ID) Verify(r *Record, sig []byte) error {
+	pub, err := r.PublicKey()
+	if err != nil {
+		return err
+	}
+	if !crypto.VerifySignature(pub, crypto.Keccak256(r.content()), sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// NodeAddr returns the keccak256 hash of the uncompressed public key
+func (V4ID) NodeAddr(r *Record) ([]byte, error) {
+	pub, err := r.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(crypto.MarshallPublicKey(pub)[1:]), nil
+}
@@ -92,3 +92,19 @@ func (p *Peer) PrettyID() string {
 func (p *Peer) Close() error {
 	return p.conn.Close()
 }
+
+// Disconnect closes the peer connection with the given reason
+func (p *Peer) Disconnect(reason DiscReason) error {
+	return p.conn.Disconnect(reason)
+}
+
+// DisconnectReason returns why the peer was disconnected and whether
+// it was the remote peer who closed the connection. It returns nil
+// if the peer is still connected.
+func (p *Peer) DisconnectReason() *DisconnectError {
+	err := p.conn.Err()
+	if err == nil {
+		return nil
+	}
+	return NewDisconnectError(err, false)
+}
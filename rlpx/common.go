@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p"
 	"github.com/umbracle/go-devp2p/enode"
 )
 
@@ -16,62 +17,27 @@ const (
 	snappyProtocolVersion = 5
 )
 
-type DiscReason uint
+// DiscReason is the reason to close a session. It is an alias
+// of the transport independent devp2p.DiscReason
+type DiscReason = devp2p.DiscReason
 
 const (
-	DiscRequested DiscReason = iota
-	DiscNetworkError
-	DiscProtocolError
-	DiscUselessPeer
-	DiscTooManyPeers
-	DiscAlreadyConnected
-	DiscIncompatibleVersion
-	DiscInvalidIdentity
-	DiscQuitting
-	DiscUnexpectedIdentity
-	DiscSelf
-	DiscReadTimeout
-	DiscSubprotocolError = 0x10
-	DiscUnknown          = 0x100
+	DiscRequested           = devp2p.DiscRequested
+	DiscNetworkError        = devp2p.DiscNetworkError
+	DiscProtocolError       = devp2p.DiscProtocolError
+	DiscUselessPeer         = devp2p.DiscUselessPeer
+	DiscTooManyPeers        = devp2p.DiscTooManyPeers
+	DiscAlreadyConnected    = devp2p.DiscAlreadyConnected
+	DiscIncompatibleVersion = devp2p.DiscIncompatibleVersion
+	DiscInvalidIdentity     = devp2p.DiscInvalidIdentity
+	DiscQuitting            = devp2p.DiscQuitting
+	DiscUnexpectedIdentity  = devp2p.DiscUnexpectedIdentity
+	DiscSelf                = devp2p.DiscSelf
+	DiscReadTimeout         = devp2p.DiscReadTimeout
+	DiscSubprotocolError    = devp2p.DiscSubprotocolError
+	DiscUnknown             = devp2p.DiscUnknown
 )
 
-func (d DiscReason) String() string {
-	switch d {
-	case DiscRequested:
-		return "disconnect requested"
-	case DiscNetworkError:
-		return "network error"
-	case DiscProtocolError:
-		return "breach of protocol"
-	case DiscUselessPeer:
-		return "useless peer"
-	case DiscTooManyPeers:
-		return "too many peers"
-	case DiscAlreadyConnected:
-		return "already connected"
-	case DiscIncompatibleVersion:
-		return "incompatible p2p protocol version"
-	case DiscInvalidIdentity:
-		return "invalid node identity"
-	case DiscQuitting:
-		return "client quitting"
-	case DiscUnexpectedIdentity:
-		return "unexpected identity"
-	case DiscSelf:
-		return "connected to self"
-	case DiscReadTimeout:
-		return "read timeout"
-	case DiscSubprotocolError:
-		return "subprotocol error"
-	default:
-		return fmt.Sprintf("unknown disconnect reason: %d", d)
-	}
-}
-
-func (d DiscReason) Error() string {
-	return d.String()
-}
-
 func decodeDiscMsg(buf []byte) (DiscReason, error) {
 	p := &fastrlp.Parser{}
 
@@ -0,0 +1,153 @@
+package rlpx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/umbracle/ecies"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+)
+
+func FuzzInfo(f *testing.F) {
+	prv, _ := crypto.GenerateKey()
+	info := &Info{
+		Version:    BaseProtocolVersion,
+		Name:       "mock",
+		Caps:       Capabilities{&Cap{"eth", 66}, &Cap{"snap", 1}},
+		ListenPort: 30303,
+		ID:         enode.PubkeyToEnode(&prv.PublicKey),
+	}
+	f.Add(info.MarshalRLP(nil))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info := &Info{}
+		if err := info.UnmarshalRLP(data); err != nil {
+			return
+		}
+
+		// the encoding of a decoded message is stable
+		enc := info.MarshalRLP(nil)
+		info2 := &Info{}
+		if err := info2.UnmarshalRLP(enc); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, info2.MarshalRLP(nil)) {
+			t.Fatal("round trip encoding does not match")
+		}
+	})
+}
+
+func FuzzDecodeDiscMsg(f *testing.F) {
+	f.Add([]byte{0xc1, byte(DiscQuitting)})
+	f.Add([]byte{byte(DiscQuitting)})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeDiscMsg(data)
+	})
+}
+
+func FuzzAuthMsg(f *testing.F) {
+	prv0, _ := crypto.GenerateKey()
+	prv1, _ := crypto.GenerateKey()
+
+	client := &handshakeState{
+		isClient: true,
+		conn: handshakeConn{
+			local:  ecies.ImportECDSA(prv0),
+			remote: ecies.ImportECDSAPublic(&prv1.PublicKey),
+		},
+	}
+	authMsg, err := client.makeAuthMsg(prv0)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(false, authMsg.MarshalRLP(nil))
+
+	// pre-EIP-8 plain format
+	plain := []byte{}
+	plain = append(plain, authMsg.Signature...)
+	plain = append(plain, make([]byte, shaLen)...)
+	plain = append(plain, authMsg.InitiatorPubkey...)
+	plain = append(plain, authMsg.Nonce...)
+	plain = append(plain, 0x0)
+	f.Add(true, plain)
+
+	f.Fuzz(func(t *testing.T, isPlain bool, data []byte) {
+		msg := &authMsgV4{}
+		if isPlain {
+			msg.decodePlain(data)
+		} else if err := msg.UnmarshalRLP(data); err != nil {
+			return
+		}
+
+		server := &handshakeState{
+			conn: handshakeConn{
+				local: ecies.ImportECDSA(prv1),
+			},
+		}
+		if err := server.handleAuthMsg(msg, prv1); err != nil {
+			return
+		}
+		if _, err := server.makeAuthResp(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.Secrets(data, data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzAuthResp(f *testing.F) {
+	prv0, _ := crypto.GenerateKey()
+	prv1, _ := crypto.GenerateKey()
+
+	server := &handshakeState{
+		conn: handshakeConn{
+			local: ecies.ImportECDSA(prv1),
+		},
+	}
+	var err error
+	if server.randomPrivKey, err = ecies.GenerateKey(rand.Reader, crypto.S256, nil); err != nil {
+		f.Fatal(err)
+	}
+	authResp, err := server.makeAuthResp()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(false, authResp.MarshalRLP(nil))
+
+	// pre-EIP-8 plain format
+	plain := []byte{}
+	plain = append(plain, authResp.RandomPubkey...)
+	plain = append(plain, authResp.Nonce...)
+	plain = append(plain, 0x0)
+	f.Add(true, plain)
+
+	f.Fuzz(func(t *testing.T, isPlain bool, data []byte) {
+		msg := &authRespV4{}
+		if isPlain {
+			msg.decodePlain(data)
+		} else if err := msg.UnmarshalRLP(data); err != nil {
+			return
+		}
+
+		client := &handshakeState{
+			isClient: true,
+			conn: handshakeConn{
+				local:  ecies.ImportECDSA(prv0),
+				remote: ecies.ImportECDSAPublic(&prv1.PublicKey),
+			},
+		}
+		if _, err := client.makeAuthMsg(prv0); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.handleAuthResp(msg); err != nil {
+			return
+		}
+		if _, err := client.Secrets(data, data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
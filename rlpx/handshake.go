@@ -15,6 +15,7 @@ import (
 	mrand "math/rand"
 
 	"github.com/umbracle/ecies"
+	"github.com/umbracle/go-devp2p"
 	"github.com/umbracle/go-devp2p/crypto"
 	"github.com/umbracle/go-devp2p/enode"
 
@@ -160,17 +161,17 @@ func handshakeServer(conn net.Conn, prv *ecdsa.PrivateKey) (s Secrets, err error
 
 	// Handle auth message
 	if err := state.handleAuthMsg(authMsg, prv); err != nil {
-		return s, nil
+		return s, err
 	}
 
 	// Build response message (authRespV4)
 	authResp, err := state.makeAuthResp()
 	if err != nil {
-		return s, nil
+		return s, err
 	}
 	authRespPacket, err := state.conn.writeMessage(authResp)
 	if err != nil {
-		return s, nil
+		return s, err
 	}
 	return state.Secrets(authPacket, authRespPacket)
 }
@@ -294,8 +295,8 @@ func (h *handshakeState) handleAuthMsg(msg *authMsgV4, prv *ecdsa.PrivateKey) er
 		return err
 	}
 
-	h.remoteRandomPub, _ = importPublicKey(crypto.MarshallPublicKey(remoteRandomPub))
-	return nil
+	h.remoteRandomPub, err = importPublicKey(crypto.MarshallPublicKey(remoteRandomPub))
+	return err
 }
 
 func importPublicKey(pubKey []byte) (*ecies.PublicKey, error) {
@@ -429,7 +430,7 @@ func readProtocolHandshake(conn *Session) (*Info, error) {
 		if err != nil {
 			return nil, err
 		}
-		return nil, fmt.Errorf("disconnected: %s", msg)
+		return nil, &devp2p.DisconnectError{Reason: msg, Remote: true}
 	}
 	if code != handshakeMsg {
 		return nil, fmt.Errorf("expected handshake, got %x", code)
@@ -437,7 +438,7 @@ func readProtocolHandshake(conn *Session) (*Info, error) {
 
 	var info Info
 	if err := info.UnmarshalRLP(buf); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	if (info.ID == enode.ID{}) {
@@ -93,6 +93,14 @@ func (msg *authMsgV4) sealPlain(hs *handshakeState) ([]byte, error) {
 }
 
 func (msg *authMsgV4) decodePlain(input []byte) {
+	// the fields have a fixed size, a short input leaves them zero padded
+	if len(input) < authMsgLen {
+		input = append(input, make([]byte, authMsgLen-len(input))...)
+	}
+	msg.Signature = make([]byte, sigLen)
+	msg.InitiatorPubkey = make([]byte, pubLen)
+	msg.Nonce = make([]byte, shaLen)
+
 	n := copy(msg.Signature[:], input)
 	n += shaLen // skip sha3(initiator-ephemeral-pubk)
 	n += copy(msg.InitiatorPubkey[:], input[n:])
@@ -162,6 +170,12 @@ func (msg *authRespV4) sealPlain(hs *handshakeState) ([]byte, error) {
 }
 
 func (msg *authRespV4) decodePlain(input []byte) {
+	if len(input) < authRespLen {
+		input = append(input, make([]byte, authRespLen-len(input))...)
+	}
+	msg.RandomPubkey = make([]byte, pubLen)
+	msg.Nonce = make([]byte, shaLen)
+
 	n := copy(msg.RandomPubkey[:], input)
 	copy(msg.Nonce[:], input[n:])
 	msg.Version = 4
@@ -23,7 +23,7 @@ type Rlpx struct {
 	addr string
 	port int
 
-	listener   net.Listener
+	listeners  []net.Listener
 	sessionCh  chan *Session
 	shutdownCh chan struct{}
 }
@@ -86,39 +86,70 @@ func (r *Rlpx) Setup(priv *ecdsa.PrivateKey, backends []*devp2p.Protocol, info *
 	r.addr = config["addr"].(string)
 	r.port = config["port"].(int)
 
-	addr := net.TCPAddr{IP: net.ParseIP(r.addr), Port: r.port}
+	// additional addresses to listen on (i.e. ipv6 for dual-stack)
+	addrs := []string{r.addr}
+	if extra, ok := config["addrs"].([]string); ok {
+		addrs = append(addrs, extra...)
+	}
 
-	r.logger.Printf("[INFO] Listening: addr, %s", addr.String())
+	r.sessionCh = make(chan *Session, 10)
 
-	var err error
-	r.listener, err = net.Listen("tcp", addr.String())
-	if err != nil {
-		return err
+	for _, bindAddr := range addrs {
+		addr := net.TCPAddr{IP: net.ParseIP(bindAddr), Port: r.port}
+
+		r.logger.Printf("[INFO] Listening: addr, %s", addr.String())
+
+		listener, err := net.Listen("tcp", addr.String())
+		if err != nil {
+			r.closeListeners()
+			return err
+		}
+		r.listeners = append(r.listeners, listener)
+
+		go r.acceptLoop(listener)
 	}
 
-	r.sessionCh = make(chan *Session, 10)
+	return nil
+}
 
-	go func() {
-		for {
-			conn, err := r.listener.Accept()
+func (r *Rlpx) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			session, err := r.accept(conn)
 			if err != nil {
-				return
-			}
-			go func() {
-				session, err := r.accept(conn)
-				if err != nil {
-					// log
-				} else {
-					select {
-					case r.sessionCh <- session:
-					default:
-					}
+				// log
+			} else {
+				select {
+				case r.sessionCh <- session:
+				default:
 				}
-			}()
+			}
+		}()
+	}
+}
+
+// hasIPv6 returns true if the transport listens on an ipv6 address
+func (r *Rlpx) hasIPv6() bool {
+	for _, listener := range r.listeners {
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok && addr.IP.To4() == nil {
+			return true
 		}
-	}()
+	}
+	return false
+}
 
-	return nil
+func (r *Rlpx) closeListeners() error {
+	var err error
+	for _, listener := range r.listeners {
+		if lErr := listener.Close(); lErr != nil {
+			err = lErr
+		}
+	}
+	return err
 }
 
 // Server returns a new Rlpx server side Session
@@ -131,12 +162,11 @@ func Client(rlpx *Rlpx, conn net.Conn, prv *ecdsa.PrivateKey, pub *ecdsa.PublicK
 	return &Session{rlpx: rlpx, conn: conn, prv: prv, pub: pub, Info: info, isClient: true}
 }
 
-// DialTimeout implements the transport interface
-func (r *Rlpx) DialTimeout(address string, timeout time.Duration) (devp2p.Session, error) {
-	addr, err := enode.ParseURL(address)
-	if err != nil {
-		return nil, err
-	}
+// DialTimeout implements the transport interface. If the record of the node
+// includes both ipv4 and ipv6 endpoints, ipv6 is only used if the transport
+// is listening on an ipv6 address.
+func (r *Rlpx) DialTimeout(node *enode.Node, timeout time.Duration) (devp2p.Session, error) {
+	addr := node.SelectEnode(r.hasIPv6())
 
 	tcpAddr := addr.TCPAddr()
 	conn, err := net.DialTimeout("tcp", tcpAddr.String(), timeout)
@@ -164,7 +194,7 @@ func (r *Rlpx) Accept() (devp2p.Session, error) {
 
 func (r *Rlpx) Close() error {
 	close(r.shutdownCh)
-	return r.listener.Close()
+	return r.closeListeners()
 }
 
 // networkInfoToLocalInfo converts the network info message into rlpx.Info
@@ -84,10 +84,11 @@ type Session struct {
 	pub *ecdsa.PublicKey
 
 	// shutdown
-	shutdown     bool
-	shutdownErr  error
-	shutdownCh   chan struct{}
-	shutdownLock sync.Mutex
+	shutdown       bool
+	shutdownErr    error
+	shutdownRemote bool // true if the remote peer sent the disconnect
+	shutdownCh     chan struct{}
+	shutdownLock   sync.Mutex
 
 	// ping/pong
 	pongTimeout *time.Timer
@@ -299,6 +300,18 @@ func (s *Session) CloseChan() <-chan struct{} {
 	return s.shutdownCh
 }
 
+// Err returns why the session was closed and whether it was the remote
+// peer who closed it. It returns nil while the session is still open.
+func (s *Session) Err() error {
+	s.shutdownLock.Lock()
+	defer s.shutdownLock.Unlock()
+
+	if !s.shutdown {
+		return nil
+	}
+	return devp2p.NewDisconnectError(s.shutdownErr, s.shutdownRemote)
+}
+
 // IsClosed does a safe check to see if we have shutdown
 func (s *Session) IsClosed() bool {
 	select {
@@ -347,9 +360,11 @@ func (s *Session) recvLoop() error {
 			}
 
 			// TODO, logger
-			return msg
+			return &devp2p.DisconnectError{Reason: msg, Remote: true}
 		default:
-			s.handleStreamMessage(code, buf)
+			if err := s.handleStreamMessage(code, buf); err != nil {
+				return err
+			}
 		}
 	}
 }
@@ -357,7 +372,13 @@ func (s *Session) recvLoop() error {
 func (s *Session) exitErr(err error) {
 	s.shutdownLock.Lock()
 	if s.shutdownErr == nil {
-		s.shutdownErr = err
+		if discErr, ok := err.(*devp2p.DisconnectError); ok && discErr.Remote {
+			// keep the plain reason sent by the remote peer
+			s.shutdownErr = discErr.Reason
+			s.shutdownRemote = true
+		} else {
+			s.shutdownErr = err
+		}
 	}
 	s.shutdownLock.Unlock()
 
@@ -424,9 +445,13 @@ func (s *Session) ReadMsg() (uint64, []byte, error) {
 
 var errPlainMessageTooLarge = errors.New("message length >= 16MB")
 
-func (s *Session) handleStreamMessage(code uint64, buf []byte) {
+func (s *Session) handleStreamMessage(code uint64, buf []byte) error {
 	stream := s.getStream(code)
+	if stream == nil {
+		return fmt.Errorf("message code %d not supported", code)
+	}
 	stream.readData(code, buf)
+	return nil
 }
 
 func (s *Session) WriteRawMsg(code uint64, buf []byte) error {
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/umbracle/go-devp2p"
 	"github.com/umbracle/go-devp2p/crypto"
 )
 
@@ -235,6 +236,42 @@ func TestSessionClose(t *testing.T) {
 	}
 }
 
+func TestSessionDisconnectErr(t *testing.T) {
+	c0, c1 := pipe(t)
+	defer c1.Close()
+
+	if c0.Err() != nil {
+		t.Fatal("open session should not have an error")
+	}
+
+	ch := c1.CloseChan()
+	if err := c0.Disconnect(DiscUselessPeer); err != nil {
+		t.Fatalf("Failed to send disconnect message: %v", err)
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("failed")
+	}
+
+	local, ok := c0.Err().(*devp2p.DisconnectError)
+	if !ok {
+		t.Fatalf("expected a disconnect error but found %v", c0.Err())
+	}
+	if local.Remote || local.Reason != DiscUselessPeer {
+		t.Fatalf("bad local disconnect error: %v", local)
+	}
+
+	remote, ok := c1.Err().(*devp2p.DisconnectError)
+	if !ok {
+		t.Fatalf("expected a disconnect error but found %v", c1.Err())
+	}
+	if !remote.Remote || remote.Reason != DiscUselessPeer {
+		t.Fatalf("bad remote disconnect error: %v", remote)
+	}
+}
+
 func TestSessionWriteClosedConnection(t *testing.T) {
 	c0, c1 := pipe(t)
 	defer c1.Close()
@@ -3,6 +3,7 @@ package devp2p
 import (
 	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -13,12 +14,17 @@ import (
 
 	"github.com/umbracle/go-devp2p/discovery"
 	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
 )
 
 // Protocol is a wire protocol
 type Protocol struct {
 	Spec      ProtocolSpec
 	HandlerFn func(conn Stream, peer *Peer) error
+
+	// Attributes are the entries the protocol adds to the local node record on
+	// start. They can be updated later with the LocalNode of the server.
+	Attributes map[string]enr.Entry
 }
 
 // ProtocolSpec is a specification of an etheruem protocol
@@ -50,7 +56,15 @@ type Instance struct {
 
 const (
 	defaultDialTimeout = 10 * time.Second
-	defaultDialTasks   = 15
+
+	// discmixTimeout is the time to wait for a discovery source
+	// before taking the nodes of any other source
+	discmixTimeout   = 5 * time.Second
+	defaultDialTasks = 15
+
+	// staticRedialInterval is the time to wait before
+	// dialing again a static node that failed
+	staticRedialInterval = 30 * time.Second
 )
 
 type EventType int
@@ -77,6 +91,9 @@ func (t EventType) String() string {
 type MemberEvent struct {
 	Type EventType
 	Peer *Peer
+
+	// Reason is set on NodeLeave events with the cause of the disconnection
+	Reason *DisconnectError
 }
 
 // Server is the ethereum client
@@ -106,6 +123,15 @@ type Server struct {
 
 	Discovery discovery.Discovery
 	Enode     *enode.Enode
+
+	// discmix mixes the nodes of the discovery sources to dial
+	discmix *discovery.FairMix
+
+	localNode *enode.LocalNode
+
+	// static are the urls of the static nodes with their last known endpoint
+	staticLock sync.Mutex
+	static     map[enode.ID]string
 }
 
 // NewServer creates a new node
@@ -115,6 +141,15 @@ func NewServer(key *ecdsa.PrivateKey, transport Transport, opts ...ConfigOption)
 		opt(config)
 	}
 
+	static := map[enode.ID]string{}
+	for _, rawURL := range config.StaticNodes {
+		node, err := enode.ParseURL(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static node '%s': %v", rawURL, err)
+		}
+		static[node.ID] = rawURL
+	}
+
 	enode := &enode.Enode{
 		IP:  net.ParseIP(config.BindAddress),
 		TCP: uint16(config.BindPort),
@@ -122,6 +157,11 @@ func NewServer(key *ecdsa.PrivateKey, transport Transport, opts ...ConfigOption)
 		ID:  enode.PubkeyToEnode(&key.PublicKey),
 	}
 
+	localNode, err := newLocalNode(key, enode, config)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
 		Name:         config.Name,
 		key:          key,
@@ -137,6 +177,9 @@ func NewServer(key *ecdsa.PrivateKey, transport Transport, opts ...ConfigOption)
 		dispatcher:   NewDispatcher(),
 		peerStore:    &NoopPeerStore{},
 		transport:    transport,
+		localNode:    localNode,
+		discmix:      discovery.NewFairMix(discmixTimeout),
+		static:       static,
 	}
 
 	// setup discovery
@@ -147,22 +190,98 @@ func NewServer(key *ecdsa.PrivateKey, transport Transport, opts ...ConfigOption)
 	return s, nil
 }
 
+func newLocalNode(key *ecdsa.PrivateKey, node *enode.Enode, config *Config) (*enode.LocalNode, error) {
+	localNode, err := enode.NewLocalNode(key, config.NodeSeqStore)
+	if err != nil {
+		return nil, err
+	}
+
+	hasIPv6 := false
+	for _, addr := range config.bindAddrs() {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid bind address '%s'", addr)
+		}
+		if ip.To4() == nil {
+			hasIPv6 = true
+		}
+		if !ip.IsUnspecified() {
+			localNode.SetStaticIP(ip)
+		}
+	}
+
+	tcp, udp := enr.Uint16(node.TCP), enr.Uint16(node.UDP)
+	localNode.Set("tcp", &tcp)
+	localNode.Set("udp", &udp)
+	if hasIPv6 {
+		localNode.Set("tcp6", &tcp)
+		localNode.Set("udp6", &udp)
+	}
+	return localNode, nil
+}
+
 func (s *Server) setupDiscovery() error {
 	// setup discovery factories
+	bindAddrs := []*net.UDPAddr{}
+	for _, addr := range s.config.bindAddrs() {
+		bindAddrs = append(bindAddrs, &net.UDPAddr{IP: net.ParseIP(addr), Port: int(s.Enode.UDP)})
+	}
+
 	discoveryConfig := &discovery.DiscoveryConfig{
+		Logger:    s.logger,
 		Key:       s.key,
 		Enode:     s.Enode,
+		LocalNode: s.localNode,
+		BindAddrs: bindAddrs,
 		Bootnodes: s.config.Bootnodes,
+		NodeDB:    s.config.NodeDB,
 	}
 
-	discovery, err := discovery.DiscV4(context.Background(), discoveryConfig)
+	d, err := discovery.DiscV4(context.Background(), discoveryConfig)
 	if err != nil {
 		return err
 	}
-	s.Discovery = discovery
+	s.Discovery = d
+
+	source := d.RandomNodes()
+	if r, ok := d.(nodeRecordRequester); ok && s.config.NodeFilter != nil {
+		// the filter might need the record of the nodes
+		source = discovery.ResolveRecords(source, r.RequestNodeRecord)
+	}
+	s.discmix.AddSource(source)
 	return nil
 }
 
+// nodeRecordRequester is a discovery protocol that can request the record of a node
+type nodeRecordRequester interface {
+	RequestNodeRecord(n *enode.Node) (*enr.Record, error)
+}
+
+// nodeResolver is a discovery protocol that can resolve the current endpoint of a node
+type nodeResolver interface {
+	Resolve(id enode.ID) (*enode.Enode, error)
+}
+
+// AddDiscoverySource adds a source of nodes to dial (i.e. dns discovery)
+func (s *Server) AddDiscoverySource(it discovery.Iterator) {
+	s.discmix.AddSource(it)
+}
+
+// runDiscoveryIterator sends the nodes of the discovery sources to the dialer
+func (s *Server) runDiscoveryIterator(nodeCh chan<- *enode.Node) {
+	var it discovery.Iterator = s.discmix
+	if s.config.NodeFilter != nil {
+		it = discovery.Filter(it, s.config.NodeFilter)
+	}
+	for it.Next() {
+		select {
+		case nodeCh <- it.Node():
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
 // GetPeers returns a copy of list of peers
 func (s *Server) GetPeers() []string {
 	s.peersLock.Lock()
@@ -198,16 +317,32 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
-	for _, peer := range storedPeers {
-		s.Dial(peer)
+	// the stored peers and the static nodes are dialed once the dial tasks
+	// run since the addPeer channel would drop them if there are too many
+	initial := append([]string{}, storedPeers...)
+	s.staticLock.Lock()
+	for _, rawURL := range s.static {
+		initial = append(initial, rawURL)
 	}
+	s.staticLock.Unlock()
 
 	// Create rlpx info
 	s.buildInfo()
 
+	// add the entries of the protocols to the local record
+	for _, p := range s.config.Protocols {
+		for k, v := range p.Attributes {
+			s.localNode.Set(k, v)
+		}
+	}
+	if err := s.localNode.Sign(); err != nil {
+		return err
+	}
+
 	config := map[string]interface{}{
-		"addr": s.config.BindAddress,
-		"port": s.config.BindPort,
+		"addr":  s.config.BindAddress,
+		"addrs": s.config.BindAddresses,
+		"port":  s.config.BindPort,
 	}
 
 	if err := s.transport.Setup(s.key, s.config.Protocols, s.info, config); err != nil {
@@ -226,7 +361,7 @@ func (s *Server) Start() error {
 	// Start discovery process
 	s.Discovery.Schedule()
 
-	go s.dialRunner()
+	go s.dialRunner(initial)
 	return nil
 }
 
@@ -257,7 +392,8 @@ func (s *Server) dialTask(id string, tasks chan string) {
 			if err != nil {
 				s.logger.Printf("[ERROR]: dial: id, %s, err, %v", id, err)
 
-				if err.Error() == "too many peers" {
+				var discErr *DisconnectError
+				if errors.As(err, &discErr) && discErr.Reason == DiscTooManyPeers {
 					busy = true
 				}
 			}
@@ -269,6 +405,15 @@ func (s *Server) dialTask(id string, tasks chan string) {
 						// log
 					}
 				}
+			} else if err != nil && s.isStatic(task) {
+				// the static node might have changed its endpoint, resolve
+				// it again and reschedule the dial with the new one
+				if contains {
+					if err := s.dispatcher.Remove(task); err != nil {
+						// log
+					}
+				}
+				go s.redialStatic(task)
 			} else {
 				// either worked or failed for a reason different than 'too many peers'
 				if contains {
@@ -289,7 +434,52 @@ func (s *Server) dialTask(id string, tasks chan string) {
 	}
 }
 
-func (s *Server) dialRunner() {
+// isStatic returns true if the enode is one of the static nodes
+func (s *Server) isStatic(rawURL string) bool {
+	node, err := enode.ParseNode(rawURL)
+	if err != nil {
+		return false
+	}
+	s.staticLock.Lock()
+	defer s.staticLock.Unlock()
+
+	_, ok := s.static[node.ID()]
+	return ok
+}
+
+// redialStatic schedules a new dial of a static node with its current endpoint
+func (s *Server) redialStatic(rawURL string) {
+	node, err := enode.ParseURL(rawURL)
+	if err != nil {
+		return
+	}
+
+	if r, ok := s.Discovery.(nodeResolver); ok {
+		resolved, err := r.Resolve(node.ID)
+		if err != nil {
+			s.logger.Printf("[DEBUG] failed to resolve static node: id, %s, err, %v", node.ID, err)
+		} else {
+			if resolved.TCP == 0 {
+				// the tcp port is not always known by the discovery
+				resolved.TCP = node.TCP
+			}
+			if newURL := resolved.String(); newURL != rawURL {
+				s.logger.Printf("[DEBUG] static node endpoint changed: id, %s, enode, %s", node.ID, newURL)
+				rawURL = newURL
+			}
+		}
+	}
+
+	s.staticLock.Lock()
+	s.static[node.ID] = rawURL
+	s.staticLock.Unlock()
+
+	if err := s.dispatcher.Add(&PeriodicDial{rawURL}, staticRedialInterval); err != nil {
+		s.logger.Printf("[ERROR] failed to schedule static node dial: id, %s, err, %v", node.ID, err)
+	}
+}
+
+func (s *Server) dialRunner(initial []string) {
 	s.dispatcher.SetEnabled(true)
 
 	tasks := make(chan string, s.config.DialTasks)
@@ -303,13 +493,26 @@ func (s *Server) dialRunner() {
 		tasks <- enode
 	}
 
+	for _, rawURL := range initial {
+		select {
+		case tasks <- rawURL:
+		case <-s.closeCh:
+			return
+		}
+	}
+
+	discoveredCh := make(chan *enode.Node)
+	go s.runDiscoveryIterator(discoveredCh)
+
 	for {
 		select {
 		case enode := <-s.addPeer:
 			sendToTask(enode)
 
-		case enode := <-s.Discovery.Deliver():
-			sendToTask(enode)
+		case node := <-discoveredCh:
+			// the endpoint of the node is the one of its record, if known,
+			// completed with the endpoint found by the discovery
+			sendToTask(node.URL())
 
 		case enode := <-s.dispatcher.Events():
 			sendToTask(enode.ID())
@@ -320,17 +523,22 @@ func (s *Server) dialRunner() {
 	}
 }
 
-// Dial dials an enode (async)
-func (s *Server) Dial(enode string) {
+// Dial dials a node (async)
+func (s *Server) Dial(node *enode.Node) {
+	s.dial(node.String())
+}
+
+// dial dials a node in either enode url or text record format (async)
+func (s *Server) dial(rawURL string) {
 	select {
-	case s.addPeer <- enode:
+	case s.addPeer <- rawURL:
 	default:
 	}
 }
 
-// DialSync dials and waits for the result
-func (s *Server) DialSync(enode string) error {
-	return s.connectWithEnode(enode)
+// DialSync dials a node and waits for the result
+func (s *Server) DialSync(node *enode.Node) error {
+	return s.connectWithNode(node)
 }
 
 // GetPeerByPrefix searches a peer by his prefix
@@ -369,19 +577,24 @@ func (s *Server) Disconnect() {
 	}
 }
 
-func (s *Server) connect(addrs string) error {
-	return s.connectWithEnode(addrs)
+func (s *Server) connect(rawURL string) error {
+	node, err := enode.ParseNode(rawURL)
+	if err != nil {
+		return err
+	}
+	return s.connectWithNode(node)
 }
 
-func (s *Server) connectWithEnode(rawURL string) error {
-	if _, ok := s.peers[rawURL]; ok {
-		// TODO: add tests
-		// Trying to connect with an already connected id
-		// TODO, after disconnect do we remove the peer from this list?
+func (s *Server) connectWithNode(node *enode.Node) error {
+	s.peersLock.Lock()
+	_, ok := s.peers[node.ID().String()]
+	s.peersLock.Unlock()
+	if ok {
+		// already connected with the node
 		return nil
 	}
 
-	session, err := s.transport.DialTimeout(rawURL, defaultDialTimeout)
+	session, err := s.transport.DialTimeout(node, defaultDialTimeout)
 	if err != nil {
 		return err
 	}
@@ -439,7 +652,18 @@ func (s *Server) addSession(session Session) error {
 
 		s.peersLock.Lock()
 		delete(s.peers, p.ID)
+		p.Status = PeerDisconnected
 		s.peersLock.Unlock()
+
+		reason := p.DisconnectReason()
+		if reason != nil {
+			s.logger.Printf("[DEBUG] peer disconnected: id, %s, reason, %v", p.PrettyID(), reason)
+		}
+
+		select {
+		case s.EventCh <- MemberEvent{Type: NodeLeave, Peer: p, Reason: reason}:
+		default:
+		}
 	}()
 
 	s.peersLock.Lock()
@@ -458,6 +682,16 @@ func (s *Server) ID() enode.ID {
 	return s.Enode.ID
 }
 
+// LocalNode returns the local node that maintains the record of the server
+func (s *Server) LocalNode() *enode.LocalNode {
+	return s.localNode
+}
+
+// NodeRecord returns the signed node record of the server
+func (s *Server) NodeRecord() *enr.Record {
+	return s.localNode.Record()
+}
+
 func (s *Server) getProtocol(name string, version uint) (*Protocol, bool) {
 	for _, p := range s.config.Protocols {
 		proto := p.Spec
@@ -478,6 +712,14 @@ func (s *Server) Close() {
 		panic(err)
 	}
 
+	// stop the discovery sources
+	s.discmix.Close()
+
+	// close the discovery backend, it writes the node database
+	if err := s.Discovery.Close(); err != nil {
+		s.logger.Printf("[ERROR] failed to close discovery: err, %v", err)
+	}
+
 	// close transport
 	if err := s.transport.Close(); err != nil {
 		s.logger.Printf("[ERROR] failed to close transport: err, %v", err.Error())
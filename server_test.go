@@ -0,0 +1,140 @@
+package devp2p_test
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+	"github.com/umbracle/go-devp2p/forkid"
+	"github.com/umbracle/go-devp2p/wire/eth"
+)
+
+// dialTransport is a transport that only records the nodes dialed
+type dialTransport struct {
+	dialCh    chan enode.ID
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newDialTransport() *dialTransport {
+	return &dialTransport{
+		dialCh:  make(chan enode.ID, 64),
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (d *dialTransport) Setup(priv *ecdsa.PrivateKey, backends []*devp2p.Protocol, info *devp2p.Info, config map[string]interface{}) error {
+	return nil
+}
+
+func (d *dialTransport) DialTimeout(node *enode.Node, timeout time.Duration) (devp2p.Session, error) {
+	select {
+	case d.dialCh <- node.ID():
+	default:
+	}
+	return nil, fmt.Errorf("dial not supported")
+}
+
+func (d *dialTransport) Accept() (devp2p.Session, error) {
+	<-d.closeCh
+	return nil, fmt.Errorf("transport closed")
+}
+
+func (d *dialTransport) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.closeCh)
+	})
+	return nil
+}
+
+// freePort returns an udp port that is not in use
+func freePort(t *testing.T) int {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.NoError(t, err)
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func newTestServer(t *testing.T, transport devp2p.Transport, opts ...devp2p.ConfigOption) *devp2p.Server {
+	key, _ := crypto.GenerateKey()
+
+	opts = append([]devp2p.ConfigOption{devp2p.WithBindPort(freePort(t))}, opts...)
+	s, err := devp2p.NewServer(key, transport, opts...)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Start())
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestServer_NodeFilter(t *testing.T) {
+	fork := forkid.NewForkID([32]byte{0x1}, []uint64{10, 20})
+	other := forkid.NewForkID([32]byte{0x2}, []uint64{10, 20})
+
+	ethProtocol := func(id forkid.ID) *devp2p.Protocol {
+		return &devp2p.Protocol{
+			Spec:       devp2p.ProtocolSpec{Name: "eth", Version: 66, Length: 17},
+			Attributes: map[string]enr.Entry{"eth": &enr.Eth{id}},
+		}
+	}
+
+	// b0 is in the same chain and b1 is not
+	b0 := newTestServer(t, newDialTransport(), devp2p.WithProtocol(ethProtocol(fork.At(15))))
+	b1 := newTestServer(t, newDialTransport(), devp2p.WithProtocol(ethProtocol(other.At(15))))
+
+	// the records of the nodes found by discv4 are requested for the filter
+	transport := newDialTransport()
+	newTestServer(t, transport,
+		devp2p.WithBootnodes([]string{b0.Enode.String(), b1.Enode.String()}),
+		devp2p.WithNodeFilter(eth.NewNodeFilter(fork, func() uint64 {
+			return 15
+		})),
+	)
+
+	// the lookup waits for the neighbors of the nodes until the response timeout
+	timeout := time.After(30 * time.Second)
+	for {
+		select {
+		case id := <-transport.dialCh:
+			assert.NotEqual(t, b1.Enode.ID, id)
+			if id == b0.Enode.ID {
+				return
+			}
+		case <-timeout:
+			t.Fatal("node of the same chain not dialed")
+		}
+	}
+}
+
+func TestServer_StaticNodes(t *testing.T) {
+	// more static nodes than the dial queue
+	static := map[enode.ID]bool{}
+	urls := []string{}
+	for i := 0; i < 30; i++ {
+		key, _ := crypto.GenerateKey()
+		node := enode.NewNode(&key.PublicKey, net.ParseIP("127.0.0.1"), uint16(30303+i), uint16(30303+i))
+		static[node.ID()] = true
+		urls = append(urls, node.String())
+	}
+
+	transport := newDialTransport()
+	newTestServer(t, transport, devp2p.WithStaticNodes(urls...))
+
+	timeout := time.After(5 * time.Second)
+	for len(static) != 0 {
+		select {
+		case id := <-transport.dialCh:
+			delete(static, id)
+		case <-timeout:
+			t.Fatalf("%d static nodes not dialed", len(static))
+		}
+	}
+}
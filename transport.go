@@ -3,6 +3,8 @@ package devp2p
 import (
 	"crypto/ecdsa"
 	"time"
+
+	"github.com/umbracle/go-devp2p/enode"
 )
 
 // Stream is a stream inside a session
@@ -36,6 +38,13 @@ type Session interface {
 
 	// Close closes the connection
 	Close() error
+
+	// Disconnect closes the connection sending the reason to the remote peer
+	Disconnect(reason DiscReason) error
+
+	// Err returns a *DisconnectError describing why and by whom the
+	// session was closed. It returns nil while the session is open.
+	Err() error
 }
 
 // Transport is a generic network transport protocol
@@ -43,8 +52,8 @@ type Transport interface {
 	// Setup starts the protocol with the given private key
 	Setup(priv *ecdsa.PrivateKey, backends []*Protocol, info *Info, config map[string]interface{}) error
 
-	// DialTimeout connects to the address within a given timeout.
-	DialTimeout(addr string, timeout time.Duration) (Session, error)
+	// DialTimeout connects to the node within a given timeout.
+	DialTimeout(node *enode.Node, timeout time.Duration) (Session, error)
 
 	// Accept accepts the new session
 	Accept() (Session, error)
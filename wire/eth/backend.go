@@ -8,6 +8,7 @@ import (
 
 	"github.com/umbracle/fastrlp"
 	"github.com/umbracle/go-devp2p"
+	"github.com/umbracle/go-devp2p/enr"
 )
 
 type Eth66Backend interface {
@@ -138,7 +139,8 @@ func (h *handler) handshake() (*Status, error) {
 
 	remote := &Status{}
 	if err := UnmarshalRLP(buf, remote); err != nil {
-		panic(err)
+		h.Close()
+		return nil, err
 	}
 
 	if err := localStatus.Equal(remote); err != nil {
@@ -283,7 +285,7 @@ func (h *handler) handleMsg(code uint16, buf []byte) error {
 		// unhandled
 
 	default:
-		panic(fmt.Errorf("message not handled: %d", code))
+		return fmt.Errorf("message not handled: %d", code)
 	}
 
 	return nil
@@ -294,7 +296,15 @@ func (h *handler) Close() error {
 }
 
 func (b *Eth66Protocol) Eth66() *devp2p.Protocol {
+	var attributes map[string]enr.Entry
+	if b.Impl != nil {
+		attributes = map[string]enr.Entry{
+			"eth": b.ethEntry(),
+		}
+	}
+
 	return &devp2p.Protocol{
+		Attributes: attributes,
 		Spec: devp2p.ProtocolSpec{
 			Name:    "eth",
 			Version: 66,
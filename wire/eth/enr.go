@@ -0,0 +1,36 @@
+package eth
+
+import (
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+	"github.com/umbracle/go-devp2p/forkid"
+)
+
+// UpdateRecord sets the 'eth' entry of the local node record with the fork id
+// of the current status. The fork id changes when the head passes a fork block,
+// it has to be called once the server has started and every time the head of
+// the chain changes. The record is only signed again if the fork id changes.
+func (b *Eth66Protocol) UpdateRecord(localNode *enode.LocalNode) {
+	localNode.Set("eth", b.ethEntry())
+}
+
+// ethEntry returns the 'eth' entry with the fork id of the current status
+func (b *Eth66Protocol) ethEntry() *enr.Eth {
+	return &enr.Eth{b.Impl.Status().ForkID}
+}
+
+// NewNodeFilter returns a filter of the discovered nodes that only accepts the
+// nodes with an 'eth' entry in the record compatible with the local chain.
+// 'head' returns the current block number of the local chain.
+func NewNodeFilter(forkID *forkid.ForkID, head func() uint64) func(*enode.Node) bool {
+	return func(n *enode.Node) bool {
+		if n.Record() == nil {
+			return false
+		}
+		var entry enr.Eth
+		if err := n.Record().LoadEntry(&entry); err != nil {
+			return false
+		}
+		return forkID.Validate(head(), entry[0].Hash, entry[0].Next) == nil
+	}
+}
@@ -0,0 +1,93 @@
+package eth
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/umbracle/go-devp2p/crypto"
+	"github.com/umbracle/go-devp2p/enode"
+	"github.com/umbracle/go-devp2p/enr"
+	"github.com/umbracle/go-devp2p/forkid"
+)
+
+func TestNodeFilter(t *testing.T) {
+	fork := forkid.NewForkID([32]byte{0x1}, []uint64{10, 20})
+	filter := NewNodeFilter(fork, func() uint64 {
+		return 15
+	})
+
+	key, _ := crypto.GenerateKey()
+	node := enode.NewNode(&key.PublicKey, net.ParseIP("127.0.0.1"), 30303, 30303)
+
+	withRecord := func(entries ...enr.KeyedEntry) *enode.Node {
+		record := &enr.Record{}
+		for _, e := range entries {
+			record.SetEntry(e)
+		}
+		assert.NoError(t, record.Sign(key))
+
+		n, err := enode.NodeWithEnode(record, node.Enode())
+		assert.NoError(t, err)
+		return n
+	}
+	withForkID := func(id forkid.ID) *enode.Node {
+		return withRecord(&enr.Eth{id})
+	}
+
+	// same fork
+	assert.True(t, filter(withForkID(fork.At(15))))
+
+	// remote is behind but knows about the next fork
+	assert.True(t, filter(withForkID(fork.At(5))))
+
+	// other chain
+	other := forkid.NewForkID([32]byte{0x2}, []uint64{10, 20})
+	assert.False(t, filter(withForkID(other.At(15))))
+
+	// nodes without record or eth entry
+	assert.False(t, filter(node))
+	assert.False(t, filter(withRecord()))
+}
+
+// statusBackend is a backend that only returns the status
+type statusBackend struct {
+	Eth66Backend
+	status *Status
+}
+
+func (s *statusBackend) Status() *Status {
+	return s.status
+}
+
+func TestEth66_UpdateRecord(t *testing.T) {
+	fork := forkid.NewForkID([32]byte{0x1}, []uint64{10, 20})
+
+	impl := &statusBackend{status: &Status{ForkID: fork.At(5)}}
+	b := &Eth66Protocol{Impl: impl}
+
+	key, _ := crypto.GenerateKey()
+	localNode, err := enode.NewLocalNode(key, nil)
+	assert.NoError(t, err)
+
+	forkID := func() forkid.ID {
+		var entry enr.Eth
+		assert.NoError(t, localNode.Record().LoadEntry(&entry))
+		return entry[0]
+	}
+
+	b.UpdateRecord(localNode)
+	assert.Equal(t, fork.At(5), forkID())
+	seq := localNode.Seq()
+
+	// the record is not updated while the fork id is the same
+	impl.status = &Status{ForkID: fork.At(8)}
+	b.UpdateRecord(localNode)
+	assert.Equal(t, seq, localNode.Seq())
+
+	// the head passes a fork block
+	impl.status = &Status{ForkID: fork.At(15)}
+	b.UpdateRecord(localNode)
+	assert.Equal(t, fork.At(15), forkID())
+	assert.Equal(t, seq+1, localNode.Seq())
+}
@@ -0,0 +1,94 @@
+package eth
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/umbracle/fastrlp"
+	"github.com/umbracle/go-devp2p/enr"
+	"github.com/umbracle/go-devp2p/forkid"
+)
+
+func newFuzzCodec(kind byte) codec {
+	switch kind {
+	case 0:
+		return &Status{}
+	case 1:
+		return &BlockHeadersPacket{}
+	case 2:
+		return &HashList{}
+	case 3:
+		return &EmptyArray{}
+	case 4:
+		return &enr.Eth{}
+	}
+	return nil
+}
+
+func FuzzDecodeMessage(f *testing.F) {
+	seeds := []codec{
+		&Status{
+			ProtocolVersion: 66,
+			NetworkID:       1,
+			TD:              big.NewInt(10),
+			Head:            [32]byte{0x1},
+			Genesis:         [32]byte{0x2},
+			ForkID:          forkid.ID{Hash: []byte{0x1, 0x2, 0x3, 0x4}, Next: 10},
+		},
+		&BlockHeadersPacket{Hash: &([32]byte{0x1}), Amount: 10, Skip: 1, Reverse: true},
+		&HashList{[32]byte{0x1}, [32]byte{0x2}},
+		&EmptyArray{},
+		&enr.Eth{{Hash: []byte{0x1, 0x2, 0x3, 0x4}}},
+	}
+	for kind, msg := range seeds {
+		f.Add(byte(kind), MarshalRLP(msg))
+	}
+
+	f.Fuzz(func(t *testing.T, kind byte, data []byte) {
+		msg := newFuzzCodec(kind)
+		if msg == nil {
+			return
+		}
+		if err := UnmarshalRLP(data, msg); err != nil {
+			return
+		}
+
+		// the encoding of a decoded message is stable
+		enc := MarshalRLP(msg)
+		msg2 := newFuzzCodec(kind)
+		if err := UnmarshalRLP(enc, msg2); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(enc, MarshalRLP(msg2)) {
+			t.Fatal("round trip encoding does not match")
+		}
+	})
+}
+
+func FuzzDecodeResponse(f *testing.F) {
+	f.Add(MarshalRLP(&Request{RequestId: 1, Body: &EmptyArray{}}))
+	f.Add(MarshalRLP(&Request{RequestId: 1, Body: &HashList{[32]byte{0x1}}}))
+	f.Add(MarshalRLP(&Request{RequestId: 1, Body: &BlockHeadersPacket{Number: 1}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, body := range []Unmarshaler{nil, &EmptyArray{}, &HashList{}, &BlockHeadersPacket{}} {
+			UnmarshalRLP(data, &Response{Body: body})
+		}
+	})
+}
+
+func FuzzDecodeNewBlockHashes(f *testing.F) {
+	f.Add([]byte{0xc0})
+	ar := &fastrlp.Arena{}
+	item := ar.NewArray()
+	item.Set(ar.NewBytes(make([]byte, 32)))
+	item.Set(ar.NewUint(1))
+	list := ar.NewArray()
+	list.Set(item)
+	f.Add(list.MarshalTo(nil))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		UnmarshalRLP(data, &newBlockHashesPacket{})
+	})
+}
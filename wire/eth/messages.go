@@ -88,7 +88,14 @@ func (e *EmptyArray) MarshalRLPWith(ar *fastrlp.Arena) *fastrlp.Value {
 }
 
 func (e *EmptyArray) UnmarshalRLPWith(v *fastrlp.Value) error {
-	panic("unimplemented")
+	elems, err := v.GetElems()
+	if err != nil {
+		return err
+	}
+	if len(elems) != 0 {
+		return fmt.Errorf("empty array expected but found %d items", len(elems))
+	}
+	return nil
 }
 
 type BlockHeadersPacket struct {